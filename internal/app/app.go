@@ -68,6 +68,8 @@ func makeRootCmd(version string) *cobra.Command {
 	rootCmd.AddCommand(makeLintCmd())
 	rootCmd.AddCommand(makeECSCheckCmd())
 	rootCmd.AddCommand(makeTranspileCmd())
+	rootCmd.AddCommand(makeSimulateCmd())
+	rootCmd.AddCommand(makeUntranspileCmd())
 
 	return rootCmd
 }
@@ -0,0 +1,113 @@
+package evaluate
+
+import (
+	ast "github.com/herrBez/baffo/ast"
+)
+
+// Utility functions to convert the Logstash attributes into plain values
+
+type hashEntry struct {
+	key   string
+	value interface{}
+}
+
+// attributeValue converts an attribute into a string, a float64, a list or a list of hashEntry (for hashes,
+// to keep the order of the entries)
+func attributeValue(attr ast.Attribute) interface{} {
+	switch a := attr.(type) {
+	case ast.StringAttribute:
+		return a.Value()
+	case ast.NumberAttribute:
+		return a.Value()
+	case ast.ArrayAttribute:
+		l := []interface{}{}
+		for _, elem := range a.Attributes {
+			if elem != nil {
+				l = append(l, attributeValue(elem))
+			}
+		}
+		return l
+	case ast.HashAttribute:
+		entries := []hashEntry{}
+		for _, entry := range a.Entries {
+			var key string
+			switch k := entry.Key.(type) {
+			case ast.StringAttribute:
+				key = k.Value()
+			default:
+				key = k.ValueString()
+			}
+			var value interface{}
+			if entry.Value != nil {
+				value = attributeValue(entry.Value)
+			}
+			entries = append(entries, hashEntry{key: key, value: value})
+		}
+		return entries
+	}
+	return nil
+}
+
+func mergeOptionValues(previous, value interface{}) interface{} {
+	if p, ok := previous.([]hashEntry); ok {
+		if v, ok := value.([]hashEntry); ok {
+			return append(p, v...)
+		}
+	}
+	return append(toList(previous), toList(value)...)
+}
+
+func toList(v interface{}) []interface{} {
+	if l, ok := v.([]interface{}); ok {
+		return l
+	}
+	return []interface{}{v}
+}
+
+// rubyArray converts a value as Ruby's Array(): nil is an empty array and a scalar is wrapped
+func rubyArray(v interface{}) []interface{} {
+	if v == nil {
+		return []interface{}{}
+	}
+	return toList(v)
+}
+
+func toInterfaces(s []string) []interface{} {
+	l := make([]interface{}, len(s))
+	for i := range s {
+		l[i] = s[i]
+	}
+	return l
+}
+
+// stringList converts a string or an array option into a list of strings
+func stringList(v interface{}) []string {
+	switch tv := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		l := []string{}
+		for _, e := range tv {
+			l = append(l, valueToString(e))
+		}
+		return l
+	default:
+		return []string{valueToString(tv)}
+	}
+}
+
+// hashEntries returns the entries of a hash option. Logstash also accepts arrays of
+// alternating keys and values (e.g., ["old", "new"]) for hash options.
+func hashEntries(v interface{}) []hashEntry {
+	switch tv := v.(type) {
+	case []hashEntry:
+		return tv
+	case []interface{}:
+		entries := []hashEntry{}
+		for i := 0; i+1 < len(tv); i += 2 {
+			entries = append(entries, hashEntry{key: valueToString(tv[i]), value: tv[i+1]})
+		}
+		return entries
+	}
+	return nil
+}
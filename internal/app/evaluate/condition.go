@@ -0,0 +1,202 @@
+package evaluate
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+
+	ast "github.com/herrBez/baffo/ast"
+	"github.com/pkg/errors"
+)
+
+func selectorPath(s ast.Selector) []string {
+	path := []string{}
+	for _, e := range s.Elements {
+		path = append(path, strings.TrimSuffix(strings.TrimPrefix(e.String(), "["), "]"))
+	}
+	return path
+}
+
+// rvalue returns the value of a literal or of the field referenced by a selector
+func rvalue(rv ast.Rvalue, event Event) interface{} {
+	switch v := rv.(type) {
+	case ast.StringAttribute:
+		return v.Value()
+	case ast.NumberAttribute:
+		return v.Value()
+	case ast.Selector:
+		value, _ := event.get(selectorPath(v))
+		return value
+	case ast.ArrayAttribute:
+		return attributeValue(v)
+	case ast.Regexp:
+		return v.Regexp
+	}
+	return nil
+}
+
+// valuesEqual compares two values as Logstash does, i.e., numbers are compared by value
+// and values of different types are never equal
+func valuesEqual(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func compare(a, b interface{}, op int) bool {
+	switch op {
+	case ast.Equal:
+		return valuesEqual(a, b)
+	case ast.NotEqual:
+		return !valuesEqual(a, b)
+	}
+
+	var c int
+	switch av := a.(type) {
+	case float64:
+		bv, ok := b.(float64)
+		if !ok {
+			return false
+		}
+		switch {
+		case av < bv:
+			c = -1
+		case av > bv:
+			c = 1
+		}
+	case string:
+		bv, ok := b.(string)
+		if !ok {
+			return false
+		}
+		c = strings.Compare(av, bv)
+	default:
+		return false
+	}
+
+	switch op {
+	case ast.LessThan:
+		return c < 0
+	case ast.LessOrEqual:
+		return c <= 0
+	case ast.GreaterThan:
+		return c > 0
+	case ast.GreaterOrEqual:
+		return c >= 0
+	}
+	return false
+}
+
+func contains(container, element interface{}) bool {
+	switch c := container.(type) {
+	case []interface{}:
+		for _, e := range c {
+			if valuesEqual(e, element) {
+				return true
+			}
+		}
+	case string:
+		if s, ok := element.(string); ok {
+			return strings.Contains(c, s)
+		}
+	case map[string]interface{}:
+		if s, ok := element.(string); ok {
+			_, found := c[s]
+			return found
+		}
+	}
+	return false
+}
+
+var regexpCache = map[string]*regexp.Regexp{}
+
+func compileRegexp(expr string) (*regexp.Regexp, error) {
+	if re, ok := regexpCache[expr]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, unsupported("regular expression /%s/ is not supported: %v", expr, err)
+	}
+	regexpCache[expr] = re
+	return re, nil
+}
+
+func evalExpression(expression ast.Expression, event Event) (bool, error) {
+	switch e := expression.(type) {
+	case ast.ConditionExpression:
+		return evalCondition(e.Condition, event)
+	case ast.NegativeConditionExpression:
+		b, err := evalCondition(e.Condition, event)
+		return !b, err
+	case ast.NegativeSelectorExpression:
+		v, _ := event.get(selectorPath(e.Selector))
+		return !truthy(v), nil
+	case ast.RvalueExpression:
+		return truthy(rvalue(e.RValue, event)), nil
+	case ast.CompareExpression:
+		return compare(rvalue(e.LValue, event), rvalue(e.RValue, event), e.CompareOperator.Op), nil
+	case ast.InExpression:
+		return contains(rvalue(e.RValue, event), rvalue(e.LValue, event)), nil
+	case ast.NotInExpression:
+		return !contains(rvalue(e.RValue, event), rvalue(e.LValue, event)), nil
+	case ast.RegexpExpression:
+		var expr string
+		switch r := e.RValue.(type) {
+		case ast.Regexp:
+			expr = r.Regexp
+		case ast.StringAttribute:
+			expr = r.Value()
+		}
+		re, err := compileRegexp(expr)
+		if err != nil {
+			return false, err
+		}
+		s, isString := rvalue(e.LValue, event).(string)
+		matched := isString && re.MatchString(s)
+		if e.RegexpOperator.Op == ast.RegexpNotMatch {
+			return !matched, nil
+		}
+		return matched, nil
+	}
+	return false, unsupported("expression %v is not supported", expression)
+}
+
+// evalCondition evaluates the expressions of a condition, and (and nand) take precedence over or (and xor)
+func evalCondition(condition ast.Condition, event Event) (bool, error) {
+	if len(condition.Expression) == 0 {
+		return false, errors.New("empty condition")
+	}
+
+	// Groups of expressions joined by and/nand, joined in turn by or/xor
+	groups := []bool{}
+	groupOperators := []int{}
+	for i, expression := range condition.Expression {
+		value, err := evalExpression(expression, event)
+		if err != nil {
+			return false, err
+		}
+		op := ast.NoOperator
+		if i > 0 {
+			op = expression.BoolOperator().Op
+		}
+		last := len(groups) - 1
+		switch op {
+		case ast.And:
+			groups[last] = groups[last] && value
+		case ast.Nand:
+			groups[last] = !(groups[last] && value)
+		default:
+			groups = append(groups, value)
+			groupOperators = append(groupOperators, op)
+		}
+	}
+
+	result := groups[0]
+	for i := 1; i < len(groups); i++ {
+		if groupOperators[i] == ast.Xor {
+			result = result != groups[i]
+		} else {
+			result = result || groups[i]
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,303 @@
+// Package evaluate executes the filter section of a Logstash configuration on JSON events.
+// It is used as a reference to compare the behaviour of Logstash with the one of the transpiled Ingest Pipelines.
+package evaluate
+
+import (
+	"fmt"
+	"sort"
+
+	ast "github.com/herrBez/baffo/ast"
+	"github.com/pkg/errors"
+)
+
+// UnsupportedError is returned for plugins, options or expressions the evaluator cannot execute
+type UnsupportedError struct {
+	msg string
+}
+
+func (e UnsupportedError) Error() string {
+	return e.msg
+}
+
+func unsupported(format string, args ...interface{}) error {
+	return UnsupportedError{msg: fmt.Sprintf(format, args...)}
+}
+
+var errDropped = errors.New("event dropped")
+
+// Trace describes a plugin (or a part of it) that could not be evaluated
+type Trace struct {
+	Pos     string `json:"pos"`
+	Plugin  string `json:"plugin"`
+	Message string `json:"message"`
+}
+
+// Result is the outcome of the evaluation of the filters on a single event
+type Result struct {
+	Event   Event   `json:"event,omitempty"`
+	Dropped bool    `json:"dropped,omitempty"`
+	Skipped []Trace `json:"skipped_plugins,omitempty"`
+}
+
+// Evaluator executes the filter section of a Logstash configuration.
+// Plugins and options that are not supported are skipped and reported in the Result.
+type Evaluator struct {
+	filters []ast.PluginSection
+}
+
+func NewEvaluator(config ast.Config) Evaluator {
+	return Evaluator{filters: config.Filter}
+}
+
+// Evaluate runs the filters on a copy of event
+func (ev Evaluator) Evaluate(event Event) Result {
+	e := &evaluation{event: deepCopy(event).(Event)}
+
+	var err error
+	for _, section := range ev.filters {
+		if err = e.run(section.BranchOrPlugins); err != nil {
+			break
+		}
+	}
+
+	result := Result{Skipped: e.skipped}
+	if err == errDropped {
+		result.Dropped = true
+	} else {
+		result.Event = e.event
+	}
+	return result
+}
+
+type evaluation struct {
+	event   Event
+	skipped []Trace
+}
+
+func (e *evaluation) skip(pos ast.Pos, plugin string, err error) {
+	e.skipped = append(e.skipped, Trace{Pos: pos.String(), Plugin: plugin, Message: err.Error()})
+}
+
+func (e *evaluation) run(block []ast.BranchOrPlugin) error {
+	for _, bop := range block {
+		switch b := bop.(type) {
+		case ast.Plugin:
+			if err := e.apply(b); err != nil {
+				return err
+			}
+		case ast.Branch:
+			if err := e.branch(b); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (e *evaluation) branch(b ast.Branch) error {
+	matched, err := evalCondition(b.IfBlock.Condition, e.event)
+	if err != nil {
+		e.skip(b.Pos(), "if", err)
+		return nil
+	}
+	if matched {
+		return e.run(b.IfBlock.Block)
+	}
+	for _, elseIf := range b.ElseIfBlock {
+		matched, err := evalCondition(elseIf.Condition, e.event)
+		if err != nil {
+			e.skip(elseIf.Pos(), "else if", err)
+			return nil
+		}
+		if matched {
+			return e.run(elseIf.Block)
+		}
+	}
+	return e.run(b.ElseBlock.Block)
+}
+
+// A filter returns whether it matched, in which case the common options (add_field, add_tag, ...) are applied
+type filterFunc func(e *evaluation, p plugin) (bool, error)
+
+type filter struct {
+	apply   filterFunc
+	options []string
+}
+
+var commonOptions = []string{"id", "add_field", "add_tag", "remove_field", "remove_tag", "enable_metric", "periodic_flush"}
+
+var filters = map[string]filter{}
+
+func init() {
+	filters["mutate"] = filter{apply: evalMutate, options: append([]string{"tag_on_failure"}, mutateOperations...)}
+	filters["drop"] = filter{apply: evalDrop, options: []string{"percentage"}}
+	filters["kv"] = filter{apply: evalKV, options: kvOptions}
+	filters["dissect"] = filter{apply: evalDissect, options: []string{"mapping", "convert_datatype", "tag_on_failure"}}
+	filters["json"] = filter{apply: evalJSON, options: []string{"source", "target", "skip_on_invalid_json", "tag_on_failure"}}
+	filters["csv"] = filter{apply: evalCSV, options: csvOptions}
+	filters["prune"] = filter{apply: evalPrune, options: []string{"whitelist_names", "blacklist_names", "whitelist_values", "blacklist_values", "interpolate"}}
+}
+
+// plugin gives access to the options of a Logstash plugin as plain values
+type plugin struct {
+	node    ast.Plugin
+	options map[string]interface{}
+}
+
+func newPlugin(p ast.Plugin) plugin {
+	options := map[string]interface{}{}
+	for _, attr := range p.Attributes {
+		if attr == nil {
+			continue
+		}
+		// Options can be repeated (e.g., multiple add_field), the values are merged
+		value := attributeValue(attr)
+		if previous, ok := options[attr.Name()]; ok {
+			value = mergeOptionValues(previous, value)
+		}
+		options[attr.Name()] = value
+	}
+	return plugin{node: p, options: options}
+}
+
+func (p plugin) has(name string) bool {
+	_, ok := p.options[name]
+	return ok
+}
+
+func (p plugin) str(name string, def string) string {
+	if v, ok := p.options[name]; ok {
+		return valueToString(v)
+	}
+	return def
+}
+
+func (p plugin) strings(name string, def []string) []string {
+	if v, ok := p.options[name]; ok {
+		return stringList(v)
+	}
+	return def
+}
+
+func (p plugin) boolean(name string, def bool) bool {
+	if v, ok := p.options[name]; ok {
+		return valueToString(v) == "true"
+	}
+	return def
+}
+
+func (p plugin) hash(name string) []hashEntry {
+	return hashEntries(p.options[name])
+}
+
+func (e *evaluation) apply(node ast.Plugin) error {
+	f, ok := filters[node.Name()]
+	if !ok {
+		e.skip(node.Pos(), node.Name(), unsupported("filter %s is not supported by the evaluator", node.Name()))
+		return nil
+	}
+	p := newPlugin(node)
+
+	unknown := []string{}
+	for name := range p.options {
+		if !contains(toInterfaces(commonOptions), name) && !contains(toInterfaces(f.options), name) {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		e.skip(node.Pos(), node.Name(), unsupported("option %s is not supported by the evaluator", name))
+	}
+
+	matched, err := f.apply(e, p)
+	if err == errDropped {
+		return err
+	}
+	if err != nil {
+		e.skip(node.Pos(), node.Name(), err)
+		return nil
+	}
+	if matched {
+		e.filterMatched(p)
+	}
+	return nil
+}
+
+// filterMatched applies the common options of the filters
+func (e *evaluation) filterMatched(p plugin) {
+	for _, entry := range p.hash("add_field") {
+		field := e.event.Sprintf(entry.key)
+		for _, value := range stringList(entry.value) {
+			e.addValue(field, e.event.Sprintf(value))
+		}
+	}
+	for _, field := range p.strings("remove_field", nil) {
+		e.event.Remove(e.event.Sprintf(field))
+	}
+	for _, tag := range p.strings("add_tag", nil) {
+		e.tag(e.event.Sprintf(tag))
+	}
+	if tags := p.strings("remove_tag", nil); len(tags) > 0 {
+		e.removeTags(tags)
+	}
+}
+
+// addValue sets a field or, if the field already exists, converts it to an array and appends the value
+func (e *evaluation) addValue(field string, value interface{}) {
+	existing, ok := e.event.Get(field)
+	if !ok {
+		_ = e.event.Set(field, value)
+		return
+	}
+	list, isList := existing.([]interface{})
+	if !isList {
+		list = []interface{}{existing}
+	}
+	_ = e.event.Set(field, append(list, value))
+}
+
+func (e *evaluation) tag(tag string) {
+	tags := []interface{}{}
+	switch existing := e.event["tags"].(type) {
+	case []interface{}:
+		tags = existing
+	case nil:
+	default:
+		tags = append(tags, existing)
+	}
+	if contains(tags, tag) {
+		e.event["tags"] = tags
+		return
+	}
+	e.event["tags"] = append(tags, tag)
+}
+
+func (e *evaluation) tagOnFailure(p plugin, def string) {
+	for _, tag := range p.strings("tag_on_failure", []string{def}) {
+		e.tag(tag)
+	}
+}
+
+func (e *evaluation) removeTags(tags []string) {
+	existing, ok := e.event["tags"].([]interface{})
+	if !ok {
+		if s, isString := e.event["tags"].(string); isString {
+			existing = []interface{}{s}
+		} else {
+			return
+		}
+	}
+	kept := []interface{}{}
+	for _, t := range existing {
+		remove := false
+		for _, tag := range tags {
+			if valueToString(t) == e.event.Sprintf(tag) {
+				remove = true
+			}
+		}
+		if !remove {
+			kept = append(kept, t)
+		}
+	}
+	e.event["tags"] = kept
+}
@@ -0,0 +1,143 @@
+package evaluate
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	config "github.com/herrBez/baffo"
+	ast "github.com/herrBez/baffo/ast"
+)
+
+func TestEvaluate(t *testing.T) {
+	tt := []struct {
+		name   string
+		filter string
+		event  string
+		want   string
+	}{
+		{
+			name:   "mutate operations are applied in the Logstash order",
+			filter: `mutate { lowercase => ["b"] rename => { "a" => "b" } add_field => { "c" => "%{b}" } add_tag => ["t"] }`,
+			event:  `{"a": "X"}`,
+			want:   `{"event": {"b": "x", "c": "x", "tags": ["t"]}}`,
+		},
+		{
+			name:   "add_field on an existing field creates an array",
+			filter: `mutate { add_field => { "a" => "y" "missing" => "%{[nope]}" } }`,
+			event:  `{"a": "x"}`,
+			want:   `{"event": {"a": ["x", "y"], "missing": "%{[nope]}"}}`,
+		},
+		{
+			name:   "mutate convert, gsub, split, join, merge and copy",
+			filter: `mutate { convert => { "n" => "integer" "b" => "boolean" } gsub => ["g", "(\d+)", "<\1>"] split => { "s" => "," } join => { "j" => "-" } merge => { "m" => "s" } copy => { "n" => "[c][n]" } }`,
+			event:  `{"n": "12.5", "b": "yes", "g": "a1b22", "s": "x,y", "j": ["u", "v"], "m": "w"}`,
+			want:   `{"event": {"n": 12, "b": true, "g": "a<1>b<22>", "s": ["x", "y"], "j": "u-v", "m": ["w", "x", "y"], "c": {"n": 12}}}`,
+		},
+		{
+			name:   "merge into a missing field and of a missing field creates arrays",
+			filter: `mutate { convert => { "b" => "boolean" } merge => { "d" => "s" "e" => "missing" } }`,
+			event:  `{"b": "", "s": "hello", "e": "x"}`,
+			want:   `{"event": {"b": false, "s": "hello", "d": ["hello"], "e": ["x"]}}`,
+		},
+		{
+			name:   "conditions",
+			filter: `if [a] == 1 and ([b] =~ /^x/ or "y" in [c]) { mutate { add_tag => ["if"] } } else if ![d] { mutate { add_tag => ["elif"] } } else { mutate { add_tag => ["else"] } }`,
+			event:  `{"a": 1, "b": "z", "c": ["y"]}`,
+			want:   `{"event": {"a": 1, "b": "z", "c": ["y"], "tags": ["if"]}}`,
+		},
+		{
+			name:   "and takes precedence over or",
+			filter: `if [a] or [b] and [c] { mutate { add_tag => ["if"] } } else { mutate { add_tag => ["else"] } }`,
+			event:  `{"a": true, "b": false}`,
+			want:   `{"event": {"a": true, "b": false, "tags": ["if"]}}`,
+		},
+		{
+			name:   "drop",
+			filter: `if [a] != "keep" { drop {} }`,
+			event:  `{"a": "x"}`,
+			want:   `{"dropped": true}`,
+		},
+		{
+			name:   "kv",
+			filter: `kv { source => "m" target => "kv" exclude_keys => ["c"] trim_value => "," }`,
+			event:  `{"m": "a=1, b=\"x y\" c=3 a=4"}`,
+			want:   `{"event": {"m": "a=1, b=\"x y\" c=3 a=4", "kv": {"a": ["1", "4"], "b": "x y"}}}`,
+		},
+		{
+			name:   "dissect",
+			filter: `dissect { mapping => { "message" => "%{ts} %{+ts} [%{[log][level]}] %{msg}" } convert_datatype => { "msg" => "int" } }`,
+			event:  `{"message": "2024-01-01 10:00:00 [INFO] 42"}`,
+			want:   `{"event": {"message": "2024-01-01 10:00:00 [INFO] 42", "ts": "2024-01-01 10:00:00", "log": {"level": "INFO"}, "msg": 42}}`,
+		},
+		{
+			name:   "dissect failure",
+			filter: `dissect { mapping => { "message" => "%{a}|%{b}" } add_tag => ["ok"] }`,
+			event:  `{"message": "no pipe"}`,
+			want:   `{"event": {"message": "no pipe", "tags": ["_dissectfailure"]}}`,
+		},
+		{
+			name:   "json and csv",
+			filter: `json { source => "j" } csv { source => "c" columns => ["x", "y"] }`,
+			event:  `{"j": "{\"k\": 1}", "c": "1,\"a,b\",z"}`,
+			want:   `{"event": {"j": "{\"k\": 1}", "c": "1,\"a,b\",z", "k": 1, "x": "1", "y": "a,b", "column3": "z"}}`,
+		},
+		{
+			name:   "json failure",
+			filter: `json { source => "j" target => "t" }`,
+			event:  `{"j": "{"}`,
+			want:   `{"event": {"j": "{", "tags": ["_jsonparsefailure"]}}`,
+		},
+		{
+			name:   "prune",
+			filter: `prune { whitelist_names => ["^a", "^b$"] }`,
+			event:  `{"a1": 1, "b": 2, "bb": 3, "@metadata": {"x": 1}}`,
+			want:   `{"event": {"a1": 1, "b": 2, "@metadata": {"x": 1}}}`,
+		},
+		{
+			name:   "unsupported plugins are skipped",
+			filter: `grok { match => { "message" => "%{WORD:w}" } }`,
+			event:  `{"message": "x"}`,
+			want:   `{"event": {"message": "x"}, "skipped_plugins": [{"pos": "1:10 [9]", "plugin": "grok", "message": "filter grok is not supported by the evaluator"}]}`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := config.Parse("test", []byte("filter { "+tc.filter+" }"))
+			if err != nil {
+				t.Fatalf("could not parse the filter: %v", err)
+			}
+			var event Event
+			if err := json.Unmarshal([]byte(tc.event), &event); err != nil {
+				t.Fatal(err)
+			}
+
+			result := NewEvaluator(res.(ast.Config)).Evaluate(event)
+
+			got, _ := json.Marshal(result)
+			var gotValue, wantValue interface{}
+			_ = json.Unmarshal(got, &gotValue)
+			if err := json.Unmarshal([]byte(tc.want), &wantValue); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotValue, wantValue) {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFieldPath(t *testing.T) {
+	tt := map[string][]string{
+		"foo":            {"foo"},
+		"[foo]":          {"foo"},
+		"[foo][bar]":     {"foo", "bar"},
+		"[@metadata][x]": {"@metadata", "x"},
+	}
+	for reference, want := range tt {
+		if got := FieldPath(reference); !reflect.DeepEqual(got, want) {
+			t.Errorf("FieldPath(%q) = %v, want %v", reference, got, want)
+		}
+	}
+}
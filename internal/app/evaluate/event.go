@@ -0,0 +1,204 @@
+package evaluate
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Event is a Logstash event
+type Event map[string]interface{}
+
+var fieldReferenceElement = regexp.MustCompile(`\[([^\[\]]+)\]`)
+
+// FieldPath converts a Logstash field reference (e.g., [foo][bar] or foo) into its path
+func FieldPath(reference string) []string {
+	reference = strings.TrimSpace(reference)
+	if !strings.HasPrefix(reference, "[") {
+		return []string{reference}
+	}
+	path := []string{}
+	for _, m := range fieldReferenceElement.FindAllStringSubmatch(reference, -1) {
+		path = append(path, m[1])
+	}
+	return path
+}
+
+func (e Event) get(path []string) (interface{}, bool) {
+	var current interface{} = map[string]interface{}(e)
+	for _, part := range path {
+		switch c := current.(type) {
+		case map[string]interface{}:
+			v, ok := c[part]
+			if !ok {
+				return nil, false
+			}
+			current = v
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, false
+			}
+			// Negative indexes count from the end as in Ruby
+			if i < 0 {
+				i += len(c)
+			}
+			if i < 0 || i >= len(c) {
+				return nil, false
+			}
+			current = c[i]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// Get returns the value of a field reference
+func (e Event) Get(reference string) (interface{}, bool) {
+	return e.get(FieldPath(reference))
+}
+
+func (e Event) set(path []string, value interface{}) error {
+	var current interface{} = map[string]interface{}(e)
+	for i, part := range path {
+		last := i == len(path)-1
+		switch c := current.(type) {
+		case map[string]interface{}:
+			if last {
+				c[part] = value
+				return nil
+			}
+			next, ok := c[part]
+			if !ok || next == nil {
+				next = map[string]interface{}{}
+				c[part] = next
+			}
+			current = next
+		case []interface{}:
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= len(c) {
+				return errors.Errorf("could not set field [%s]: index %s out of bounds", strings.Join(path, "]["), part)
+			}
+			if last {
+				c[idx] = value
+				return nil
+			}
+			current = c[idx]
+		default:
+			return errors.Errorf("could not set field [%s]: parent is not a hash", strings.Join(path, "]["))
+		}
+	}
+	return nil
+}
+
+// Set sets the value of a field reference, creating the missing intermediate hashes
+func (e Event) Set(reference string, value interface{}) error {
+	return e.set(FieldPath(reference), value)
+}
+
+func (e Event) remove(path []string) {
+	parent, ok := e.get(path[:len(path)-1])
+	if !ok {
+		return
+	}
+	leaf := path[len(path)-1]
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		delete(p, leaf)
+	case []interface{}:
+		idx, err := strconv.Atoi(leaf)
+		if err != nil || idx < 0 || idx >= len(p) {
+			return
+		}
+		_ = e.set(path[:len(path)-1], append(append([]interface{}{}, p[:idx]...), p[idx+1:]...))
+	}
+}
+
+// Remove removes a field reference, missing fields are ignored
+func (e Event) Remove(reference string) {
+	e.remove(FieldPath(reference))
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch tv := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(tv))
+		for k, e := range tv {
+			m[k] = deepCopy(e)
+		}
+		return m
+	case Event:
+		return Event(deepCopy(map[string]interface{}(tv)).(map[string]interface{}))
+	case []interface{}:
+		l := make([]interface{}, len(tv))
+		for i, e := range tv {
+			l[i] = deepCopy(e)
+		}
+		return l
+	default:
+		return v
+	}
+}
+
+// valueToString renders a value as done by the sprintf format of Logstash
+func valueToString(v interface{}) string {
+	switch tv := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return tv
+	case float64:
+		if tv == math.Trunc(tv) && math.Abs(tv) < 1e15 {
+			return strconv.FormatInt(int64(tv), 10)
+		}
+		return strconv.FormatFloat(tv, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(tv)
+	case []interface{}:
+		parts := make([]string, len(tv))
+		for i := range tv {
+			parts[i] = valueToString(tv[i])
+		}
+		return strings.Join(parts, ",")
+	case map[string]interface{}:
+		buf, _ := json.Marshal(tv)
+		return string(buf)
+	default:
+		return fmt.Sprintf("%v", tv)
+	}
+}
+
+var sprintfFinder = regexp.MustCompile(`%\{([^}]+)\}`)
+
+// Sprintf replaces the field references %{[foo][bar]} with the values of the event.
+// References to missing fields are kept as they are, as done by Logstash.
+func (e Event) Sprintf(s string) string {
+	return sprintfFinder.ReplaceAllStringFunc(s, func(m string) string {
+		reference := sprintfFinder.FindStringSubmatch(m)[1]
+		if strings.HasPrefix(reference, "+") {
+			return m
+		}
+		v, ok := e.Get(reference)
+		if !ok || v == nil {
+			return m
+		}
+		return valueToString(v)
+	})
+}
+
+// truthy implements the truthiness of Ruby: everything except nil and false is true
+func truthy(v interface{}) bool {
+	if v == nil {
+		return false
+	}
+	if b, ok := v.(bool); ok {
+		return b
+	}
+	return true
+}
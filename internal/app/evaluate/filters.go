@@ -0,0 +1,681 @@
+package evaluate
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+
+	"github.com/herrBez/baffo/internal/csvline"
+	"github.com/herrBez/baffo/internal/dissect"
+)
+
+// The operations of the mutate filter, in the order they are applied by Logstash
+var mutateOperations = []string{"coerce", "rename", "update", "replace", "convert", "gsub", "uppercase", "capitalize", "lowercase", "strip", "split", "join", "merge", "copy"}
+
+var (
+	rubyIntegerPrefix = regexp.MustCompile(`^\s*[+-]?\d+`)
+	rubyFloatPrefix   = regexp.MustCompile(`^\s*[+-]?\d+(\.\d+)?([eE][+-]?\d+)?`)
+	rubyBackReference = regexp.MustCompile(`\\(\d)`)
+)
+
+// rubyToI and rubyToF parse the numeric prefix of a string as done by Ruby's to_i and to_f
+func rubyToI(s string) float64 {
+	n, _ := strconv.ParseFloat(strings.TrimSpace(rubyIntegerPrefix.FindString(s)), 64)
+	return n
+}
+
+func rubyToF(s string) float64 {
+	f, _ := strconv.ParseFloat(strings.TrimSpace(rubyFloatPrefix.FindString(s)), 64)
+	return f
+}
+
+func convertValue(v interface{}, convertType string) (interface{}, error) {
+	switch convertType {
+	case "integer", "integer_eu", "float", "float_eu":
+		var f float64
+		switch tv := v.(type) {
+		case bool:
+			if tv {
+				f = 1
+			}
+		case float64:
+			f = tv
+		default:
+			s := valueToString(v)
+			if strings.HasSuffix(convertType, "_eu") {
+				s = strings.ReplaceAll(strings.ReplaceAll(s, ".", ""), ",", ".")
+			}
+			if strings.HasPrefix(convertType, "integer") {
+				f = rubyToI(s)
+			} else {
+				f = rubyToF(s)
+			}
+		}
+		if strings.HasPrefix(convertType, "integer") {
+			f = float64(int64(f))
+		}
+		return f, nil
+	case "string":
+		return valueToString(v), nil
+	case "boolean":
+		switch strings.ToLower(valueToString(v)) {
+		case "true", "t", "yes", "y", "1", "1.0":
+			return true, nil
+		case "", "false", "f", "no", "n", "0", "0.0":
+			return false, nil
+		}
+		return v, nil
+	}
+	return nil, unsupported("conversion to %s is not supported", convertType)
+}
+
+func capitalize(s string) string {
+	r := []rune(strings.ToLower(s))
+	if len(r) > 0 {
+		r[0] = unicode.ToUpper(r[0])
+	}
+	return string(r)
+}
+
+// mapStrings applies f to a string or to all the strings of a list
+func mapStrings(v interface{}, f func(string) string) interface{} {
+	switch tv := v.(type) {
+	case string:
+		return f(tv)
+	case []interface{}:
+		l := make([]interface{}, len(tv))
+		for i, elem := range tv {
+			if s, ok := elem.(string); ok {
+				l[i] = f(s)
+			} else {
+				l[i] = elem
+			}
+		}
+		return l
+	}
+	return v
+}
+
+func (e *evaluation) mapField(field string, f func(string) string) {
+	if v, ok := e.event.Get(field); ok && v != nil {
+		_ = e.event.Set(field, mapStrings(v, f))
+	}
+}
+
+func evalMutate(e *evaluation, p plugin) (bool, error) {
+	event := e.event
+	for _, operation := range mutateOperations {
+		if !p.has(operation) {
+			continue
+		}
+		switch operation {
+		case "coerce":
+			for _, entry := range p.hash(operation) {
+				if v, ok := event.Get(entry.key); ok && v == nil {
+					_ = event.Set(entry.key, event.Sprintf(valueToString(entry.value)))
+				}
+			}
+		case "rename":
+			for _, entry := range p.hash(operation) {
+				source := event.Sprintf(entry.key)
+				if v, ok := event.Get(source); ok {
+					event.Remove(source)
+					_ = event.Set(event.Sprintf(valueToString(entry.value)), v)
+				}
+			}
+		case "update", "replace":
+			for _, entry := range p.hash(operation) {
+				field := event.Sprintf(entry.key)
+				if _, ok := event.Get(field); !ok && operation == "update" {
+					continue
+				}
+				value := entry.value
+				if s, ok := value.(string); ok {
+					value = event.Sprintf(s)
+				}
+				_ = event.Set(field, value)
+			}
+		case "convert":
+			for _, entry := range p.hash(operation) {
+				v, ok := event.Get(entry.key)
+				if !ok || v == nil {
+					continue
+				}
+				var converted interface{}
+				var err error
+				if l, isList := v.([]interface{}); isList {
+					list := make([]interface{}, len(l))
+					for i := range l {
+						if list[i], err = convertValue(l[i], valueToString(entry.value)); err != nil {
+							return false, err
+						}
+					}
+					converted = list
+				} else if converted, err = convertValue(v, valueToString(entry.value)); err != nil {
+					return false, err
+				}
+				_ = event.Set(entry.key, converted)
+			}
+		case "gsub":
+			settings := stringList(p.options[operation])
+			for i := 0; i+2 < len(settings); i += 3 {
+				re, err := compileRegexp(settings[i+1])
+				if err != nil {
+					return false, err
+				}
+				replacement := rubyBackReference.ReplaceAllString(strings.ReplaceAll(settings[i+2], "$", "$$"), "$${$1}")
+				e.mapField(settings[i], func(s string) string {
+					return re.ReplaceAllString(s, replacement)
+				})
+			}
+		case "uppercase":
+			for _, field := range p.strings(operation, nil) {
+				e.mapField(field, strings.ToUpper)
+			}
+		case "capitalize":
+			for _, field := range p.strings(operation, nil) {
+				e.mapField(field, capitalize)
+			}
+		case "lowercase":
+			for _, field := range p.strings(operation, nil) {
+				e.mapField(field, strings.ToLower)
+			}
+		case "strip":
+			for _, field := range p.strings(operation, nil) {
+				e.mapField(field, strings.TrimSpace)
+			}
+		case "split":
+			for _, entry := range p.hash(operation) {
+				s, ok := event.Get(entry.key)
+				str, isString := s.(string)
+				if !ok || !isString {
+					continue
+				}
+				separator := valueToString(entry.value)
+				var parts []string
+				if separator == " " {
+					parts = strings.Fields(str)
+				} else {
+					parts = strings.Split(str, separator)
+					for len(parts) > 0 && parts[len(parts)-1] == "" {
+						parts = parts[:len(parts)-1]
+					}
+				}
+				_ = event.Set(entry.key, toInterfaces(parts))
+			}
+		case "join":
+			for _, entry := range p.hash(operation) {
+				v, _ := event.Get(entry.key)
+				if l, isList := v.([]interface{}); isList {
+					parts := make([]string, len(l))
+					for i := range l {
+						parts[i] = valueToString(l[i])
+					}
+					_ = event.Set(entry.key, strings.Join(parts, valueToString(entry.value)))
+				}
+			}
+		case "merge":
+			for _, entry := range p.hash(operation) {
+				for _, source := range stringList(entry.value) {
+					e.merge(entry.key, source)
+				}
+			}
+		case "copy":
+			for _, entry := range p.hash(operation) {
+				if v, ok := event.Get(entry.key); ok {
+					_ = event.Set(valueToString(entry.value), deepCopy(v))
+				}
+			}
+		}
+	}
+	return true, nil
+}
+
+func (e *evaluation) merge(destination, source string) {
+	sourceValue, _ := e.event.Get(source)
+	destinationValue, _ := e.event.Get(destination)
+
+	dm, destinationIsHash := destinationValue.(map[string]interface{})
+	sm, sourceIsHash := sourceValue.(map[string]interface{})
+	switch {
+	case destinationIsHash != sourceIsHash:
+		// Logstash logs an error and leaves the event untouched
+	case destinationIsHash:
+		for k, v := range sm {
+			dm[k] = deepCopy(v)
+		}
+	default:
+		// Array(dest).concat(Array(added)), a missing field is an empty array
+		_ = e.event.Set(destination, append(rubyArray(destinationValue), rubyArray(deepCopy(sourceValue))...))
+	}
+}
+
+func evalDrop(e *evaluation, p plugin) (bool, error) {
+	if p.has("percentage") && p.str("percentage", "100") != "100" {
+		return false, unsupported("drop with percentage is not supported")
+	}
+	return false, errDropped
+}
+
+var kvOptions = []string{
+	"source", "target", "field_split", "value_split", "field_split_pattern", "value_split_pattern", "prefix",
+	"include_keys", "exclude_keys", "trim_key", "trim_value", "remove_char_key", "remove_char_value",
+	"transform_key", "transform_value", "allow_duplicate_values", "include_brackets", "recursive", "default_keys",
+	"tag_on_failure", "tag_on_timeout", "timeout_millis", "whitespace", "allow_empty_values",
+}
+
+// unescapeCharacters removes the backslashes used to escape the characters of trim_key, remove_char_key, ...
+func unescapeCharacters(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func transform(s string, how string) string {
+	switch how {
+	case "lowercase":
+		return strings.ToLower(s)
+	case "uppercase":
+		return strings.ToUpper(s)
+	case "capitalize":
+		return capitalize(s)
+	}
+	return s
+}
+
+var kvQuotes = [][2]string{{`"`, `"`}, {"'", "'"}}
+var kvBrackets = [][2]string{{"[", "]"}, {"(", ")"}, {"<", ">"}}
+
+// kvPairs splits the text into key value pairs
+func kvPairs(p plugin, text string) ([][2]string, error) {
+	pairs := [][2]string{}
+	includeBrackets := p.boolean("include_brackets", true)
+
+	if p.has("field_split_pattern") || p.has("value_split_pattern") {
+		fieldSplit := "[" + characterClass(p.str("field_split", " ")) + "]"
+		if p.has("field_split_pattern") {
+			fieldSplit = p.str("field_split_pattern", "")
+		}
+		valueSplit := "[" + characterClass(p.str("value_split", "=")) + "]"
+		if p.has("value_split_pattern") {
+			valueSplit = p.str("value_split_pattern", "")
+		}
+		fs, err := compileRegexp(fieldSplit)
+		if err != nil {
+			return nil, err
+		}
+		vs, err := compileRegexp(valueSplit)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range fs.Split(text, -1) {
+			kv := vs.Split(field, 2)
+			if len(kv) == 2 {
+				pairs = append(pairs, [2]string{kv[0], stripQuotes(kv[1], includeBrackets)})
+			}
+		}
+		return pairs, nil
+	}
+
+	fs := characterClass(p.str("field_split", " "))
+	vs := characterClass(p.str("value_split", "="))
+	values := []string{`"([^"]*)"`, `'([^']*)'`}
+	if includeBrackets {
+		values = append(values, `\[([^\]]*)\]`, `\(([^)]*)\)`, `<([^>]*)>`)
+	}
+	values = append(values, `([^`+fs+`]*)`)
+	re, err := compileRegexp(`(?:"([^"]+)"|'([^']+)'|([^` + fs + vs + `]+))[` + vs + `](?:` + strings.Join(values, "|") + `)`)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range re.FindAllStringSubmatch(text, -1) {
+		key := m[1] + m[2] + m[3]
+		value := strings.Join(m[4:], "")
+		pairs = append(pairs, [2]string{key, value})
+	}
+	return pairs, nil
+}
+
+// characterClass escapes the characters of field_split and value_split to be used within [...]
+func characterClass(chars string) string {
+	return strings.ReplaceAll(regexp.QuoteMeta(unescapeCharacters(chars)), "-", `\-`)
+}
+
+func stripQuotes(s string, includeBrackets bool) string {
+	delimiters := kvQuotes
+	if includeBrackets {
+		delimiters = append(delimiters, kvBrackets...)
+	}
+	for _, d := range delimiters {
+		if len(s) >= 2 && strings.HasPrefix(s, d[0]) && strings.HasSuffix(s, d[1]) {
+			return s[1 : len(s)-1]
+		}
+	}
+	return s
+}
+
+func evalKV(e *evaluation, p plugin) (bool, error) {
+	if p.boolean("recursive", false) {
+		return false, unsupported("kv with recursive => true is not supported")
+	}
+	source, ok := e.event.Get(p.str("source", "message"))
+	if !ok || source == nil {
+		return false, nil
+	}
+
+	texts := []string{}
+	switch tv := source.(type) {
+	case string:
+		texts = append(texts, tv)
+	case []interface{}:
+		for _, elem := range tv {
+			if s, isString := elem.(string); isString {
+				texts = append(texts, s)
+			}
+		}
+	default:
+		return false, nil
+	}
+
+	includeKeys := toInterfaces(p.strings("include_keys", nil))
+	excludeKeys := toInterfaces(p.strings("exclude_keys", nil))
+	allowDuplicates := p.boolean("allow_duplicate_values", true)
+	prefix := e.event.Sprintf(p.str("prefix", ""))
+
+	kv := map[string]interface{}{}
+	keys := []string{}
+	for _, text := range texts {
+		pairs, err := kvPairs(p, text)
+		if err != nil {
+			return false, err
+		}
+		for _, pair := range pairs {
+			key, value := pair[0], pair[1]
+			if p.has("trim_key") {
+				key = strings.Trim(key, unescapeCharacters(p.str("trim_key", "")))
+			}
+			if p.has("remove_char_key") {
+				key = strings.NewReplacer(removeCharPairs(unescapeCharacters(p.str("remove_char_key", "")))...).Replace(key)
+			}
+			key = transform(key, p.str("transform_key", ""))
+			if p.has("trim_value") {
+				value = strings.Trim(value, unescapeCharacters(p.str("trim_value", "")))
+			}
+			if p.has("remove_char_value") {
+				value = strings.NewReplacer(removeCharPairs(unescapeCharacters(p.str("remove_char_value", "")))...).Replace(value)
+			}
+			value = transform(value, p.str("transform_value", ""))
+
+			if key == "" || value == "" && !p.boolean("allow_empty_values", false) {
+				continue
+			}
+			if len(includeKeys) > 0 && !contains(includeKeys, key) || contains(excludeKeys, key) {
+				continue
+			}
+			key = prefix + key
+
+			existing, found := kv[key]
+			switch {
+			case !found:
+				kv[key] = value
+				keys = append(keys, key)
+			case !allowDuplicates && contains(toList(existing), value):
+			default:
+				kv[key] = append(toList(existing), value)
+			}
+		}
+	}
+
+	for _, entry := range p.hash("default_keys") {
+		if _, found := kv[entry.key]; !found {
+			kv[entry.key] = entry.value
+			keys = append(keys, entry.key)
+		}
+	}
+	if len(kv) == 0 {
+		return false, nil
+	}
+
+	if p.has("target") {
+		_ = e.event.Set(p.str("target", ""), kv)
+	} else {
+		for _, k := range keys {
+			_ = e.event.Set(k, kv[k])
+		}
+	}
+	return true, nil
+}
+
+func removeCharPairs(chars string) []string {
+	pairs := []string{}
+	for _, c := range chars {
+		pairs = append(pairs, string(c), "")
+	}
+	return pairs
+}
+
+func evalDissect(e *evaluation, p plugin) (bool, error) {
+	for _, entry := range p.hash("mapping") {
+		source, ok := e.event.Get(entry.key)
+		s, isString := source.(string)
+		if !ok || !isString {
+			e.tagOnFailure(p, "_dissectfailure")
+			return false, nil
+		}
+		d, err := dissect.New(valueToString(entry.value))
+		if err != nil {
+			return false, err
+		}
+		// Logstash joins the appended values with a space
+		fields, err := d.Dissect(s, " ")
+		if err != nil {
+			e.tagOnFailure(p, "_dissectfailure")
+			return false, nil
+		}
+		for k, v := range fields {
+			_ = e.event.Set(k, v)
+		}
+	}
+
+	for _, entry := range p.hash("convert_datatype") {
+		v, ok := e.event.Get(entry.key)
+		if !ok {
+			continue
+		}
+		switch valueToString(entry.value) {
+		case "int":
+			_ = e.event.Set(entry.key, float64(int64(rubyToI(valueToString(v)))))
+		case "float":
+			_ = e.event.Set(entry.key, rubyToF(valueToString(v)))
+		}
+	}
+	return true, nil
+}
+
+func evalJSON(e *evaluation, p plugin) (bool, error) {
+	source, ok := e.event.Get(p.str("source", ""))
+	if !ok || source == nil {
+		return false, nil
+	}
+	s, isString := source.(string)
+	if !isString {
+		e.tagOnFailure(p, "_jsonparsefailure")
+		return false, nil
+	}
+
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(s), &parsed); err != nil {
+		if !p.boolean("skip_on_invalid_json", false) {
+			e.tagOnFailure(p, "_jsonparsefailure")
+		}
+		return false, nil
+	}
+
+	if p.has("target") {
+		_ = e.event.Set(p.str("target", ""), parsed)
+		return true, nil
+	}
+	m, isHash := parsed.(map[string]interface{})
+	if !isHash {
+		// Parsed JSON object/hash requires a target configuration option
+		e.tagOnFailure(p, "_jsonparsefailure")
+		return false, nil
+	}
+	for k, v := range m {
+		e.event[k] = v
+	}
+	return true, nil
+}
+
+var csvOptions = []string{
+	"source", "target", "columns", "separator", "quote_char", "skip_empty_columns", "skip_empty_rows",
+	"skip_header", "autogenerate_column_names", "convert", "autodetect_column_names",
+}
+
+func evalCSV(e *evaluation, p plugin) (bool, error) {
+	if p.boolean("autodetect_column_names", false) {
+		return false, unsupported("csv with autodetect_column_names => true is not supported")
+	}
+	source, ok := e.event.Get(p.str("source", "message"))
+	s, isString := source.(string)
+	if !ok || !isString {
+		return false, nil
+	}
+
+	separator := []rune(p.str("separator", ","))
+	quote := []rune(p.str("quote_char", `"`))
+	if len(separator) != 1 || len(quote) != 1 {
+		return false, unsupported("csv with multi-character separator or quote_char is not supported")
+	}
+	fields, err := csvline.Split(s, separator[0], quote[0])
+	if err != nil {
+		e.tag("_csvparsefailure")
+		return false, nil
+	}
+	if p.boolean("skip_empty_rows", false) && strings.TrimSpace(s) == "" {
+		return false, nil
+	}
+
+	columns := p.strings("columns", nil)
+	for i, value := range fields {
+		var name string
+		switch {
+		case i < len(columns):
+			name = columns[i]
+		case p.boolean("autogenerate_column_names", true):
+			name = "column" + strconv.Itoa(i+1)
+		default:
+			continue
+		}
+		if value == "" && p.boolean("skip_empty_columns", false) {
+			continue
+		}
+
+		var v interface{}
+		if value != "" {
+			v = value
+		}
+		for _, entry := range p.hash("convert") {
+			if entry.key == name && v != nil {
+				convertType := valueToString(entry.value)
+				if convertType == "date" || convertType == "date_time" {
+					return false, unsupported("csv conversion to %s is not supported", convertType)
+				}
+				if v, err = convertValue(value, convertType); err != nil {
+					return false, err
+				}
+			}
+		}
+
+		field := name
+		if p.has("target") {
+			field = "[" + strings.Join(FieldPath(p.str("target", "")), "][") + "][" + name + "]"
+		}
+		if err := e.event.Set(field, v); err != nil {
+			return false, errors.Wrap(err, "csv")
+		}
+	}
+	return true, nil
+}
+
+func evalPrune(e *evaluation, p plugin) (bool, error) {
+	interpolate := p.boolean("interpolate", false)
+	patterns := func(name string, def []string) ([]*regexp.Regexp, error) {
+		res := []*regexp.Regexp{}
+		for _, s := range p.strings(name, def) {
+			if interpolate {
+				s = e.event.Sprintf(s)
+			}
+			re, err := compileRegexp(s)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, re)
+		}
+		return res, nil
+	}
+	matchesAny := func(res []*regexp.Regexp, s string) bool {
+		for _, re := range res {
+			if re.MatchString(s) {
+				return true
+			}
+		}
+		return false
+	}
+
+	whitelist, err := patterns("whitelist_names", nil)
+	if err != nil {
+		return false, err
+	}
+	blacklist, err := patterns("blacklist_names", []string{`%\{[^}]+\}`})
+	if err != nil {
+		return false, err
+	}
+
+	for name := range e.event {
+		if name == "@metadata" {
+			continue
+		}
+		if len(whitelist) > 0 && !matchesAny(whitelist, name) || matchesAny(blacklist, name) {
+			delete(e.event, name)
+		}
+	}
+
+	for _, option := range []string{"whitelist_values", "blacklist_values"} {
+		keep := option == "whitelist_values"
+		for _, entry := range p.hash(option) {
+			v, ok := e.event[entry.key]
+			if !ok {
+				continue
+			}
+			re, err := compileRegexp(valueToString(entry.value))
+			if err != nil {
+				return false, err
+			}
+			switch tv := v.(type) {
+			case string:
+				if re.MatchString(tv) != keep {
+					delete(e.event, entry.key)
+				}
+			case []interface{}:
+				kept := []interface{}{}
+				for _, elem := range tv {
+					if re.MatchString(valueToString(elem)) == keep {
+						kept = append(kept, elem)
+					}
+				}
+				e.event[entry.key] = kept
+			}
+		}
+	}
+	return true, nil
+}
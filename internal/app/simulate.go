@@ -0,0 +1,28 @@
+package app
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/herrBez/baffo/internal/app/simulate"
+)
+
+func makeSimulateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:           "simulate [pipeline.json ...]",
+		Short:         "execute Ingest Pipelines on sample documents without Elasticsearch",
+		RunE:          runSimulate,
+		SilenceErrors: true,
+	}
+
+	cmd.Flags().String("docs", "", "file with the documents to simulate, one JSON document per line")
+	cmd.Flags().String("pipeline", "", "name of the pipeline to execute, defaults to the first (main) pipeline of the file")
+
+	return cmd
+}
+
+func runSimulate(cmd *cobra.Command, args []string) error {
+	docs, _ := cmd.Flags().GetString("docs")
+	pipeline, _ := cmd.Flags().GetString("pipeline")
+	simulate := simulate.New(docs, pipeline)
+	return simulate.Run(args)
+}
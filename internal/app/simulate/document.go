@@ -0,0 +1,246 @@
+package simulate
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Document is an Ingest Document: the source of the event together with the metadata fields
+// (e.g., _index, _id) as exposed to the processors by Elasticsearch
+type Document map[string]interface{}
+
+// Metadata fields are not part of the _source of the document
+var MetadataFields = []string{"_index", "_id", "_routing", "_version", "_version_type", "_if_seq_no", "_if_primary_term", "_dynamic_templates"}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "_source."), ".")
+}
+
+// getField returns the value at the dotted path (e.g., foo.bar or foo.0.bar for lists)
+func getField(doc map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = doc
+	for _, part := range splitPath(path) {
+		switch c := current.(type) {
+		case map[string]interface{}:
+			v, ok := c[part]
+			if !ok {
+				return nil, false
+			}
+			current = v
+		case Document:
+			v, ok := c[part]
+			if !ok {
+				return nil, false
+			}
+			current = v
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil, false
+			}
+			current = c[i]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func hasField(doc map[string]interface{}, path string) bool {
+	_, ok := getField(doc, path)
+	return ok
+}
+
+// setField sets the value at the dotted path, creating the missing intermediate objects
+func setField(doc map[string]interface{}, path string, value interface{}) error {
+	parts := splitPath(path)
+	var current interface{} = doc
+	for i, part := range parts {
+		last := i == len(parts)-1
+		switch c := current.(type) {
+		case map[string]interface{}:
+			if last {
+				c[part] = value
+				return nil
+			}
+			next, ok := c[part]
+			if !ok || next == nil {
+				next = map[string]interface{}{}
+				c[part] = next
+			}
+			current = next
+		case []interface{}:
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= len(c) {
+				return errors.Errorf("[%s] is out of bounds for array with length [%d] as part of path [%s]", part, len(c), path)
+			}
+			if last {
+				c[idx] = value
+				return nil
+			}
+			current = c[idx]
+		default:
+			return errors.Errorf("cannot set [%s] with parent object of type [%s] as part of path [%s]", part, typeName(current), path)
+		}
+	}
+	return nil
+}
+
+// removeField removes the value at the dotted path
+func removeField(doc map[string]interface{}, path string) error {
+	parts := splitPath(path)
+	parentPath := strings.Join(parts[:len(parts)-1], ".")
+	var parent interface{} = doc
+	if parentPath != "" {
+		var ok bool
+		parent, ok = getField(doc, parentPath)
+		if !ok {
+			return errors.Errorf("field [%s] not present as part of path [%s]", parts[len(parts)-2], path)
+		}
+	}
+	leaf := parts[len(parts)-1]
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := p[leaf]; !ok {
+			return errors.Errorf("field [%s] not present as part of path [%s]", leaf, path)
+		}
+		delete(p, leaf)
+	case []interface{}:
+		idx, err := strconv.Atoi(leaf)
+		if err != nil || idx < 0 || idx >= len(p) {
+			return errors.Errorf("[%s] is out of bounds for array with length [%d] as part of path [%s]", leaf, len(p), path)
+		}
+		return setField(doc, parentPath, append(append([]interface{}{}, p[:idx]...), p[idx+1:]...))
+	default:
+		return errors.Errorf("field [%s] not present as part of path [%s]", leaf, path)
+	}
+	return nil
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch tv := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(tv))
+		for k, e := range tv {
+			m[k] = deepCopy(e)
+		}
+		return m
+	case Document:
+		return Document(deepCopy(map[string]interface{}(tv)).(map[string]interface{}))
+	case []interface{}:
+		l := make([]interface{}, len(tv))
+		for i, e := range tv {
+			l[i] = deepCopy(e)
+		}
+		return l
+	case []string:
+		l := make([]interface{}, len(tv))
+		for i, e := range tv {
+			l[i] = e
+		}
+		return l
+	default:
+		return v
+	}
+}
+
+// Java-like type names used in the error messages
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "java.lang.String"
+	case float64, int, int64:
+		return "java.lang.Number"
+	case bool:
+		return "java.lang.Boolean"
+	case []interface{}:
+		return "java.util.ArrayList"
+	case map[string]interface{}, Document:
+		return "java.util.HashMap"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// valueToString renders a value similarly to Java's toString()
+func valueToString(v interface{}) string {
+	switch tv := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return tv
+	case float64:
+		return strconv.FormatFloat(tv, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(tv)
+	case []interface{}:
+		parts := make([]string, len(tv))
+		for i := range tv {
+			parts[i] = valueToString(tv[i])
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case map[string]interface{}:
+		keys := make([]string, 0, len(tv))
+		for k := range tv {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = k + "=" + valueToString(tv[k])
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	default:
+		return fmt.Sprintf("%v", tv)
+	}
+}
+
+var templateFinder = regexp.MustCompile(`\{\{\{?\s*([^{}]*?)\s*\}?\}\}`)
+
+// renderTemplate replaces the mustache placeholders {{field}} and {{{field}}} with the values of the document
+// or of the ingest metadata (_ingest.*)
+func renderTemplate(s string, doc Document, ingest map[string]interface{}) string {
+	return templateFinder.ReplaceAllStringFunc(s, func(m string) string {
+		name := templateFinder.FindStringSubmatch(m)[1]
+		if strings.HasPrefix(name, "_ingest.") {
+			return valueToString(ingest[strings.TrimPrefix(name, "_ingest.")])
+		}
+		v, _ := getField(doc, name)
+		return valueToString(v)
+	})
+}
+
+// renderValue renders all strings contained in a (possibly nested) value
+func renderValue(v interface{}, doc Document, ingest map[string]interface{}) interface{} {
+	switch tv := v.(type) {
+	case string:
+		return renderTemplate(tv, doc, ingest)
+	case []string:
+		l := make([]interface{}, len(tv))
+		for i := range tv {
+			l[i] = renderTemplate(tv[i], doc, ingest)
+		}
+		return l
+	case []interface{}:
+		l := make([]interface{}, len(tv))
+		for i := range tv {
+			l[i] = renderValue(tv[i], doc, ingest)
+		}
+		return l
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(tv))
+		for k, e := range tv {
+			m[k] = renderValue(e, doc, ingest)
+		}
+		return m
+	default:
+		return v
+	}
+}
@@ -0,0 +1,1933 @@
+package simulate
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// A (very) small interpreter for the subset of Painless generated by the transpiler, i.e., the `if` conditions,
+// the scripts computing the branch conditions and the scripts of the plugins (e.g., remove_tag, translate, kv or
+// fingerprint) with the part of the Java API they use. Everything else is reported as unsupported.
+
+// UnsupportedError is returned for constructs (processors, Painless syntax) the simulator cannot execute
+type UnsupportedError struct {
+	msg string
+}
+
+func (e UnsupportedError) Error() string {
+	return e.msg
+}
+
+func unsupported(format string, args ...interface{}) error {
+	return UnsupportedError{msg: errors.Errorf(format, args...).Error()}
+}
+
+type tokenKind int
+
+const (
+	tkEOF tokenKind = iota
+	tkIdent
+	tkNumber
+	tkString
+	tkRegex
+	tkOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// Longest operators first
+var painlessOperators = []string{
+	"==~", "===", "!==",
+	"?.", "?:", "->", "==", "!=", "<=", ">=", "&&", "||", "=~", "++", "--", "+=", "-=",
+	"(", ")", "[", "]", "{", "}", ".", ",", ";", "!", "<", ">", "=", "+", "-", "*", "/", "%", "?", ":", "&", "|",
+}
+
+func tokenize(src string) ([]token, error) {
+	tokens := []token{}
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, errors.New("unterminated comment")
+			}
+			i += end + 4
+		case c == '\'' || c == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(src) && src[j] != c; j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+					switch src[j] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					default:
+						b.WriteByte(src[j])
+					}
+					continue
+				}
+				b.WriteByte(src[j])
+			}
+			if j >= len(src) {
+				return nil, errors.New("unterminated string")
+			}
+			tokens = append(tokens, token{kind: tkString, text: b.String()})
+			i = j + 1
+		case c == '/' && regexAllowed(tokens):
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(src) && src[j] != '/'; j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+					if src[j] != '/' {
+						b.WriteByte('\\')
+					}
+				}
+				b.WriteByte(src[j])
+			}
+			if j >= len(src) {
+				return nil, errors.New("unterminated regex")
+			}
+			j++
+			// Only the case insensitive flag is kept
+			flags := ""
+			for j < len(src) && (src[j] >= 'a' && src[j] <= 'z' || src[j] >= 'A' && src[j] <= 'Z') {
+				if src[j] == 'i' {
+					flags = "(?i)"
+				}
+				j++
+			}
+			tokens = append(tokens, token{kind: tkRegex, text: flags + b.String()})
+			i = j
+		case c >= '0' && c <= '9':
+			j := i
+			if strings.HasPrefix(src[i:], "0x") || strings.HasPrefix(src[i:], "0X") {
+				j += 2
+			}
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.' || src[j] >= 'a' && src[j] <= 'f' || src[j] >= 'A' && src[j] <= 'F') {
+				j++
+			}
+			text := src[i:j]
+			// Suffixes like 10L or 1.0f
+			if j < len(src) && strings.ContainsRune("lLfFdD", rune(src[j])) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tkNumber, text: text})
+			i = j
+		case c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(src) && (src[j] == '_' || src[j] == '$' || src[j] >= 'a' && src[j] <= 'z' || src[j] >= 'A' && src[j] <= 'Z' || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, token{kind: tkIdent, text: src[i:j]})
+			i = j
+		default:
+			found := false
+			for _, op := range painlessOperators {
+				if strings.HasPrefix(src[i:], op) {
+					tokens = append(tokens, token{kind: tkOp, text: op})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, errors.Errorf("unexpected character '%c'", c)
+			}
+		}
+	}
+	return append(tokens, token{kind: tkEOF}), nil
+}
+
+// regexAllowed tells whether a '/' starts a regex, i.e., it cannot be a division
+func regexAllowed(tokens []token) bool {
+	if len(tokens) == 0 {
+		return true
+	}
+	last := tokens[len(tokens)-1]
+	switch last.kind {
+	case tkOp:
+		return !contains([]string{")", "]", "++", "--"}, last.text)
+	case tkIdent:
+		return last.text == "return"
+	}
+	return false
+}
+
+// Expressions
+type pNode interface{}
+
+type pLiteral struct{ value interface{} }
+type pIdent struct{ name string }
+type pMember struct {
+	object   pNode
+	name     string
+	nullSafe bool
+}
+type pIndex struct {
+	object pNode
+	index  pNode
+}
+type pCall struct {
+	object   pNode // nil for functions like $() and field()
+	name     string
+	args     []pNode
+	nullSafe bool
+}
+type pUnary struct {
+	op string
+	x  pNode
+}
+type pBinary struct {
+	op          string
+	left, right pNode
+}
+type pTernary struct{ cond, then, els pNode }
+type pInstanceOf struct {
+	x        pNode
+	typeName string
+}
+type pRegex struct {
+	re    *regexp.Regexp
+	whole *regexp.Regexp
+}
+type pList struct{ elements []pNode }
+type pNew struct {
+	typeName string
+	args     []pNode
+}
+type pNewArray struct {
+	typeName string
+	size     pNode
+}
+type pLambda struct {
+	param string
+	body  pNode
+}
+type pAssign struct {
+	target pNode
+	op     string
+	value  pNode
+}
+type pCast struct {
+	typeName string
+	x        pNode
+}
+
+// Statements
+type pStmt interface{}
+
+type pExprStmt struct{ x pNode }
+type pDecl struct {
+	name  string
+	value pNode
+}
+type pIf struct {
+	cond      pNode
+	then, els []pStmt
+}
+type pReturn struct{ x pNode }
+type pThrow struct{ x pNode }
+type pForIn struct {
+	name string
+	iter pNode
+	body []pStmt
+}
+type pWhile struct {
+	cond pNode
+	body []pStmt
+}
+type pFor struct {
+	init   pStmt
+	cond   pNode
+	update pNode
+	body   []pStmt
+}
+type pBreak struct{}
+type pContinue struct{}
+type pTry struct {
+	body    []pStmt
+	catches []pCatch
+}
+type pCatch struct {
+	typeName string
+	name     string
+	body     []pStmt
+}
+
+// A function declared by the script, e.g., String f(def x) { ... }
+type pFunc struct {
+	name   string
+	params []string
+	body   []pStmt
+}
+
+var painlessTypes = []string{
+	"def", "String", "byte", "short", "char", "int", "long", "float", "double", "boolean", "Map", "List", "Set", "Object",
+	"HashMap", "LinkedHashMap", "ArrayList", "Number", "Integer", "Long", "Double", "Boolean", "Matcher", "ZonedDateTime",
+}
+
+type painlessParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *painlessParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *painlessParser) peekAt(offset int) token {
+	if p.pos+offset >= len(p.tokens) {
+		return token{kind: tkEOF}
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *painlessParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tkEOF {
+		p.pos++
+	}
+	return t
+}
+
+// typeLength returns the number of tokens of the type at the given offset (e.g., 3 for String[]), 0 if there is no type
+func (p *painlessParser) typeLength(offset int) int {
+	t := p.peekAt(offset)
+	if t.kind != tkIdent || !contains(painlessTypes, t.text) {
+		return 0
+	}
+	n := 1
+	for p.peekAt(offset+n).kind == tkOp && p.peekAt(offset+n).text == "[" && p.peekAt(offset+n+1).kind == tkOp && p.peekAt(offset+n+1).text == "]" {
+		n += 2
+	}
+	return n
+}
+
+func (p *painlessParser) isOp(op string) bool {
+	t := p.peek()
+	return t.kind == tkOp && t.text == op
+}
+
+func (p *painlessParser) accept(op string) bool {
+	if p.isOp(op) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *painlessParser) expect(op string) error {
+	if !p.accept(op) {
+		return unsupported("expected '%s' but found '%s'", op, p.peek().text)
+	}
+	return nil
+}
+
+func parsePainless(src string) ([]pStmt, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, unsupported("painless: %v", err)
+	}
+	p := &painlessParser{tokens: tokens}
+	stmts := []pStmt{}
+	for p.peek().kind != tkEOF {
+		s, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, s)
+	}
+	return stmts, nil
+}
+
+func (p *painlessParser) block() ([]pStmt, error) {
+	if !p.accept("{") {
+		s, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		return []pStmt{s}, nil
+	}
+	stmts := []pStmt{}
+	for !p.accept("}") {
+		if p.peek().kind == tkEOF {
+			return nil, unsupported("unterminated block")
+		}
+		s, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, s)
+	}
+	return stmts, nil
+}
+
+func (p *painlessParser) statement() (pStmt, error) {
+	t := p.peek()
+	if t.kind == tkIdent {
+		switch t.text {
+		case "if":
+			p.next()
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			cond, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			then, err := p.block()
+			if err != nil {
+				return nil, err
+			}
+			var els []pStmt
+			if p.peek().kind == tkIdent && p.peek().text == "else" {
+				p.next()
+				els, err = p.block()
+				if err != nil {
+					return nil, err
+				}
+			}
+			return pIf{cond: cond, then: then, els: els}, nil
+
+		case "for":
+			p.next()
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			// for (x in list) or for (def x : list), otherwise for (init; condition; update)
+			n := p.typeLength(0)
+			inLoop := n == 0 && p.peekAt(1).kind == tkIdent && p.peekAt(1).text == "in"
+			if p.peekAt(n).kind != tkIdent || !inLoop && !(p.peekAt(n+1).kind == tkOp && p.peekAt(n+1).text == ":") {
+				return p.forLoop()
+			}
+			p.pos += n
+			name := p.next()
+			p.next()
+			iter, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			body, err := p.block()
+			if err != nil {
+				return nil, err
+			}
+			return pForIn{name: name.text, iter: iter, body: body}, nil
+
+		case "while":
+			p.next()
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			cond, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			body, err := p.block()
+			if err != nil {
+				return nil, err
+			}
+			return pWhile{cond: cond, body: body}, nil
+
+		case "break", "continue":
+			p.next()
+			p.accept(";")
+			if t.text == "break" {
+				return pBreak{}, nil
+			}
+			return pContinue{}, nil
+
+		case "try":
+			p.next()
+			return p.try()
+
+		case "return", "throw":
+			p.next()
+			var x pNode
+			if !p.isOp(";") && !p.isOp("}") && p.peek().kind != tkEOF {
+				var err error
+				x, err = p.expression()
+				if err != nil {
+					return nil, err
+				}
+			}
+			p.accept(";")
+			if t.text == "throw" {
+				return pThrow{x: x}, nil
+			}
+			return pReturn{x: x}, nil
+		}
+
+		n := p.typeLength(0)
+		if t.text == "void" {
+			n = 1
+		}
+		if n > 0 && p.peekAt(n).kind == tkIdent && p.peekAt(n+1).kind == tkOp && p.peekAt(n+1).text == "(" {
+			return p.function()
+		}
+
+		if n > 0 && p.peekAt(n).kind == tkIdent {
+			p.pos += n
+			name := p.next().text
+			var value pNode = pLiteral{value: nil}
+			if p.accept("=") {
+				var err error
+				value, err = p.expression()
+				if err != nil {
+					return nil, err
+				}
+			}
+			p.accept(";")
+			return pDecl{name: name, value: value}, nil
+		}
+	}
+
+	x, err := p.assignment()
+	if err != nil {
+		return nil, err
+	}
+	p.accept(";")
+	return pExprStmt{x: x}, nil
+}
+
+// assignment parses an expression, possibly assigned with =, += or -=
+func (p *painlessParser) assignment() (pNode, error) {
+	x, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"=", "+=", "-="} {
+		if p.accept(op) {
+			value, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			return pAssign{target: x, op: op, value: value}, nil
+		}
+	}
+	return x, nil
+}
+
+// forLoop parses the rest of a for (init; condition; update) loop
+func (p *painlessParser) forLoop() (pStmt, error) {
+	f := pFor{}
+	var err error
+	if !p.accept(";") {
+		// The statement consumes the semicolon
+		if f.init, err = p.statement(); err != nil {
+			return nil, err
+		}
+	}
+	if !p.isOp(";") {
+		if f.cond, err = p.expression(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect(";"); err != nil {
+		return nil, err
+	}
+	if !p.isOp(")") {
+		if f.update, err = p.assignment(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if f.body, err = p.block(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// try parses the rest of a try statement with its catch blocks
+func (p *painlessParser) try() (pStmt, error) {
+	if !p.isOp("{") {
+		return nil, unsupported("expected the body of try")
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	t := pTry{body: body}
+	for p.peek().kind == tkIdent && p.peek().text == "catch" {
+		p.next()
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		typeName, name := p.next(), p.next()
+		if typeName.kind != tkIdent || name.kind != tkIdent {
+			return nil, unsupported("expected the type and the name of the exception")
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		if !p.isOp("{") {
+			return nil, unsupported("expected the body of catch")
+		}
+		body, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		t.catches = append(t.catches, pCatch{typeName: typeName.text, name: name.text, body: body})
+	}
+	if len(t.catches) == 0 {
+		return nil, unsupported("try without catch is not supported")
+	}
+	return t, nil
+}
+
+// function parses the declaration of a function, the types of the parameters and of the result are ignored
+func (p *painlessParser) function() (pStmt, error) {
+	p.pos += max(p.typeLength(0), 1)
+	f := pFunc{name: p.next().text}
+	p.next()
+	for !p.accept(")") {
+		n := p.typeLength(0)
+		if n == 0 {
+			return nil, unsupported("expected the type of the parameter of [%s]", f.name)
+		}
+		p.pos += n
+		name := p.next()
+		if name.kind != tkIdent {
+			return nil, unsupported("expected the name of the parameter of [%s]", f.name)
+		}
+		f.params = append(f.params, name.text)
+		if !p.isOp(")") {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !p.isOp("{") {
+		return nil, unsupported("expected the body of [%s]", f.name)
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	f.body = body
+	return f, nil
+}
+
+func (p *painlessParser) expression() (pNode, error) {
+	return p.ternary()
+}
+
+func (p *painlessParser) ternary() (pNode, error) {
+	cond, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.accept("?:") {
+		els, err := p.ternary()
+		if err != nil {
+			return nil, err
+		}
+		return pBinary{op: "?:", left: cond, right: els}, nil
+	}
+	if p.accept("?") {
+		then, err := p.ternary()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		els, err := p.ternary()
+		if err != nil {
+			return nil, err
+		}
+		return pTernary{cond: cond, then: then, els: els}, nil
+	}
+	return cond, nil
+}
+
+// Binary operators by increasing precedence
+var painlessPrecedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"&"},
+	{"==", "!=", "===", "!==", "=~", "==~"},
+	{"<", "<=", ">", ">=", "instanceof"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *painlessParser) binary(level int) (pNode, error) {
+	if level >= len(painlessPrecedence) {
+		return p.unary()
+	}
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if (t.kind != tkOp && t.text != "instanceof") || !contains(painlessPrecedence[level], t.text) {
+			return left, nil
+		}
+		p.next()
+
+		switch t.text {
+		case "instanceof":
+			typeName := p.next()
+			if typeName.kind != tkIdent {
+				return nil, unsupported("expected a type after instanceof")
+			}
+			left = pInstanceOf{x: left, typeName: typeName.text}
+			continue
+		case "=~", "==~":
+			r := p.next()
+			if r.kind != tkRegex {
+				return nil, unsupported("expected a regex after %s", t.text)
+			}
+			re, err := compileRegex(r.text)
+			if err != nil {
+				return nil, err
+			}
+			left = pBinary{op: t.text, left: left, right: re}
+			continue
+		}
+
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = pBinary{op: t.text, left: left, right: right}
+	}
+}
+
+func compileRegex(text string) (pRegex, error) {
+	re, err := regexp.Compile(text)
+	if err != nil {
+		return pRegex{}, unsupported("regex /%s/ is not supported: %v", text, err)
+	}
+	return pRegex{re: re, whole: regexp.MustCompile("^(?:" + text + ")$")}, nil
+}
+
+func (p *painlessParser) unary() (pNode, error) {
+	if p.accept("!") {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return pUnary{op: "!", x: x}, nil
+	}
+	if p.accept("-") {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return pUnary{op: "-", x: x}, nil
+	}
+	return p.postfix()
+}
+
+func (p *painlessParser) arguments() ([]pNode, error) {
+	args := []pNode{}
+	if p.accept(")") {
+		return args, nil
+	}
+	for {
+		var arg pNode
+		var err error
+		// Lambda with a single parameter (x -> ...)
+		if p.peek().kind == tkIdent && p.peekAt(1).kind == tkOp && p.peekAt(1).text == "->" {
+			param := p.next().text
+			p.next()
+			var body pNode
+			body, err = p.expression()
+			arg = pLambda{param: param, body: body}
+		} else {
+			arg, err = p.expression()
+		}
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.accept(")") {
+			return args, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *painlessParser) postfix() (pNode, error) {
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.isOp(".") || p.isOp("?."):
+			nullSafe := p.next().text == "?."
+			name := p.next()
+			if name.kind != tkIdent {
+				return nil, unsupported("expected a field or method name after '.'")
+			}
+			if p.accept("(") {
+				args, err := p.arguments()
+				if err != nil {
+					return nil, err
+				}
+				x = pCall{object: x, name: name.text, args: args, nullSafe: nullSafe}
+			} else {
+				x = pMember{object: x, name: name.text, nullSafe: nullSafe}
+			}
+		case p.isOp("["):
+			p.next()
+			index, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = pIndex{object: x, index: index}
+		case p.isOp("++") || p.isOp("--"):
+			x = pAssign{target: x, op: p.next().text}
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *painlessParser) primary() (pNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tkString:
+		return pLiteral{value: t.text}, nil
+	case tkRegex:
+		return compileRegex(t.text)
+	case tkNumber:
+		if strings.HasPrefix(t.text, "0x") || strings.HasPrefix(t.text, "0X") {
+			n, err := strconv.ParseInt(t.text[2:], 16, 64)
+			if err != nil {
+				return nil, unsupported("invalid number %s", t.text)
+			}
+			return pLiteral{value: float64(n)}, nil
+		}
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, unsupported("invalid number %s", t.text)
+		}
+		return pLiteral{value: n}, nil
+	case tkIdent:
+		switch t.text {
+		case "true":
+			return pLiteral{value: true}, nil
+		case "false":
+			return pLiteral{value: false}, nil
+		case "null":
+			return pLiteral{value: nil}, nil
+		case "new":
+			typeName := p.next()
+			if typeName.kind != tkIdent {
+				return nil, unsupported("expected a type after new")
+			}
+			if p.accept("[") {
+				size, err := p.expression()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect("]"); err != nil {
+					return nil, err
+				}
+				return pNewArray{typeName: typeName.text, size: size}, nil
+			}
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			args, err := p.arguments()
+			if err != nil {
+				return nil, err
+			}
+			return pNew{typeName: typeName.text, args: args}, nil
+		}
+		if p.accept("(") {
+			args, err := p.arguments()
+			if err != nil {
+				return nil, err
+			}
+			return pCall{name: t.text, args: args}, nil
+		}
+		return pIdent{name: t.text}, nil
+	case tkOp:
+		switch t.text {
+		case "(":
+			// Cast, e.g., (String) x
+			if n := p.typeLength(0); n > 0 && p.peekAt(n).kind == tkOp && p.peekAt(n).text == ")" {
+				typeName := p.peek().text
+				p.pos += n + 1
+				x, err := p.unary()
+				if err != nil {
+					return nil, err
+				}
+				return pCast{typeName: typeName, x: x}, nil
+			}
+			x, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		case "[":
+			elements := []pNode{}
+			if p.accept("]") {
+				return pList{elements: elements}, nil
+			}
+			for {
+				e, err := p.expression()
+				if err != nil {
+					return nil, err
+				}
+				elements = append(elements, e)
+				if p.accept("]") {
+					return pList{elements: elements}, nil
+				}
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return nil, unsupported("unexpected token '%s'", t.text)
+}
+
+// Runtime values that are not plain data
+type fieldRef struct{ path string }
+type randomObject struct{}
+type exceptionObject struct{ message string }
+
+// Sentinel used to implement the return statement
+type returnValue struct{ value interface{} }
+
+func (returnValue) Error() string { return "return" }
+
+// Sentinels used to implement the break and continue statements
+type loopControl string
+
+func (c loopControl) Error() string { return string(c) }
+
+const (
+	breakLoop    loopControl = "break"
+	continueLoop loopControl = "continue"
+)
+
+// endLoop tells whether the error returned by the body of a loop stops it, and the error the loop returns
+func endLoop(err error) (bool, error) {
+	switch err {
+	case nil, continueLoop:
+		return false, nil
+	case breakLoop:
+		return true, nil
+	}
+	return true, err
+}
+
+type scope struct {
+	vars   map[string]interface{}
+	parent *scope
+}
+
+func (s *scope) lookup(name string) (interface{}, bool) {
+	for c := s; c != nil; c = c.parent {
+		if v, ok := c.vars[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func (s *scope) set(name string, v interface{}) bool {
+	for c := s; c != nil; c = c.parent {
+		if _, ok := c.vars[name]; ok {
+			c.vars[name] = v
+			return true
+		}
+	}
+	return false
+}
+
+type painless struct {
+	doc       Document
+	params    map[string]interface{}
+	functions map[string]pFunc
+}
+
+// Painless stops the loops after a million iterations
+const painlessMaxLoopCounter = 1000000
+
+// newPainless returns the interpreter of the statements, with the functions they declare
+func newPainless(stmts []pStmt, doc Document, params map[string]interface{}) painless {
+	functions := map[string]pFunc{}
+	for _, stmt := range stmts {
+		if f, ok := stmt.(pFunc); ok {
+			functions[f.name] = f
+		}
+	}
+	return painless{doc: doc, params: params, functions: functions}
+}
+
+var painlessCache = map[string][]pStmt{}
+
+func compilePainless(src string) ([]pStmt, error) {
+	if stmts, ok := painlessCache[src]; ok {
+		return stmts, nil
+	}
+	stmts, err := parsePainless(src)
+	if err != nil {
+		return nil, err
+	}
+	painlessCache[src] = stmts
+	return stmts, nil
+}
+
+// evalCondition evaluates the `if` of a processor
+func evalCondition(src string, doc Document) (bool, error) {
+	stmts, err := compilePainless(src)
+	if err != nil {
+		return false, err
+	}
+	interp := newPainless(stmts, doc, nil)
+	var result interface{}
+	s := &scope{vars: map[string]interface{}{}}
+	for _, stmt := range stmts {
+		if es, ok := stmt.(pExprStmt); ok {
+			result, err = interp.eval(es.x, s)
+		} else {
+			err = interp.exec(stmt, s)
+		}
+		if rv, ok := err.(returnValue); ok {
+			result, err = rv.value, nil
+			break
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	b, ok := result.(bool)
+	if !ok {
+		return false, errors.Errorf("condition [%s] did not return a boolean value", src)
+	}
+	return b, nil
+}
+
+// runScript executes the source of a script processor
+func runScript(src string, params map[string]interface{}, doc Document) error {
+	stmts, err := compilePainless(src)
+	if err != nil {
+		return err
+	}
+	interp := newPainless(stmts, doc, params)
+	err = interp.execAll(stmts, &scope{vars: map[string]interface{}{}})
+	if _, ok := err.(returnValue); ok {
+		return nil
+	}
+	return err
+}
+
+func (in painless) execAll(stmts []pStmt, s *scope) error {
+	for _, stmt := range stmts {
+		if err := in.exec(stmt, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (in painless) exec(stmt pStmt, s *scope) error {
+	switch st := stmt.(type) {
+	case pExprStmt:
+		_, err := in.eval(st.x, s)
+		return err
+	case pDecl:
+		v, err := in.eval(st.value, s)
+		if err != nil {
+			return err
+		}
+		s.vars[st.name] = v
+		return nil
+	case pIf:
+		c, err := in.evalBool(st.cond, s)
+		if err != nil {
+			return err
+		}
+		inner := &scope{vars: map[string]interface{}{}, parent: s}
+		if c {
+			return in.execAll(st.then, inner)
+		}
+		return in.execAll(st.els, inner)
+	case pForIn:
+		iter, err := in.eval(st.iter, s)
+		if err != nil {
+			return err
+		}
+		list, ok := iter.([]interface{})
+		if !ok {
+			return unsupported("for loops are only supported on lists")
+		}
+		for _, e := range list {
+			inner := &scope{vars: map[string]interface{}{st.name: e}, parent: s}
+			if end, err := endLoop(in.execAll(st.body, inner)); end {
+				return err
+			}
+		}
+		return nil
+	case pWhile:
+		for i := 0; ; i++ {
+			c, err := in.evalBool(st.cond, s)
+			if err != nil || !c {
+				return err
+			}
+			if i >= painlessMaxLoopCounter {
+				return errors.New("the maximum number of statements that can be executed in a loop has been reached")
+			}
+			if end, err := endLoop(in.execAll(st.body, &scope{vars: map[string]interface{}{}, parent: s})); end {
+				return err
+			}
+		}
+	case pFor:
+		outer := &scope{vars: map[string]interface{}{}, parent: s}
+		if st.init != nil {
+			if err := in.exec(st.init, outer); err != nil {
+				return err
+			}
+		}
+		for i := 0; ; i++ {
+			if st.cond != nil {
+				c, err := in.evalBool(st.cond, outer)
+				if err != nil || !c {
+					return err
+				}
+			}
+			if i >= painlessMaxLoopCounter {
+				return errors.New("the maximum number of statements that can be executed in a loop has been reached")
+			}
+			if end, err := endLoop(in.execAll(st.body, &scope{vars: map[string]interface{}{}, parent: outer})); end {
+				return err
+			}
+			if st.update != nil {
+				if _, err := in.eval(st.update, outer); err != nil {
+					return err
+				}
+			}
+		}
+	case pBreak:
+		return breakLoop
+	case pContinue:
+		return continueLoop
+	case pTry:
+		err := in.execAll(st.body, &scope{vars: map[string]interface{}{}, parent: s})
+		if err == nil || !isException(err) {
+			return err
+		}
+		for _, c := range st.catches {
+			if catches(c.typeName, err) {
+				return in.execAll(c.body, &scope{vars: map[string]interface{}{c.name: exceptionObject{message: err.Error()}}, parent: s})
+			}
+		}
+		return err
+	case pFunc:
+		// Declared before the execution
+		return nil
+	case pReturn:
+		var v interface{}
+		if st.x != nil {
+			var err error
+			if v, err = in.eval(st.x, s); err != nil {
+				return err
+			}
+		}
+		return returnValue{value: v}
+	case pThrow:
+		v, err := in.eval(st.x, s)
+		if err != nil {
+			return err
+		}
+		if e, ok := v.(exceptionObject); ok {
+			return errors.New(e.message)
+		}
+		return errors.Errorf("%v", v)
+	}
+	return unsupported("unsupported statement")
+}
+
+// isException tells whether err is raised by the script, and can thus be caught, or it is a sentinel or a limit of the simulator
+func isException(err error) bool {
+	switch err.(type) {
+	case returnValue, loopControl, UnsupportedError:
+		return false
+	}
+	return true
+}
+
+// catches tells whether a catch block of the given type handles err, the exceptions are identified by the prefix of their message,
+// e.g., "DateTimeParseException: ..."
+func catches(typeName string, err error) bool {
+	switch typeName {
+	case "Exception", "RuntimeException", "Throwable":
+		return true
+	}
+	return strings.HasPrefix(err.Error(), typeName+":")
+}
+
+func (in painless) evalBool(n pNode, s *scope) (bool, error) {
+	v, err := in.eval(n, s)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, errors.Errorf("cannot cast %s to boolean", typeName(v))
+	}
+	return b, nil
+}
+
+func (in painless) eval(n pNode, s *scope) (interface{}, error) {
+	switch x := n.(type) {
+	case pLiteral:
+		return x.value, nil
+
+	case pIdent:
+		if v, ok := s.lookup(x.name); ok {
+			return v, nil
+		}
+		switch x.name {
+		case "ctx":
+			return map[string]interface{}(in.doc), nil
+		case "params":
+			if in.params == nil {
+				return map[string]interface{}{}, nil
+			}
+			return in.params, nil
+		}
+		return nil, unsupported("cannot resolve symbol [%s]", x.name)
+
+	case pCast:
+		v, err := in.eval(x.x, s)
+		if err != nil {
+			return nil, err
+		}
+		switch x.typeName {
+		case "int", "long", "short", "Integer", "Long":
+			if f, ok := v.(float64); ok {
+				return math.Trunc(f), nil
+			}
+		case "byte":
+			if f, ok := v.(float64); ok {
+				return float64(int8(int64(f))), nil
+			}
+		case "Number", "double", "float", "Double":
+			if _, ok := v.(float64); !ok && v != nil {
+				return nil, errors.Errorf("ClassCastException: cannot cast %s to %s", typeName(v), x.typeName)
+			}
+		case "String":
+			if _, ok := v.(string); !ok && v != nil {
+				return nil, errors.Errorf("ClassCastException: cannot cast %s to String", typeName(v))
+			}
+		}
+		return v, nil
+
+	case pList:
+		l := []interface{}{}
+		for _, e := range x.elements {
+			v, err := in.eval(e, s)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, v)
+		}
+		return l, nil
+
+	case pMember:
+		if class, ok := x.object.(pIdent); ok {
+			if _, local := s.lookup(class.name); !local {
+				if v, ok := staticField(class.name, x.name); ok {
+					return v, nil
+				}
+			}
+		}
+		obj, err := in.eval(x.object, s)
+		if err != nil {
+			return nil, err
+		}
+		if obj == nil {
+			if x.nullSafe {
+				return nil, nil
+			}
+			return nil, errors.Errorf("NullPointerException: cannot access field [%s] of null", x.name)
+		}
+		if m, ok := obj.(map[string]interface{}); ok {
+			return m[x.name], nil
+		}
+		if l, ok := obj.([]interface{}); ok && x.name == "length" {
+			return float64(len(l)), nil
+		}
+		return nil, errors.Errorf("cannot access field [%s] of %s", x.name, typeName(obj))
+
+	case pIndex:
+		obj, err := in.eval(x.object, s)
+		if err != nil {
+			return nil, err
+		}
+		idx, err := in.eval(x.index, s)
+		if err != nil {
+			return nil, err
+		}
+		switch o := obj.(type) {
+		case nil:
+			return nil, errors.New("NullPointerException: cannot access an element of null")
+		case map[string]interface{}:
+			key, ok := idx.(string)
+			if !ok {
+				return nil, nil
+			}
+			return o[key], nil
+		case []interface{}:
+			i, ok := idx.(float64)
+			if !ok || int(i) < 0 || int(i) >= len(o) {
+				return nil, errors.Errorf("index out of bounds: %v", idx)
+			}
+			return o[int(i)], nil
+		}
+		return nil, errors.Errorf("cannot index %s", typeName(obj))
+
+	case pUnary:
+		switch x.op {
+		case "!":
+			b, err := in.evalBool(x.x, s)
+			return !b, err
+		case "-":
+			v, err := in.eval(x.x, s)
+			if err != nil {
+				return nil, err
+			}
+			f, ok := v.(float64)
+			if !ok {
+				return nil, errors.Errorf("cannot negate %s", typeName(v))
+			}
+			return -f, nil
+		}
+
+	case pBinary:
+		return in.evalBinary(x, s)
+
+	case pTernary:
+		c, err := in.evalBool(x.cond, s)
+		if err != nil {
+			return nil, err
+		}
+		if c {
+			return in.eval(x.then, s)
+		}
+		return in.eval(x.els, s)
+
+	case pInstanceOf:
+		v, err := in.eval(x.x, s)
+		if err != nil {
+			return nil, err
+		}
+		switch x.typeName {
+		case "List", "ArrayList", "Collection":
+			_, ok := v.([]interface{})
+			return ok, nil
+		case "Map", "HashMap", "LinkedHashMap":
+			_, ok := v.(map[string]interface{})
+			return ok, nil
+		case "String", "CharSequence":
+			_, ok := v.(string)
+			return ok, nil
+		case "Number", "Integer", "Long", "Double", "Float":
+			_, ok := v.(float64)
+			return ok, nil
+		case "Boolean":
+			_, ok := v.(bool)
+			return ok, nil
+		case "Object", "def":
+			return v != nil, nil
+		}
+		return nil, unsupported("instanceof %s is not supported", x.typeName)
+
+	case pNew:
+		switch x.typeName {
+		case "Random":
+			return randomObject{}, nil
+		case "Exception", "IllegalArgumentException", "RuntimeException":
+			msg := ""
+			if len(x.args) > 0 {
+				v, err := in.eval(x.args[0], s)
+				if err != nil {
+					return nil, err
+				}
+				msg = valueToString(v)
+			}
+			return exceptionObject{message: msg}, nil
+		case "HashMap", "LinkedHashMap":
+			// The order of the keys is not kept
+			return map[string]interface{}{}, nil
+		case "ArrayList":
+			if len(x.args) == 1 {
+				v, err := in.eval(x.args[0], s)
+				if err != nil {
+					return nil, err
+				}
+				l, ok := v.([]interface{})
+				if !ok {
+					return nil, unsupported("new ArrayList(%s) is not supported", typeName(v))
+				}
+				return append([]interface{}{}, l...), nil
+			}
+			return []interface{}{}, nil
+		}
+		return nil, unsupported("new %s() is not supported", x.typeName)
+
+	case pNewArray:
+		size, err := in.eval(x.size, s)
+		if err != nil {
+			return nil, err
+		}
+		n, ok := size.(float64)
+		if !ok || n < 0 {
+			return nil, errors.Errorf("NegativeArraySizeException: %v", size)
+		}
+		var zero interface{}
+		if contains([]string{"byte", "short", "int", "long", "float", "double"}, x.typeName) {
+			zero = float64(0)
+		}
+		array := make([]interface{}, int(n))
+		for i := range array {
+			array[i] = zero
+		}
+		return array, nil
+
+	case pRegex:
+		return x, nil
+
+	case pCall:
+		return in.evalCall(x, s)
+
+	case pAssign:
+		if x.op == "++" || x.op == "--" {
+			v, err := in.eval(x.target, s)
+			if err != nil {
+				return nil, err
+			}
+			f, ok := v.(float64)
+			if !ok {
+				return nil, errors.Errorf("cannot apply [%s] to %s", x.op, typeName(v))
+			}
+			if x.op == "++" {
+				return f, in.assign(x.target, f+1, s)
+			}
+			return f, in.assign(x.target, f-1, s)
+		}
+		v, err := in.eval(x.value, s)
+		if err != nil {
+			return nil, err
+		}
+		if x.op != "=" {
+			v, err = in.evalBinary(pBinary{op: x.op[:1], left: x.target, right: pLiteral{value: v}}, s)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return v, in.assign(x.target, v, s)
+
+	case pLambda:
+		return x, nil
+	}
+	return nil, unsupported("unsupported expression")
+}
+
+// assign writes back v in the place described by target (a variable, ctx.field or list[index])
+func (in painless) assign(target pNode, v interface{}, s *scope) error {
+	switch t := target.(type) {
+	case pIdent:
+		if !s.set(t.name, v) {
+			return unsupported("cannot assign to [%s]", t.name)
+		}
+		return nil
+	case pMember:
+		obj, err := in.eval(t.object, s)
+		if err != nil {
+			return err
+		}
+		m, ok := obj.(map[string]interface{})
+		if !ok {
+			return errors.Errorf("cannot set field [%s] of %s", t.name, typeName(obj))
+		}
+		m[t.name] = v
+		return nil
+	case pIndex:
+		obj, err := in.eval(t.object, s)
+		if err != nil {
+			return err
+		}
+		idx, err := in.eval(t.index, s)
+		if err != nil {
+			return err
+		}
+		switch o := obj.(type) {
+		case map[string]interface{}:
+			key, ok := idx.(string)
+			if !ok {
+				return errors.Errorf("map keys must be strings")
+			}
+			o[key] = v
+			return nil
+		case []interface{}:
+			i, ok := idx.(float64)
+			if !ok || int(i) < 0 || int(i) >= len(o) {
+				return errors.Errorf("index out of bounds: %v", idx)
+			}
+			o[int(i)] = v
+			return nil
+		}
+		return errors.Errorf("cannot assign an element of %s", typeName(obj))
+	}
+	return unsupported("unsupported assignment")
+}
+
+func painlessEquals(a, b interface{}) bool {
+	return reflect.DeepEqual(deepCopy(a), deepCopy(b))
+}
+
+func (in painless) evalBinary(x pBinary, s *scope) (interface{}, error) {
+	switch x.op {
+	case "&&", "||":
+		l, err := in.evalBool(x.left, s)
+		if err != nil {
+			return nil, err
+		}
+		if x.op == "&&" && !l || x.op == "||" && l {
+			return l, nil
+		}
+		return in.evalBool(x.right, s)
+	case "?:":
+		l, err := in.eval(x.left, s)
+		if err != nil || l != nil {
+			return l, err
+		}
+		return in.eval(x.right, s)
+	}
+
+	left, err := in.eval(x.left, s)
+	if err != nil {
+		return nil, err
+	}
+
+	if r, ok := x.right.(pRegex); ok {
+		str, ok := left.(string)
+		if !ok {
+			if left == nil {
+				return nil, errors.New("NullPointerException: cannot match a regex against null")
+			}
+			str = valueToString(left)
+		}
+		if x.op == "==~" {
+			return r.whole.MatchString(str), nil
+		}
+		return r.re.MatchString(str), nil
+	}
+
+	right, err := in.eval(x.right, s)
+	if err != nil {
+		return nil, err
+	}
+
+	switch x.op {
+	case "==", "===":
+		return painlessEquals(left, right), nil
+	case "!=", "!==":
+		return !painlessEquals(left, right), nil
+	case "+":
+		_, ls := left.(string)
+		_, rs := right.(string)
+		if ls || rs {
+			return javaString(left) + javaString(right), nil
+		}
+	}
+
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if !lok || !rok {
+		return nil, errors.Errorf("cannot apply [%s] to types [%s] and [%s]", x.op, typeName(left), typeName(right))
+	}
+	integral := l == math.Trunc(l) && r == math.Trunc(r)
+
+	switch x.op {
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	case ">=":
+		return l >= r, nil
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 && integral {
+			return nil, errors.New("ArithmeticException: / by zero")
+		}
+		if integral {
+			return math.Trunc(l / r), nil
+		}
+		return l / r, nil
+	case "%":
+		if r == 0 {
+			return nil, errors.New("ArithmeticException: / by zero")
+		}
+		return math.Mod(l, r), nil
+	case "&":
+		return float64(int64(l) & int64(r)), nil
+	case "|":
+		return float64(int64(l) | int64(r)), nil
+	}
+	return nil, unsupported("operator [%s] is not supported", x.op)
+}
+
+func javaString(v interface{}) string {
+	if v == nil {
+		return "null"
+	}
+	return valueToString(v)
+}
+
+func (in painless) evalArgs(args []pNode, s *scope) ([]interface{}, error) {
+	values := []interface{}{}
+	for _, a := range args {
+		v, err := in.eval(a, s)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func (in painless) evalCall(x pCall, s *scope) (interface{}, error) {
+	args, err := in.evalArgs(x.args, s)
+	if err != nil {
+		return nil, err
+	}
+
+	// Functions
+	if x.object == nil {
+		switch x.name {
+		case "$":
+			if len(args) != 2 {
+				return nil, unsupported("$ expects two arguments")
+			}
+			v, ok := getField(in.doc, valueToString(args[0]))
+			if !ok || v == nil {
+				return args[1], nil
+			}
+			return v, nil
+		case "field":
+			if len(args) != 1 {
+				return nil, unsupported("field expects one argument")
+			}
+			return fieldRef{path: valueToString(args[0])}, nil
+		}
+		if f, ok := in.functions[x.name]; ok {
+			return in.call(f, args)
+		}
+		return nil, unsupported("function [%s] is not supported", x.name)
+	}
+
+	// Static methods
+	if class, ok := x.object.(pIdent); ok {
+		if _, local := s.lookup(class.name); !local && isClass(class.name) {
+			return staticMethod(class.name, x.name, args)
+		}
+	}
+
+	obj, err := in.eval(x.object, s)
+	if err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		if x.nullSafe {
+			return nil, nil
+		}
+		return nil, errors.Errorf("NullPointerException: cannot invoke [%s] on null", x.name)
+	}
+
+	argString := func(i int) string {
+		if i < len(args) {
+			return valueToString(args[i])
+		}
+		return ""
+	}
+	argInt := func(i int) int {
+		if i < len(args) {
+			if f, ok := args[i].(float64); ok {
+				return int(f)
+			}
+		}
+		return 0
+	}
+
+	switch o := obj.(type) {
+	case fieldRef:
+		switch x.name {
+		case "set":
+			return nil, setField(in.doc, o.path, deepCopy(args[0]))
+		case "get":
+			v, ok := getField(in.doc, o.path)
+			if (!ok || v == nil) && len(args) > 0 {
+				return args[0], nil
+			}
+			return v, nil
+		case "exists":
+			return hasField(in.doc, o.path), nil
+		}
+
+	case randomObject:
+		if x.name == "nextInt" {
+			return float64(rand.Intn(argInt(0))), nil
+		}
+
+	case string:
+		switch x.name {
+		case "contains":
+			return strings.Contains(o, argString(0)), nil
+		case "startsWith":
+			return strings.HasPrefix(o, argString(0)), nil
+		case "endsWith":
+			return strings.HasSuffix(o, argString(0)), nil
+		case "toLowerCase":
+			return strings.ToLower(o), nil
+		case "toUpperCase":
+			return strings.ToUpper(o), nil
+		case "trim":
+			return strings.TrimSpace(o), nil
+		case "length":
+			return float64(len([]rune(o))), nil
+		case "codePointAt":
+			r := []rune(o)
+			i := argInt(0)
+			if i < 0 || i >= len(r) {
+				return nil, errors.Errorf("StringIndexOutOfBoundsException: index %d, length %d", i, len(r))
+			}
+			return float64(r[i]), nil
+		case "isEmpty":
+			return len(o) == 0, nil
+		case "equals":
+			return painlessEquals(o, args[0]), nil
+		case "replace":
+			return strings.ReplaceAll(o, argString(0), argString(1)), nil
+		case "indexOf":
+			return float64(strings.Index(o, argString(0))), nil
+		case "sha1":
+			return fmt.Sprintf("%x", sha1.Sum([]byte(o))), nil
+		case "sha256":
+			return fmt.Sprintf("%x", sha256.Sum256([]byte(o))), nil
+		case "splitOnToken":
+			l := []interface{}{}
+			for _, part := range strings.Split(o, argString(0)) {
+				l = append(l, part)
+			}
+			return l, nil
+		case "substring":
+			r := []rune(o)
+			start, end := argInt(0), len(r)
+			if len(args) > 1 {
+				end = argInt(1)
+			}
+			if start < 0 || end > len(r) || start > end {
+				return nil, errors.Errorf("StringIndexOutOfBoundsException: begin %d, end %d, length %d", start, end, len(r))
+			}
+			return string(r[start:end]), nil
+		}
+
+	case []interface{}:
+		switch x.name {
+		case "contains":
+			for _, e := range o {
+				if painlessEquals(e, args[0]) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case "size":
+			return float64(len(o)), nil
+		case "isEmpty":
+			return len(o) == 0, nil
+		case "get":
+			i := argInt(0)
+			if i < 0 || i >= len(o) {
+				return nil, errors.Errorf("IndexOutOfBoundsException: index %d, length %d", i, len(o))
+			}
+			return o[i], nil
+		case "indexOf":
+			for i, e := range o {
+				if painlessEquals(e, args[0]) {
+					return float64(i), nil
+				}
+			}
+			return float64(-1), nil
+		case "add":
+			return true, in.assign(x.object, append(o, args[0]), s)
+		case "addAll":
+			l, ok := args[0].([]interface{})
+			if !ok {
+				return nil, errors.Errorf("cannot add all the elements of %s", typeName(args[0]))
+			}
+			return len(l) > 0, in.assign(x.object, append(o, l...), s)
+		case "removeIf":
+			lambda, ok := args[0].(pLambda)
+			if !ok {
+				return nil, unsupported("removeIf expects a lambda")
+			}
+			kept := []interface{}{}
+			for _, e := range o {
+				remove, err := in.evalBool(lambda.body, &scope{vars: map[string]interface{}{lambda.param: e}, parent: s})
+				if err != nil {
+					return nil, err
+				}
+				if !remove {
+					kept = append(kept, e)
+				}
+			}
+			return len(kept) != len(o), in.assign(x.object, kept, s)
+		}
+
+	case map[string]interface{}:
+		switch x.name {
+		case "containsKey":
+			_, ok := o[argString(0)]
+			return ok, nil
+		case "keySet":
+			keys := []string{}
+			for k := range o {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			l := []interface{}{}
+			for _, k := range keys {
+				l = append(l, k)
+			}
+			return l, nil
+		case "entrySet":
+			keys := []string{}
+			for k := range o {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			l := []interface{}{}
+			for _, k := range keys {
+				l = append(l, mapEntry{key: k, value: o[k]})
+			}
+			return l, nil
+		case "putAll":
+			m, ok := args[0].(map[string]interface{})
+			if !ok {
+				return nil, errors.Errorf("cannot put all the entries of %s", typeName(args[0]))
+			}
+			for k, v := range m {
+				o[k] = v
+			}
+			return nil, nil
+		case "get":
+			return o[argString(0)], nil
+		case "getOrDefault":
+			if v, ok := o[argString(0)]; ok {
+				return v, nil
+			}
+			return args[1], nil
+		case "put":
+			old := o[argString(0)]
+			o[argString(0)] = args[1]
+			return old, nil
+		case "remove":
+			old := o[argString(0)]
+			delete(o, argString(0))
+			return old, nil
+		case "size":
+			return float64(len(o)), nil
+		case "isEmpty":
+			return len(o) == 0, nil
+		}
+	}
+
+	if v, ok, err := javaMethod(obj, x.name, args); ok {
+		return v, err
+	}
+	if x.name == "equals" && len(args) == 1 {
+		return painlessEquals(obj, args[0]), nil
+	}
+	if x.name == "toString" {
+		return valueToString(obj), nil
+	}
+	return nil, unsupported("method [%s] on %s is not supported", x.name, typeName(obj))
+}
+
+// call executes a function declared by the script. The functions do not see the variables of the script.
+func (in painless) call(f pFunc, args []interface{}) (interface{}, error) {
+	if len(args) != len(f.params) {
+		return nil, unsupported("function [%s] expects %d arguments", f.name, len(f.params))
+	}
+	vars := map[string]interface{}{}
+	for i, name := range f.params {
+		vars[name] = args[i]
+	}
+	err := in.execAll(f.body, &scope{vars: vars})
+	if rv, ok := err.(returnValue); ok {
+		return rv.value, nil
+	}
+	return nil, err
+}
+
+func contains(s []string, e string) bool {
+	for _, v := range s {
+		if v == e {
+			return true
+		}
+	}
+	return false
+}
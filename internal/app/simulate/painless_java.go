@@ -0,0 +1,268 @@
+package simulate
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/herrBez/baffo/internal/javatime"
+)
+
+// The classes of the Java API used by the generated scripts. Instants and zoned date-times are represented by time.Time
+// and UUIDs by their string.
+
+var javaClasses = []string{
+	"Character", "UUID", "Double", "Float", "Integer", "Long", "String", "ZonedDateTime", "LocalDateTime", "Instant",
+	"ZoneOffset", "ZoneId", "DateTimeFormatter", "Base64",
+}
+
+// Runtime values of the Java API
+type mapEntry struct {
+	key   string
+	value interface{}
+}
+type localDateTime struct{ t time.Time }
+type dateTimeFormatter struct{ pattern string }
+type base64Encoder struct{}
+
+// matcher is a java.util.regex.Matcher, find() looks for the next match of the regex
+type matcher struct {
+	regex pRegex
+	input string
+	match []int
+	next  int
+}
+
+func isClass(name string) bool {
+	return contains(javaClasses, name)
+}
+
+func staticField(class string, name string) (interface{}, bool) {
+	if class == "ZoneOffset" && name == "UTC" {
+		return time.UTC, true
+	}
+	return nil, false
+}
+
+func staticMethod(class string, name string, args []interface{}) (interface{}, error) {
+	arg := func(i int) string {
+		if i < len(args) {
+			return valueToString(args[i])
+		}
+		return ""
+	}
+
+	switch class + "." + name {
+	case "Character.charCount":
+		// The strings are indexed by code point, thus every code point is a single character
+		return float64(1), nil
+	case "UUID.randomUUID":
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		b[6] = b[6]&0x0f | 0x40
+		b[8] = b[8]&0x3f | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+	case "String.valueOf":
+		if len(args) != 1 {
+			return nil, unsupported("String.valueOf expects one argument")
+		}
+		return javaString(args[0]), nil
+	case "Double.parseDouble", "Float.parseFloat":
+		// Java ignores the leading and trailing whitespace
+		f, err := strconv.ParseFloat(strings.TrimSpace(arg(0)), 64)
+		if err != nil {
+			return nil, errors.Errorf("NumberFormatException: For input string: \"%s\"", arg(0))
+		}
+		return f, nil
+	case "Integer.parseInt", "Long.parseLong":
+		radix := 10
+		if len(args) > 1 {
+			if f, ok := args[1].(float64); ok {
+				radix = int(f)
+			}
+		}
+		bits := 64
+		if class == "Integer" {
+			bits = 32
+		}
+		n, err := strconv.ParseInt(arg(0), radix, bits)
+		if err != nil {
+			return nil, errors.Errorf("NumberFormatException: For input string: \"%s\"", arg(0))
+		}
+		return float64(n), nil
+	case "ZoneId.of":
+		loc, err := time.LoadLocation(arg(0))
+		if err != nil {
+			return nil, errors.Errorf("DateTimeException: unknown time-zone ID: %s", arg(0))
+		}
+		return loc, nil
+	case "ZonedDateTime.now":
+		if loc, ok := args[0].(*time.Location); ok {
+			return time.Now().In(loc), nil
+		}
+	case "ZonedDateTime.parse":
+		t, err := time.Parse(time.RFC3339Nano, arg(0))
+		if err != nil {
+			return nil, errors.Errorf("DateTimeParseException: Text '%s' could not be parsed", arg(0))
+		}
+		return t, nil
+	case "LocalDateTime.parse":
+		for _, layout := range []string{"2006-01-02T15:04:05.999999999", "2006-01-02T15:04"} {
+			if t, err := time.ParseInLocation(layout, arg(0), time.UTC); err == nil {
+				return localDateTime{t: t}, nil
+			}
+		}
+		return nil, errors.Errorf("DateTimeParseException: Text '%s' could not be parsed", arg(0))
+	case "Instant.ofEpochMilli":
+		if f, ok := args[0].(float64); ok {
+			return time.UnixMilli(int64(f)).UTC(), nil
+		}
+	case "Instant.ofEpochSecond":
+		if f, ok := args[0].(float64); ok {
+			return time.Unix(int64(f), 0).UTC(), nil
+		}
+	case "DateTimeFormatter.ofPattern":
+		return dateTimeFormatter{pattern: arg(0)}, nil
+	case "Base64.getEncoder":
+		return base64Encoder{}, nil
+	}
+	return nil, unsupported("method [%s.%s] is not supported", class, name)
+}
+
+// javaMethod calls the methods of the Java API that are not available on the documents values, ok is false if obj is
+// not one of them
+func javaMethod(obj interface{}, name string, args []interface{}) (v interface{}, ok bool, err error) {
+	arg := func(i int) interface{} {
+		if i < len(args) {
+			return args[i]
+		}
+		return nil
+	}
+
+	switch o := obj.(type) {
+	case float64:
+		switch name {
+		case "intValue", "longValue":
+			return math.Trunc(o), true, nil
+		case "doubleValue", "floatValue":
+			return o, true, nil
+		}
+
+	case mapEntry:
+		switch name {
+		case "getKey":
+			return o.key, true, nil
+		case "getValue":
+			return o.value, true, nil
+		}
+
+	case pRegex:
+		if name == "matcher" {
+			return &matcher{regex: o, input: valueToString(arg(0))}, true, nil
+		}
+
+	case *matcher:
+		switch name {
+		case "find":
+			if o.next > len(o.input) {
+				o.match = nil
+				return false, true, nil
+			}
+			o.match = o.regex.re.FindStringSubmatchIndex(o.input[o.next:])
+			if o.match == nil {
+				return false, true, nil
+			}
+			for i := range o.match {
+				if o.match[i] >= 0 {
+					o.match[i] += o.next
+				}
+			}
+			o.next = o.match[1]
+			if o.match[0] == o.match[1] {
+				o.next++
+			}
+			return true, true, nil
+		case "matches":
+			o.match = o.regex.whole.FindStringSubmatchIndex(o.input)
+			return o.match != nil, true, nil
+		case "group":
+			if o.match == nil {
+				return nil, true, errors.New("IllegalStateException: No match found")
+			}
+			group := 0
+			if f, ok := arg(0).(float64); ok {
+				group = int(f)
+			}
+			if group < 0 || 2*group+1 >= len(o.match) {
+				return nil, true, errors.Errorf("IndexOutOfBoundsException: No group %d", group)
+			}
+			if o.match[2*group] < 0 {
+				return nil, true, nil
+			}
+			return o.input[o.match[2*group]:o.match[2*group+1]], true, nil
+		case "replaceAll":
+			return o.regex.re.ReplaceAllString(o.input, javaReplacement(valueToString(arg(0)))), true, nil
+		}
+
+	case time.Time:
+		switch name {
+		case "atZone", "withZoneSameInstant":
+			if loc, ok := arg(0).(*time.Location); ok {
+				return o.In(loc), true, nil
+			}
+		case "toInstant":
+			return o.UTC(), true, nil
+		case "toEpochSecond":
+			return float64(o.Unix()), true, nil
+		case "toEpochMilli":
+			return float64(o.UnixMilli()), true, nil
+		case "format":
+			return formatDate(o, arg(0))
+		}
+
+	case localDateTime:
+		switch name {
+		case "atZone":
+			if loc, ok := arg(0).(*time.Location); ok {
+				return time.Date(o.t.Year(), o.t.Month(), o.t.Day(), o.t.Hour(), o.t.Minute(), o.t.Second(), o.t.Nanosecond(), loc), true, nil
+			}
+		case "format":
+			return formatDate(o.t, arg(0))
+		}
+
+	case base64Encoder:
+		if name == "encodeToString" {
+			l, ok := arg(0).([]interface{})
+			if !ok {
+				return nil, true, errors.Errorf("cannot encode %s", typeName(arg(0)))
+			}
+			b := make([]byte, len(l))
+			for i := range l {
+				f, _ := l[i].(float64)
+				b[i] = byte(int64(f))
+			}
+			return base64.StdEncoding.EncodeToString(b), true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func formatDate(t time.Time, formatter interface{}) (interface{}, bool, error) {
+	f, ok := formatter.(dateTimeFormatter)
+	if !ok {
+		return nil, true, errors.Errorf("cannot format a date with %s", typeName(formatter))
+	}
+	s, err := javatime.Format(f.pattern, t)
+	if err != nil {
+		return nil, true, unsupported("date format [%s] is not supported: %v", f.pattern, err)
+	}
+	return s, true, nil
+}
@@ -0,0 +1,639 @@
+package simulate
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // Date processors may refer to any timezone
+
+	"github.com/pkg/errors"
+
+	"github.com/herrBez/baffo/internal/app/transpile"
+	"github.com/herrBez/baffo/internal/csvline"
+	"github.com/herrBez/baffo/internal/dissect"
+	"github.com/herrBez/baffo/internal/javatime"
+)
+
+func isTrue(b *bool) bool {
+	return b != nil && *b
+}
+
+func targetOrField(field string, target *string) string {
+	if target != nil && *target != "" {
+		return *target
+	}
+	return field
+}
+
+// execute applies a single processor to the document
+func (e *execution) execute(p transpile.IngestProcessor) error {
+	switch ip := p.(type) {
+	case transpile.SetProcessor:
+		return e.set(ip)
+	case transpile.RemoveProcessor:
+		return e.remove(ip)
+	case transpile.RenameProcessor:
+		return e.rename(ip)
+	case transpile.AppendProcessor:
+		return e.append(ip)
+	case transpile.CaseProcessor:
+		f := strings.ToLower
+		if ip.Type == "uppercase" {
+			f = strings.ToUpper
+		}
+		return e.transformString(ip.Field, ip.TargetField, ip.IgnoreMissing, func(s string) (interface{}, error) {
+			return f(s), nil
+		})
+	case transpile.GsubProcessor:
+		re, err := regexp.Compile(ip.Pattern)
+		if err != nil {
+			return unsupported("gsub pattern [%s] is not supported: %v", ip.Pattern, err)
+		}
+		replacement := javaReplacement(ip.Replacement)
+		return e.transformString(ip.Field, ip.TargetField, ip.IgnoreMissing, func(s string) (interface{}, error) {
+			return re.ReplaceAllString(s, replacement), nil
+		})
+	case transpile.TrimProcessor:
+		return e.transformString(ip.Field, ip.TargetField, isTrue(ip.IgnoreMissing), func(s string) (interface{}, error) {
+			return strings.TrimSpace(s), nil
+		})
+	case transpile.URLDecodeProcessor:
+		return e.transformString(ip.Field, ip.TargetField, isTrue(ip.IgnoreMissing), func(s string) (interface{}, error) {
+			decoded, err := url.QueryUnescape(s)
+			if err != nil {
+				return nil, errors.Errorf("Could not URL-decode value: %v", err)
+			}
+			return decoded, nil
+		})
+	case transpile.SplitProcessor:
+		return e.split(ip)
+	case transpile.JoinProcessor:
+		return e.join(ip)
+	case transpile.ConvertProcessor:
+		return e.convert(ip)
+	case transpile.DropProcessor:
+		return errDropped
+	case transpile.PipelineProcessor:
+		return e.pipeline(ip)
+	case transpile.KVProcessor:
+		return e.kv(ip)
+	case transpile.DissectProcessor:
+		return e.dissect(ip)
+	case transpile.CSVProcessor:
+		return e.csv(ip)
+	case transpile.JSONProcessor:
+		return e.json(ip)
+	case transpile.DateProcessor:
+		return e.date(ip)
+	case transpile.ScriptProcessor:
+		if ip.Lang != nil && *ip.Lang != "painless" {
+			return unsupported("script language [%s] is not supported", *ip.Lang)
+		}
+		if ip.Source == nil {
+			return unsupported("stored scripts are not supported")
+		}
+		var params map[string]interface{}
+		if ip.Params != nil {
+			// The params are sent as JSON to Elasticsearch, e.g., the processors built by the transpiler hold Go slices
+			buf, err := json.Marshal(*ip.Params)
+			if err != nil {
+				return errors.Wrap(err, "invalid script params")
+			}
+			if err := json.Unmarshal(buf, &params); err != nil {
+				return errors.Wrap(err, "invalid script params")
+			}
+		}
+		return runScript(*ip.Source, params, e.doc)
+	}
+	return unsupported("processor [%s] is not supported by the simulator", p.IngestProcessorType())
+}
+
+// sourceValue returns the value of field, ok is false if the field is missing and ignoreMissing is set
+func (e *execution) sourceValue(field string, ignoreMissing bool) (interface{}, bool, error) {
+	v, found := getField(e.doc, field)
+	if found && v != nil {
+		return v, true, nil
+	}
+	if ignoreMissing {
+		return nil, false, nil
+	}
+	if !found {
+		parts := splitPath(field)
+		return nil, false, errors.Errorf("field [%s] not present as part of path [%s]", parts[len(parts)-1], field)
+	}
+	return nil, false, errors.Errorf("field [%s] is null, cannot process it.", field)
+}
+
+func (e *execution) render(s string) string {
+	return renderTemplate(s, e.doc, e.ingest)
+}
+
+// transformString applies f to a string field or to all the elements of a list of strings
+func (e *execution) transformString(field string, target *string, ignoreMissing bool, f func(string) (interface{}, error)) error {
+	v, ok, err := e.sourceValue(field, ignoreMissing)
+	if err != nil || !ok {
+		return err
+	}
+
+	var result interface{}
+	switch tv := v.(type) {
+	case string:
+		if result, err = f(tv); err != nil {
+			return err
+		}
+	case []interface{}:
+		l := make([]interface{}, len(tv))
+		for i, elem := range tv {
+			s, isString := elem.(string)
+			if !isString {
+				return errors.Errorf("value [%s] of type [%s] in list field [%s] cannot be cast to [java.lang.String]", valueToString(elem), typeName(elem), field)
+			}
+			if l[i], err = f(s); err != nil {
+				return err
+			}
+		}
+		result = l
+	default:
+		return errors.Errorf("field [%s] of type [%s] cannot be cast to [java.lang.String]", field, typeName(v))
+	}
+	return setField(e.doc, targetOrField(field, target), result)
+}
+
+// javaReplacement converts the group references of Java ($1) to the ones of Go (${1})
+var javaGroupReference = regexp.MustCompile(`\$(\d+)`)
+
+func javaReplacement(s string) string {
+	return javaGroupReference.ReplaceAllString(s, "$${$1}")
+}
+
+func (e *execution) set(ip transpile.SetProcessor) error {
+	field := e.render(ip.Field)
+
+	var value interface{}
+	if ip.CopyFrom != "" {
+		v, ok := getField(e.doc, ip.CopyFrom)
+		if !ok {
+			return errors.Errorf("field [%s] not present as part of path [%s]", ip.CopyFrom, ip.CopyFrom)
+		}
+		value = deepCopy(v)
+	} else {
+		value = renderValue(ip.Value, e.doc, e.ingest)
+	}
+
+	if ip.IgnoreEmptyValue && (value == nil || value == "") {
+		return nil
+	}
+	// override defaults to true
+	if ip.Override != nil && !*ip.Override {
+		if v, ok := getField(e.doc, field); ok && v != nil {
+			return nil
+		}
+	}
+	return setField(e.doc, field, value)
+}
+
+func (e *execution) remove(ip transpile.RemoveProcessor) error {
+	if len(ip.Keep) > 0 {
+		kept := Document{}
+		for _, f := range MetadataFields {
+			if v, ok := e.doc[f]; ok {
+				kept[f] = v
+			}
+		}
+		for _, f := range ip.Keep {
+			if v, ok := getField(e.doc, e.render(f)); ok {
+				if err := setField(kept, e.render(f), v); err != nil {
+					return err
+				}
+			}
+		}
+		for k := range e.doc {
+			delete(e.doc, k)
+		}
+		for k, v := range kept {
+			e.doc[k] = v
+		}
+		return nil
+	}
+
+	if ip.Field == nil {
+		return nil
+	}
+	for _, f := range *ip.Field {
+		field := e.render(f)
+		if !hasField(e.doc, field) {
+			if ip.IgnoreMissing {
+				continue
+			}
+		}
+		if err := removeField(e.doc, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *execution) rename(ip transpile.RenameProcessor) error {
+	field := e.render(ip.Field)
+	target := e.render(ip.TargetField)
+
+	v, ok := getField(e.doc, field)
+	if !ok {
+		if ip.IgnoreMissing {
+			return nil
+		}
+		return errors.Errorf("field [%s] doesn't exist", field)
+	}
+	if hasField(e.doc, target) {
+		return errors.Errorf("field [%s] already exists", target)
+	}
+	if err := removeField(e.doc, field); err != nil {
+		return err
+	}
+	return setField(e.doc, target, v)
+}
+
+func (e *execution) append(ip transpile.AppendProcessor) error {
+	field := e.render(ip.Field)
+	// allow_duplicates defaults to true
+	allowDuplicates := ip.AllowDuplicates == nil || *ip.AllowDuplicates
+
+	list := []interface{}{}
+	if v, ok := getField(e.doc, field); ok {
+		if l, isList := v.([]interface{}); isList {
+			list = l
+		} else {
+			list = append(list, v)
+		}
+	}
+
+	for _, value := range ip.Value {
+		rendered := e.render(value)
+		if !allowDuplicates {
+			duplicate := false
+			for _, elem := range list {
+				if painlessEquals(elem, rendered) {
+					duplicate = true
+					break
+				}
+			}
+			if duplicate {
+				continue
+			}
+		}
+		list = append(list, rendered)
+	}
+	return setField(e.doc, field, list)
+}
+
+func (e *execution) split(ip transpile.SplitProcessor) error {
+	v, ok, err := e.sourceValue(ip.Field, isTrue(ip.IgnoreMissing))
+	if err != nil || !ok {
+		return err
+	}
+	s, isString := v.(string)
+	if !isString {
+		return errors.Errorf("field [%s] of type [%s] cannot be cast to [java.lang.String]", ip.Field, typeName(v))
+	}
+	re, err := regexp.Compile(ip.Separator)
+	if err != nil {
+		return unsupported("split separator [%s] is not supported: %v", ip.Separator, err)
+	}
+
+	parts := re.Split(s, -1)
+	if !isTrue(ip.PreserveTrailing) {
+		for len(parts) > 1 && parts[len(parts)-1] == "" {
+			parts = parts[:len(parts)-1]
+		}
+	}
+	list := make([]interface{}, len(parts))
+	for i := range parts {
+		list[i] = parts[i]
+	}
+	return setField(e.doc, targetOrField(ip.Field, ip.TargetField), list)
+}
+
+func (e *execution) join(ip transpile.JoinProcessor) error {
+	v, ok, err := e.sourceValue(ip.Field, ip.IgnoreMissing)
+	if err != nil || !ok {
+		return err
+	}
+	l, isList := v.([]interface{})
+	if !isList {
+		return errors.Errorf("field [%s] of type [%s] cannot be cast to [java.util.List]", ip.Field, typeName(v))
+	}
+	parts := make([]string, len(l))
+	for i := range l {
+		parts[i] = valueToString(l[i])
+	}
+	return setField(e.doc, targetOrField(ip.Field, ip.TargetField), strings.Join(parts, ip.Separator))
+}
+
+func convertValue(v interface{}, convertType string) (interface{}, error) {
+	s := valueToString(v)
+	switch convertType {
+	case "integer", "long":
+		if f, ok := v.(float64); ok && f == math.Trunc(f) {
+			return f, nil
+		}
+		trimmed := strings.TrimPrefix(s, "-")
+		base := 10
+		if strings.HasPrefix(trimmed, "0x") || strings.HasPrefix(trimmed, "0X") {
+			base = 16
+			trimmed = trimmed[2:]
+		}
+		bits := 32
+		if convertType == "long" {
+			bits = 64
+		}
+		n, err := strconv.ParseInt(trimmed, base, bits)
+		if err != nil {
+			return nil, errors.Errorf("unable to convert [%s] to %s", s, convertType)
+		}
+		if strings.HasPrefix(s, "-") {
+			n = -n
+		}
+		return float64(n), nil
+	case "float", "double":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, errors.Errorf("unable to convert [%s] to %s", s, convertType)
+		}
+		return f, nil
+	case "boolean":
+		switch strings.ToLower(s) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, errors.Errorf("[%s] is not a boolean value, cannot convert to boolean", s)
+	case "string":
+		return s, nil
+	case "ip":
+		if net.ParseIP(s) == nil {
+			return nil, errors.Errorf("'%s' is not an IP string literal.", s)
+		}
+		return s, nil
+	case "auto":
+		if _, isString := v.(string); !isString {
+			return v, nil
+		}
+		for _, t := range []string{"long", "double", "boolean"} {
+			if converted, err := convertValue(v, t); err == nil {
+				return converted, nil
+			}
+		}
+		return v, nil
+	}
+	return nil, errors.Errorf("type [%s] not supported, cannot convert field.", convertType)
+}
+
+func (e *execution) convert(ip transpile.ConvertProcessor) error {
+	v, ok, err := e.sourceValue(ip.Field, isTrue(ip.IgnoreMissing))
+	if err != nil || !ok {
+		return err
+	}
+
+	var result interface{}
+	if l, isList := v.([]interface{}); isList {
+		converted := make([]interface{}, len(l))
+		for i := range l {
+			if converted[i], err = convertValue(l[i], ip.Type); err != nil {
+				return err
+			}
+		}
+		result = converted
+	} else if result, err = convertValue(v, ip.Type); err != nil {
+		return err
+	}
+	return setField(e.doc, targetOrField(ip.Field, ip.TargetField), result)
+}
+
+func (e *execution) pipeline(ip transpile.PipelineProcessor) error {
+	name := e.render(ip.Name)
+	if _, ok := e.simulator.pipelines[name]; !ok {
+		if isTrue(ip.IgnoreMissingPipeline) {
+			return nil
+		}
+		return errors.Errorf("Pipeline processor configured for non-existent pipeline [%s]", name)
+	}
+	return e.runPipeline(name)
+}
+
+var brackets = [][2]string{{"(", ")"}, {"<", ">"}, {"[", "]"}, {`"`, `"`}, {"'", "'"}}
+
+func stripBrackets(s string) string {
+	for _, b := range brackets {
+		if len(s) >= 2 && strings.HasPrefix(s, b[0]) && strings.HasSuffix(s, b[1]) {
+			return s[1 : len(s)-1]
+		}
+	}
+	return s
+}
+
+func (e *execution) kv(ip transpile.KVProcessor) error {
+	v, ok, err := e.sourceValue(ip.Field, ip.IgnoreMissing)
+	if err != nil || !ok {
+		return err
+	}
+	fieldSplit, err := regexp.Compile(ip.FieldSplit)
+	if err != nil {
+		return unsupported("kv field_split [%s] is not supported: %v", ip.FieldSplit, err)
+	}
+	if ip.ValueSplit == "" {
+		return errors.New("[value_split] required property is missing")
+	}
+	valueSplit, err := regexp.Compile(ip.ValueSplit)
+	if err != nil {
+		return unsupported("kv value_split [%s] is not supported: %v", ip.ValueSplit, err)
+	}
+
+	prefix := ""
+	if ip.Prefix != nil {
+		prefix = *ip.Prefix
+	}
+
+	for _, pair := range fieldSplit.Split(valueToString(v), -1) {
+		kv := valueSplit.Split(pair, 2)
+		if len(kv) != 2 {
+			return errors.Errorf("field [%s] does not contain value_split [%s]", ip.Field, ip.ValueSplit)
+		}
+		key, value := kv[0], kv[1]
+		if ip.TrimKey != nil {
+			key = strings.Trim(key, *ip.TrimKey)
+		}
+		if ip.TrimValue != nil {
+			value = strings.Trim(value, *ip.TrimValue)
+		}
+		if ip.StripBrackets {
+			value = stripBrackets(value)
+		}
+		if len(ip.IncludeKeys) > 0 && !contains(ip.IncludeKeys, key) || contains(ip.ExcludeKeys, key) {
+			continue
+		}
+
+		target := prefix + key
+		if ip.TargetField != nil && *ip.TargetField != "" {
+			target = *ip.TargetField + "." + target
+		}
+		// Repeated keys are collected in a list
+		if existing, found := getField(e.doc, target); found {
+			if l, isList := existing.([]interface{}); isList {
+				err = setField(e.doc, target, append(l, value))
+			} else {
+				err = setField(e.doc, target, []interface{}{existing, value})
+			}
+		} else {
+			err = setField(e.doc, target, value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *execution) dissect(ip transpile.DissectProcessor) error {
+	v, ok, err := e.sourceValue(ip.Field, ip.IgnoreMissing)
+	if err != nil || !ok {
+		return err
+	}
+	s, isString := v.(string)
+	if !isString {
+		return errors.Errorf("field [%s] of type [%s] cannot be cast to [java.lang.String]", ip.Field, typeName(v))
+	}
+	d, err := dissect.New(ip.Pattern)
+	if err != nil {
+		return err
+	}
+	separator := ""
+	if ip.AppendSeparator != nil {
+		separator = *ip.AppendSeparator
+	}
+	fields, err := d.Dissect(s, separator)
+	if err != nil {
+		return err
+	}
+	for k, value := range fields {
+		if err := setField(e.doc, k, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *execution) csv(ip transpile.CSVProcessor) error {
+	v, ok, err := e.sourceValue(ip.Field, isTrue(ip.IgnoreMissing))
+	if err != nil || !ok {
+		return err
+	}
+	separator, quote := ',', '"'
+	if ip.Separator != nil && *ip.Separator != "" {
+		separator = []rune(*ip.Separator)[0]
+	}
+	if ip.Quote != nil && *ip.Quote != "" {
+		quote = []rune(*ip.Quote)[0]
+	}
+
+	fields, err := csvline.Split(valueToString(v), separator, quote)
+	if err != nil {
+		return err
+	}
+	for i, target := range ip.TargetFields {
+		if i >= len(fields) {
+			break
+		}
+		value := fields[i]
+		if isTrue(ip.Trim) {
+			value = strings.TrimSpace(value)
+		}
+		if value == "" {
+			if ip.EmptyValue == nil {
+				continue
+			}
+			value = *ip.EmptyValue
+		}
+		if err := setField(e.doc, target, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *execution) json(ip transpile.JSONProcessor) error {
+	v, ok, err := e.sourceValue(ip.Field, isTrue(ip.IgnoreMissing))
+	if err != nil || !ok {
+		return err
+	}
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(valueToString(v)), &parsed); err != nil {
+		return errors.Errorf("Unable to parse JSON in field [%s]: %v", ip.Field, err)
+	}
+
+	if ip.AddToRoot {
+		m, isMap := parsed.(map[string]interface{})
+		if !isMap {
+			return errors.New("cannot add non-map fields to root of document")
+		}
+		for k, value := range m {
+			e.doc[k] = value
+		}
+		return nil
+	}
+	target := ip.Field
+	if ip.TargetField != "" {
+		target = ip.TargetField
+	}
+	return setField(e.doc, target, parsed)
+}
+
+func (e *execution) date(ip transpile.DateProcessor) error {
+	v, ok, err := e.sourceValue(ip.Field, ip.IgnoreMissing)
+	if err != nil || !ok {
+		return err
+	}
+
+	loc := time.UTC
+	if ip.Timezone != nil {
+		tz := e.render(*ip.Timezone)
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return errors.Errorf("The datetime zone id '%s' is not recognised", tz)
+		}
+	}
+
+	value := valueToString(v)
+	var parsed time.Time
+	var lastErr error = errors.Errorf("unable to parse date [%s]", value)
+	parsedOk := false
+	for _, format := range ip.Formats {
+		t, err := javatime.Parse(format, value, loc)
+		if err == nil {
+			parsed, parsedOk = t, true
+			break
+		}
+		lastErr = err
+	}
+	if !parsedOk {
+		return errors.Wrapf(lastErr, "unable to parse date [%s]", value)
+	}
+
+	outputFormat := javatime.DefaultOutputFormat
+	if ip.OutputFormat != nil {
+		outputFormat = *ip.OutputFormat
+	}
+	formatted, err := javatime.Format(outputFormat, parsed)
+	if err != nil {
+		return unsupported("date output_format [%s] is not supported: %v", outputFormat, err)
+	}
+	target := "@timestamp"
+	if ip.TargetField != nil {
+		target = e.render(*ip.TargetField)
+	}
+	return setField(e.doc, target, formatted)
+}
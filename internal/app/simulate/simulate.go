@@ -0,0 +1,120 @@
+package simulate
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+
+	"github.com/herrBez/baffo/internal/app/transpile"
+	"github.com/herrBez/baffo/internal/format"
+)
+
+type Simulate struct {
+	docs     string
+	pipeline string
+}
+
+func New(docs string, pipeline string) Simulate {
+	return Simulate{
+		docs:     docs,
+		pipeline: pipeline,
+	}
+}
+
+// ReadDocuments reads a file with one JSON document per line (NDJSON), empty lines are ignored
+func ReadDocuments(filename string) ([]Document, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	docs := []Document{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var doc Document
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			return nil, errors.Errorf("%s:%d: %v", filename, line, err)
+		}
+		docs = append(docs, doc)
+	}
+	return docs, scanner.Err()
+}
+
+// ReadPipelines reads the pipelines from a file produced by the transpile command or containing a single pipeline
+func ReadPipelines(filename string) ([]transpile.IngestPipeline, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	ips, err := transpile.DecodeIngestPipelines(name, data)
+	if err != nil {
+		return nil, errors.Errorf("%s: %v", filename, err)
+	}
+	if len(ips) == 0 {
+		return nil, errors.Errorf("%s: no pipeline found", filename)
+	}
+	return ips, nil
+}
+
+func (s Simulate) Run(args []string) error {
+	var result *multierror.Error
+
+	if s.docs == "" {
+		return errors.New("the documents to simulate must be provided with --docs")
+	}
+	docs, err := ReadDocuments(s.docs)
+	if err != nil {
+		return err
+	}
+
+	// The results are keyed by pipeline file, so that the documents of each pipeline can be told apart
+	results := map[string]interface{}{}
+	for _, filename := range args {
+		ips, err := ReadPipelines(filename)
+		if err != nil {
+			result = multierror.Append(result, err)
+			continue
+		}
+
+		name := s.pipeline
+		if name == "" {
+			name = ips[0].Name
+		}
+		simulator := NewSimulator(ips)
+		fileResults := []Result{}
+		for _, doc := range docs {
+			fileResults = append(fileResults, simulator.Simulate(name, doc))
+		}
+		results[filename] = map[string]interface{}{
+			"pipeline": name,
+			"docs":     fileResults,
+		}
+	}
+
+	buf, err := transpile.MyJsonEncode(results)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(buf))
+
+	if result != nil {
+		result.ErrorFormat = format.MultiErr
+		return result
+	}
+
+	return nil
+}
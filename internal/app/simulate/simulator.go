@@ -0,0 +1,202 @@
+package simulate
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+
+	"github.com/herrBez/baffo/internal/app/transpile"
+)
+
+// Trace describes a failure that has been handled by an on_failure block or a processor that was skipped
+type Trace struct {
+	Pipeline      string `json:"pipeline"`
+	ProcessorType string `json:"processor_type"`
+	ProcessorTag  string `json:"processor_tag,omitempty"`
+	Message       string `json:"message"`
+}
+
+// Result is the outcome of the execution of a pipeline on a single document
+type Result struct {
+	Doc     Document `json:"doc,omitempty"`
+	Dropped bool     `json:"dropped,omitempty"`
+	Error   *Trace   `json:"error,omitempty"`
+	Traces  []Trace  `json:"on_failure_traces,omitempty"`
+	Skipped []Trace  `json:"skipped_processors,omitempty"`
+}
+
+// Simulator executes Ingest Pipelines in-process, without an Elasticsearch cluster.
+// Processors (or Painless constructs) that are not supported are skipped and reported in the Result.
+type Simulator struct {
+	pipelines map[string]transpile.IngestPipeline
+}
+
+const maxPipelineDepth = 100
+
+var errDropped = errors.New("document dropped")
+
+// processorError is the failure of a processor, it keeps the information exposed in the _ingest metadata
+type processorError struct {
+	trace Trace
+}
+
+func (e processorError) Error() string {
+	return e.trace.Message
+}
+
+func NewSimulator(pipelines []transpile.IngestPipeline) Simulator {
+	s := Simulator{pipelines: map[string]transpile.IngestPipeline{}}
+	for _, ip := range pipelines {
+		s.register(ip)
+	}
+	return s
+}
+
+// register adds the pipeline and the pipelines referenced inline by pipeline processors
+func (s Simulator) register(ip transpile.IngestPipeline) {
+	s.pipelines[ip.Name] = ip
+	for _, processors := range [][]transpile.IngestProcessor{ip.Processors, ip.OnFailureProcessors} {
+		for _, p := range processors {
+			if pp, ok := p.(transpile.PipelineProcessor); ok && pp.Pipeline != nil {
+				if _, known := s.pipelines[pp.Pipeline.Name]; !known {
+					s.register(*pp.Pipeline)
+				}
+			}
+		}
+	}
+}
+
+// Simulate runs the pipeline with the given name on a copy of doc
+func (s Simulator) Simulate(name string, doc Document) Result {
+	e := &execution{
+		simulator: s,
+		doc:       deepCopy(doc).(Document),
+		ingest:    map[string]interface{}{},
+	}
+
+	err := e.runPipeline(name)
+	result := Result{Traces: e.traces, Skipped: e.skipped}
+
+	switch {
+	case err == errDropped:
+		result.Dropped = true
+	case err != nil:
+		if pe, ok := err.(processorError); ok {
+			result.Error = &pe.trace
+		} else {
+			result.Error = &Trace{Pipeline: name, Message: err.Error()}
+		}
+	default:
+		result.Doc = e.doc
+	}
+	return result
+}
+
+type execution struct {
+	simulator Simulator
+	doc       Document
+	ingest    map[string]interface{}
+	traces    []Trace
+	skipped   []Trace
+	depth     int
+}
+
+func (e *execution) runPipeline(name string) error {
+	ip, ok := e.simulator.pipelines[name]
+	if !ok {
+		return errors.Errorf("pipeline with id [%s] does not exist", name)
+	}
+	if e.depth >= maxPipelineDepth {
+		return errors.Errorf("Cycle detected for pipeline: %s", name)
+	}
+	e.depth++
+	defer func() { e.depth-- }()
+
+	err := e.runProcessors(name, ip.Processors)
+	if err == nil || err == errDropped || len(ip.OnFailureProcessors) == 0 {
+		return err
+	}
+	e.handleFailure(err)
+	return e.runProcessors(name, ip.OnFailureProcessors)
+}
+
+func (e *execution) runProcessors(pipeline string, processors []transpile.IngestProcessor) error {
+	for _, p := range processors {
+		if err := e.runProcessor(pipeline, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *execution) runProcessor(pipeline string, p transpile.IngestProcessor) error {
+	cf, ok := p.(transpile.CF)
+	if !ok {
+		e.skipped = append(e.skipped, Trace{Pipeline: pipeline, ProcessorType: p.IngestProcessorType(), Message: unsupported("processor [%s] does not expose its common fields", p.IngestProcessorType()).Error()})
+		return nil
+	}
+	trace := Trace{Pipeline: pipeline, ProcessorType: p.IngestProcessorType(), ProcessorTag: cf.GetTagOrDefault("")}
+
+	var err error
+	if cond := cf.GetIf(); cond != nil {
+		var ok bool
+		ok, err = evalCondition(*cond, e.doc)
+		if err == nil && !ok {
+			return nil
+		}
+	}
+	if err == nil {
+		err = e.execute(p)
+	}
+
+	if err == nil || err == errDropped {
+		return err
+	}
+	if _, ok := err.(UnsupportedError); ok {
+		trace.Message = err.Error()
+		e.skipped = append(e.skipped, trace)
+		return nil
+	}
+	if ignoreFailure(p) {
+		return nil
+	}
+
+	// Failures of nested pipelines keep the information about the processor that failed
+	pe, ok := err.(processorError)
+	if !ok {
+		trace.Message = err.Error()
+		pe = processorError{trace: trace}
+	}
+	if len(cf.GetOnFailure()) == 0 {
+		return pe
+	}
+	e.handleFailure(pe)
+	return e.runProcessors(pipeline, cf.GetOnFailure())
+}
+
+// handleFailure exposes the failure in the _ingest metadata as done by Elasticsearch
+func (e *execution) handleFailure(err error) {
+	pe, ok := err.(processorError)
+	if !ok {
+		pe = processorError{trace: Trace{Message: err.Error()}}
+	}
+	e.ingest["on_failure_message"] = pe.trace.Message
+	e.ingest["on_failure_processor_type"] = pe.trace.ProcessorType
+	e.ingest["on_failure_processor_tag"] = pe.trace.ProcessorTag
+	e.ingest["on_failure_pipeline"] = pe.trace.Pipeline
+	e.traces = append(e.traces, pe.trace)
+}
+
+// ignoreFailure reads the ignore_failure option, which is either a bool or a *bool depending on the processor
+func ignoreFailure(p transpile.IngestProcessor) bool {
+	f := reflect.ValueOf(p).FieldByName("IgnoreFailure")
+	switch {
+	case !f.IsValid():
+		return false
+	case f.Kind() == reflect.Bool:
+		return f.Bool()
+	case f.Kind() == reflect.Pointer && !f.IsNil():
+		return f.Elem().Bool()
+	}
+	return false
+}
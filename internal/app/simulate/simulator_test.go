@@ -0,0 +1,330 @@
+package simulate
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"testing"
+
+	config "github.com/herrBez/baffo"
+	ast "github.com/herrBez/baffo/ast"
+	"github.com/herrBez/baffo/internal/app/transpile"
+)
+
+func TestSimulate(t *testing.T) {
+	tt := []struct {
+		name     string
+		pipeline string
+		doc      string
+		want     string
+	}{
+		{
+			name:     "set, override and templates",
+			pipeline: `{"processors": [{"set": {"field": "a", "value": "{{b}}-x"}}, {"set": {"field": "b", "value": "y", "override": false}}, {"set": {"field": "c.d", "value": 1}}]}`,
+			doc:      `{"b": "z"}`,
+			want:     `{"doc": {"a": "z-x", "b": "z", "c": {"d": 1}}}`,
+		},
+		{
+			name:     "if condition",
+			pipeline: `{"processors": [{"set": {"if": "ctx?.a != null && ctx.a == 'x'", "field": "matched", "value": true}}]}`,
+			doc:      `{"a": "y"}`,
+			want:     `{"doc": {"a": "y"}}`,
+		},
+		{
+			name:     "remove, rename and append",
+			pipeline: `{"processors": [{"remove": {"field": "a"}}, {"rename": {"field": "b", "target_field": "c"}}, {"append": {"field": "tags", "value": ["t1", "t2"]}}]}`,
+			doc:      `{"a": 1, "b": 2, "tags": "t0"}`,
+			want:     `{"doc": {"c": 2, "tags": ["t0", "t1", "t2"]}}`,
+		},
+		{
+			name:     "processor on_failure",
+			pipeline: `{"processors": [{"rename": {"field": "missing", "target_field": "c", "tag": "r1", "on_failure": [{"append": {"field": "error", "value": "{{ _ingest.on_failure_processor_tag }}"}}]}}]}`,
+			doc:      `{}`,
+			want:     `{"doc": {"error": ["r1"]}, "on_failure_traces": [{"pipeline": "test", "processor_type": "rename", "processor_tag": "r1", "message": "field [missing] doesn't exist"}]}`,
+		},
+		{
+			name:     "unhandled failure",
+			pipeline: `{"processors": [{"lowercase": {"field": "missing"}}]}`,
+			doc:      `{}`,
+			want:     `{"error": {"pipeline": "test", "processor_type": "lowercase", "message": "field [missing] not present as part of path [missing]"}}`,
+		},
+		{
+			name:     "ignore_failure",
+			pipeline: `{"processors": [{"lowercase": {"field": "missing", "ignore_failure": true}}, {"uppercase": {"field": "a"}}]}`,
+			doc:      `{"a": ["x", "y"]}`,
+			want:     `{"doc": {"a": ["X", "Y"]}}`,
+		},
+		{
+			name:     "drop",
+			pipeline: `{"processors": [{"drop": {"if": "ctx.a == 1"}}]}`,
+			doc:      `{"a": 1}`,
+			want:     `{"dropped": true}`,
+		},
+		{
+			name:     "gsub, split, join and trim",
+			pipeline: `{"processors": [{"gsub": {"field": "a", "pattern": "(\\d+)", "replacement": "<$1>"}}, {"split": {"field": "b", "separator": ","}}, {"join": {"field": "c", "separator": "-"}}, {"trim": {"field": "d"}}]}`,
+			doc:      `{"a": "x12y", "b": "1,2,,", "c": ["u", "v"], "d": "  w "}`,
+			want:     `{"doc": {"a": "x<12>y", "b": ["1", "2"], "c": "u-v", "d": "w"}}`,
+		},
+		{
+			name:     "convert",
+			pipeline: `{"processors": [{"convert": {"field": "a", "type": "integer"}}, {"convert": {"field": "b", "type": "boolean"}}, {"convert": {"field": "c", "type": "string"}}, {"convert": {"field": "d", "type": "auto"}}]}`,
+			doc:      `{"a": "42", "b": "TRUE", "c": 1.5, "d": "2.5"}`,
+			want:     `{"doc": {"a": 42, "b": true, "c": "1.5", "d": 2.5}}`,
+		},
+		{
+			name:     "kv",
+			pipeline: `{"processors": [{"kv": {"field": "message", "field_split": "&", "value_split": "=", "target_field": "kv", "exclude_keys": ["c"]}}]}`,
+			doc:      `{"message": "a=1&b=2&c=3&a=4"}`,
+			want:     `{"doc": {"message": "a=1&b=2&c=3&a=4", "kv": {"a": ["1", "4"], "b": "2"}}}`,
+		},
+		{
+			name:     "dissect",
+			pipeline: `{"processors": [{"dissect": {"field": "message", "pattern": "%{ts} %{+ts} %{?skip} [%{level}] %{msg}"}}]}`,
+			doc:      `{"message": "2024-01-01 10:00:00 x [INFO] hello world"}`,
+			want:     `{"doc": {"message": "2024-01-01 10:00:00 x [INFO] hello world", "ts": "2024-01-0110:00:00", "level": "INFO", "msg": "hello world"}}`,
+		},
+		{
+			name:     "csv and json",
+			pipeline: `{"processors": [{"csv": {"field": "line", "target_fields": ["a", "b", "c"]}}, {"json": {"field": "j", "add_to_root": true}}]}`,
+			doc:      `{"line": "1,\"x,y\",", "j": "{\"k\": [1, 2]}"}`,
+			want:     `{"doc": {"line": "1,\"x,y\",", "j": "{\"k\": [1, 2]}", "a": "1", "b": "x,y", "k": [1, 2]}}`,
+		},
+		{
+			name:     "urldecode and date",
+			pipeline: `{"processors": [{"urldecode": {"field": "u"}}, {"date": {"field": "d", "formats": ["dd/MMM/yyyy:HH:mm:ss Z"]}}]}`,
+			doc:      `{"u": "a%20b", "d": "10/Oct/2000:13:55:36 -0700"}`,
+			want:     `{"doc": {"u": "a b", "d": "10/Oct/2000:13:55:36 -0700", "@timestamp": "2000-10-10T13:55:36.000-07:00"}}`,
+		},
+		{
+			name:     "script",
+			pipeline: `{"processors": [{"script": {"source": "if (ctx.tags instanceof List) { ctx.tags.removeIf(t -> t == params.tag) } field('n').set(ctx.tags.size());", "params": {"tag": "a"}}}]}`,
+			doc:      `{"tags": ["a", "b", "a"]}`,
+			want:     `{"doc": {"tags": ["b"], "n": 1}}`,
+		},
+		{
+			name:     "unsupported processors are skipped",
+			pipeline: `{"processors": [{"grok": {"field": "message", "patterns": ["%{WORD:w}"]}}]}`,
+			doc:      `{"message": "x"}`,
+			want:     `{"doc": {"message": "x"}, "skipped_processors": [{"pipeline": "test", "processor_type": "grok", "message": "processor [grok] is not supported by the simulator"}]}`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ips, err := transpile.DecodeIngestPipelines("test", []byte(tc.pipeline))
+			if err != nil {
+				t.Fatalf("could not decode the pipeline: %v", err)
+			}
+			var doc Document
+			if err := json.Unmarshal([]byte(tc.doc), &doc); err != nil {
+				t.Fatal(err)
+			}
+
+			result := NewSimulator(ips).Simulate("test", doc)
+
+			got, _ := json.Marshal(result)
+			var gotValue, wantValue interface{}
+			_ = json.Unmarshal(got, &gotValue)
+			if err := json.Unmarshal([]byte(tc.want), &wantValue); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotValue, wantValue) {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSimulatePipelineProcessor(t *testing.T) {
+	ips, err := transpile.DecodeIngestPipelines("", []byte(`{
+		"main-pipeline-test": {"processors": [{"pipeline": {"name": "child"}}, {"set": {"field": "after", "value": true}}]},
+		"child": {"processors": [{"set": {"field": "child", "value": "{{a}}"}}, {"fail": {"message": "x"}}], "on_failure": [{"set": {"field": "failed", "value": true}}]}
+	}`))
+	if err == nil {
+		t.Fatalf("expected an error for the unknown processor fail, got %v", ips)
+	}
+
+	ips, err = transpile.DecodeIngestPipelines("", []byte(`{
+		"main-pipeline-test": {"processors": [{"pipeline": {"name": "child"}}, {"set": {"field": "after", "value": true}}]},
+		"child": {"processors": [{"set": {"field": "child", "value": "{{a}}"}}, {"rename": {"field": "missing", "target_field": "x"}}], "on_failure": [{"set": {"field": "failed", "value": "{{ _ingest.on_failure_pipeline }}"}}]}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ips[0].Name != "main-pipeline-test" {
+		t.Errorf("expected the main pipeline first, got %s", ips[0].Name)
+	}
+
+	result := NewSimulator(ips).Simulate(ips[0].Name, Document{"a": "v"})
+	want := Document{"a": "v", "child": "v", "failed": "child", "after": true}
+	if !reflect.DeepEqual(result.Doc, want) {
+		t.Errorf("got %v, want %v", result.Doc, want)
+	}
+}
+
+func TestSimulateTranspiledTruncate(t *testing.T) {
+	res, err := config.Parse("test.conf", []byte(`filter { truncate { length_bytes => 5 } }`))
+	if err != nil {
+		t.Fatalf("could not parse the filter: %v", err)
+	}
+	ips := transpile.New(transpile.Options{Threshold: 1, LogLevel: "error", DealWithErrorLocally: true, Fidelity: true, AddCleanupProcessor: true}).BuildIngestPipelines("test.conf", res.(ast.Config))
+
+	var doc Document
+	if err := json.Unmarshal([]byte(`{"@timestamp": "2024-01-01T00:00:00.000Z", "message": "héllo world", "tags": ["abcdefgh"], "n": 123456789, "nested": {"s": "abcdefgh"}}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	result := NewSimulator(ips).Simulate(ips[0].Name, doc)
+	if result.Error != nil || len(result.Skipped) > 0 {
+		t.Fatalf("the script could not be simulated: %v %v", result.Error, result.Skipped)
+	}
+	want := Document{
+		"@timestamp": "2024-01-01T00:00:00.000Z",
+		"message":    "héll",
+		"tags":       []interface{}{"abcde"},
+		"n":          float64(123456789),
+		"nested":     map[string]interface{}{"s": "abcdefgh"},
+	}
+	if !reflect.DeepEqual(result.Doc, want) {
+		t.Errorf("got %v, want %v", result.Doc, want)
+	}
+}
+
+// processorWithoutCommonFields does not implement transpile.CF
+type processorWithoutCommonFields struct{}
+
+func (p processorWithoutCommonFields) String() string              { return "custom" }
+func (p processorWithoutCommonFields) IngestProcessorType() string { return "custom" }
+func (p processorWithoutCommonFields) WithIf(s *string, append bool) transpile.IngestProcessor {
+	return p
+}
+func (p processorWithoutCommonFields) WithTag(s string) transpile.IngestProcessor { return p }
+func (p processorWithoutCommonFields) WithOnFailure(s []transpile.IngestProcessor) transpile.IngestProcessor {
+	return p
+}
+func (p processorWithoutCommonFields) WithDescription(s string) transpile.IngestProcessor { return p }
+
+func TestSimulateProcessorWithoutCommonFields(t *testing.T) {
+	ips := []transpile.IngestPipeline{{Name: "main", Processors: []transpile.IngestProcessor{processorWithoutCommonFields{}}}}
+
+	result := NewSimulator(ips).Simulate("main", Document{"a": "v"})
+	if result.Error != nil {
+		t.Fatalf("unexpected error: %v", result.Error)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0].ProcessorType != "custom" {
+		t.Errorf("expected the processor to be skipped, got %v", result.Skipped)
+	}
+}
+
+func TestSimulateTranspiledScripts(t *testing.T) {
+	tt := []struct {
+		name   string
+		filter string
+		event  string
+		want   string
+	}{
+		{
+			name:   "kv transform_key",
+			filter: `kv { source => "m" transform_key => "uppercase" }`,
+			event:  `{"m": "a-b=1 c=2"}`,
+			want:   `{"m": "a-b=1 c=2", "A-B": "1", "C": "2"}`,
+		},
+		{
+			name:   "kv remove_char_key",
+			filter: `kv { source => "m" remove_char_key => "-" }`,
+			event:  `{"m": "a-b=1"}`,
+			want:   `{"m": "a-b=1", "ab": "1"}`,
+		},
+		{
+			name:   "fingerprint SHA256",
+			filter: `fingerprint { source => ["a"] method => "SHA256" }`,
+			event:  `{"a": "x.y"}`,
+			want:   `{"a": "x.y", "event": {"hash": "b24ca9b75eb7b75775b5fdd41e0ef5cfbb6d233fcf305df9d3d5b347bb3b8ca8"}}`,
+		},
+		{
+			name:   "fingerprint SHA1 base64",
+			filter: `fingerprint { source => ["a"] method => "SHA1" base64encode => true }`,
+			event:  `{"a": "x.y"}`,
+			want:   `{"a": "x.y", "event": {"hash": "CuTKRGaecfX2/bf63wzZFm1rgPs="}}`,
+		},
+		{
+			name:   "fingerprint PUNCTUATION",
+			filter: `fingerprint { source => ["a"] method => "PUNCTUATION" }`,
+			event:  `{"a": "Hello, world!"}`,
+			want:   `{"a": "Hello, world!", "event": {"hash": ",!"}}`,
+		},
+		{
+			name:   "fingerprint PUNCTUATION with concatenate_sources",
+			filter: `fingerprint { source => ["b", "a"] method => "PUNCTUATION" concatenate_sources => true }`,
+			event:  `{"a": "x!", "b": "y?"}`,
+			want:   `{"a": "x!", "b": "y?", "event": {"hash": "?"}}`,
+		},
+		{
+			name:   "de_dot nested",
+			filter: `de_dot { nested => true }`,
+			event:  `{"a.b.c": 1, "d": "x"}`,
+			want:   `{"a": {"b": {"c": 1}}, "d": "x"}`,
+		},
+		{
+			name:   "mutate convert integer_eu",
+			filter: `mutate { convert => { "n" => "integer_eu" "l" => "integer_eu" } }`,
+			event:  `{"n": "1.234,5", "l": ["2,9", 3]}`,
+			want:   `{"n": 1234, "l": [2, 3]}`,
+		},
+		{
+			name:   "mutate convert text that is not a number and booleans with spaces",
+			filter: `mutate { convert => { "n" => "integer_eu" "f" => "float_eu" "x" => "float_eu" "b" => "boolean" } }`,
+			event:  `{"n": "12abc", "f": " 1,5e2 kg", "x": "abc", "b": " true"}`,
+			want:   `{"n": 12, "f": 150, "x": 0, "b": " true"}`,
+		},
+		{
+			name:   "sprintf timestamp",
+			filter: `mutate { add_field => { "y" => "%{+YYYY}-%{+MM}" } }`,
+			event:  `{"@timestamp": "2024-03-01T10:00:00.000Z"}`,
+			want:   `{"@timestamp": "2024-03-01T10:00:00.000Z", "y": "2024-03"}`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := config.Parse("test.conf", []byte("filter { "+tc.filter+" }"))
+			if err != nil {
+				t.Fatalf("could not parse the filter: %v", err)
+			}
+			ips := transpile.New(transpile.Options{Threshold: 100, LogLevel: "error", DealWithErrorLocally: true, Fidelity: true, AddCleanupProcessor: true}).BuildIngestPipelines("test.conf", res.(ast.Config))
+
+			var doc, want Document
+			if err := json.Unmarshal([]byte(tc.event), &doc); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tc.want), &want); err != nil {
+				t.Fatal(err)
+			}
+
+			result := NewSimulator(ips).Simulate(ips[0].Name, doc)
+			if result.Error != nil || len(result.Skipped) > 0 {
+				t.Fatalf("the scripts could not be simulated: %v %v", result.Error, result.Skipped)
+			}
+			if !reflect.DeepEqual(result.Doc, want) {
+				t.Errorf("got %v, want %v", result.Doc, want)
+			}
+		})
+	}
+}
+
+func TestSimulateTranspiledUUID(t *testing.T) {
+	res, err := config.Parse("test.conf", []byte(`filter { uuid { target => "u" } }`))
+	if err != nil {
+		t.Fatalf("could not parse the filter: %v", err)
+	}
+	ips := transpile.New(transpile.Options{Threshold: 100, LogLevel: "error"}).BuildIngestPipelines("test.conf", res.(ast.Config))
+
+	result := NewSimulator(ips).Simulate(ips[0].Name, Document{})
+	if result.Error != nil || len(result.Skipped) > 0 {
+		t.Fatalf("the script could not be simulated: %v %v", result.Error, result.Skipped)
+	}
+	if u, _ := result.Doc["u"].(string); !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(u) {
+		t.Errorf("want a random UUID, got %v", result.Doc)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/herrBez/baffo/internal/app/transpile"
+	"github.com/herrBez/baffo/internal/app/verify"
 )
 
 func makeTranspileCmd() *cobra.Command {
@@ -20,6 +21,13 @@ func makeTranspileCmd() *cobra.Command {
 	cmd.Flags().Bool("add_default_global_on_failure", false, "whether to add a default global on failure")
 	cmd.Flags().Bool("fidelity", true, "try to keep correct if-else semantic")
 	cmd.Flags().Bool("add_cleanup_processor", true, "add a cleanup processor to remove temporary fields created by the transpiler")
+	cmd.Flags().String("output_format", "json", "format of the pipelines: json (a dictionary of pipelines), devtools (Kibana Dev Tools requests) ndjson-bulk (one pipeline per line) or yaml")
+	cmd.Flags().String("output_dir", "", "write each pipeline to its own file in the given directory, together with a manifest, instead of printing them")
+	cmd.Flags().String("coverage_report", "", "instead of printing the pipelines, report how much of each plugin has been transpiled, text or json")
+	cmd.Flags().Bool("strict", false, "fail if a plugin or an attribute cannot be fully transpiled or a file cannot be parsed")
+	cmd.Flags().Int("translate_enrich_threshold", 0, "look up the translate dictionaries with more entries than the threshold with an enrich processor instead of a script, 0 to disable")
+	cmd.Flags().String("verify", "", "file with sample events, one JSON event per line, used to compare the Logstash filters with the generated Ingest Pipelines instead of printing them")
+	cmd.Flags().String("verify_format", "text", "format of the verify report, text or json")
 
 	return cmd
 }
@@ -31,6 +39,28 @@ func runTranspile(cmd *cobra.Command, args []string) error {
 	add_default_global_on_failure, _ := cmd.Flags().GetBool("add_default_global_on_failure")
 	fidelity, _ := cmd.Flags().GetBool("fidelity")
 	add_cleanup_processor, _ := cmd.Flags().GetBool("add_cleanup_processor")
-	check := transpile.New(threshold, log_level, deal_with_error_locally, add_default_global_on_failure, fidelity, add_cleanup_processor)
+	coverage_report, _ := cmd.Flags().GetString("coverage_report")
+	strict, _ := cmd.Flags().GetBool("strict")
+	output_format, _ := cmd.Flags().GetString("output_format")
+	output_dir, _ := cmd.Flags().GetString("output_dir")
+	translate_enrich_threshold, _ := cmd.Flags().GetInt("translate_enrich_threshold")
+	events, _ := cmd.Flags().GetString("verify")
+	verify_format, _ := cmd.Flags().GetString("verify_format")
+	check := transpile.New(transpile.Options{
+		Threshold:                 threshold,
+		LogLevel:                  log_level,
+		DealWithErrorLocally:      deal_with_error_locally,
+		AddDefaultGlobalOnFailure: add_default_global_on_failure,
+		Fidelity:                  fidelity,
+		AddCleanupProcessor:       add_cleanup_processor,
+		CoverageReport:            coverage_report,
+		Strict:                    strict,
+		OutputFormat:              output_format,
+		OutputDir:                 output_dir,
+		TranslateEnrichThreshold:  translate_enrich_threshold,
+	})
+	if events != "" {
+		return verify.New(check, events, verify_format).Run(args)
+	}
 	return check.Run(args)
 }
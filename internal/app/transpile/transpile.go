@@ -4,6 +4,7 @@ import (
 	"os"
 	"path"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,6 +19,7 @@ import (
 	"github.com/pkg/errors"
 
 	"reflect"
+	"sort"
 
 	config "github.com/herrBez/baffo"
 	"github.com/herrBez/baffo/internal/format"
@@ -36,16 +38,49 @@ type Transpile struct {
 	addDefaultGlobalOnFailure bool
 	fidelity                  bool
 	addCleanUpProcessor       bool
+	coverageReport            string
+	strict                    bool
+	outputFormat              string
+	outputDir                 string
+	coverage                  *coverageRecorder
+	configFile                string
+	translateEnrichThreshold  int
+	enrichPolicies            *[]EnrichPolicy
 }
 
-func New(threshold int, log_level string, deal_with_error_locally bool, addDefaultGlobalOnFailure bool, fidelity bool, addCleanupProcessor bool) Transpile {
+// Options are the settings of the transpilation, the zero value of OutputFormat is OutputFormatJSON
+type Options struct {
+	Threshold                 int
+	LogLevel                  string
+	DealWithErrorLocally      bool
+	AddDefaultGlobalOnFailure bool
+	Fidelity                  bool
+	AddCleanupProcessor       bool
+	CoverageReport            string
+	Strict                    bool
+	OutputFormat              string
+	OutputDir                 string
+	TranslateEnrichThreshold  int
+}
+
+func New(opts Options) Transpile {
+	if opts.OutputFormat == "" {
+		opts.OutputFormat = OutputFormatJSON
+	}
 	return Transpile{
-		threshold:                 threshold,
-		log_level:                 level[strings.ToLower(log_level)],
-		deal_with_error_locally:   deal_with_error_locally,
-		addDefaultGlobalOnFailure: addDefaultGlobalOnFailure,
-		fidelity:                  fidelity,
-		addCleanUpProcessor:       addCleanupProcessor,
+		threshold:                 opts.Threshold,
+		log_level:                 level[strings.ToLower(opts.LogLevel)],
+		deal_with_error_locally:   opts.DealWithErrorLocally,
+		addDefaultGlobalOnFailure: opts.AddDefaultGlobalOnFailure,
+		fidelity:                  opts.Fidelity,
+		addCleanUpProcessor:       opts.AddCleanupProcessor,
+		coverageReport:            opts.CoverageReport,
+		strict:                    opts.Strict,
+		outputFormat:              opts.OutputFormat,
+		outputDir:                 opts.OutputDir,
+		coverage:                  newCoverageRecorder(),
+		translateEnrichThreshold:  opts.TranslateEnrichThreshold,
+		enrichPolicies:            &[]EnrichPolicy{},
 	}
 }
 
@@ -58,13 +93,36 @@ var level = map[string]zerolog.Level{
 	"error":       zerolog.ErrorLevel,
 }
 
-func (t Transpile) Run(args []string) error {
+// InitLogger sets up the logger used to report the warnings of the transpilation
+func (t Transpile) InitLogger() {
 	logger := ecszerolog.New(os.Stderr)
 	log.Logger = logger
 	zerolog.SetGlobalLevel(t.log_level)
+}
+
+func (t Transpile) Run(args []string) error {
+	t.InitLogger()
 
 	var result *multierror.Error
 	ips := []IngestPipeline{}
+	coverages := []FileCoverage{}
+	manifest := Manifest{Pipelines: []ManifestEntry{}}
+
+	switch t.coverageReport {
+	case "", "text", "json":
+	default:
+		return errors.Errorf("unknown coverage report format %q, expected text or json", t.coverageReport)
+	}
+	if err := checkOutputFormat(t.outputFormat); err != nil {
+		return err
+	}
+	if t.outputDir != "" && t.outputFormat != OutputFormatJSON && t.outputFormat != OutputFormatYAML {
+		return errors.Errorf("the output format %s cannot be used with an output directory", t.outputFormat)
+	}
+	// The pipelines would refer to enrich policies that are never emitted
+	if t.translateEnrichThreshold > 0 && t.coverageReport == "" && t.outputDir == "" && t.outputFormat != OutputFormatDevTools {
+		return errors.Errorf("the enrich policies of the translate filters are only emitted with the output format %s or an output directory", OutputFormatDevTools)
+	}
 
 	for _, filename := range args {
 		stat, err := os.Stat(filename)
@@ -80,6 +138,10 @@ func (t Transpile) Run(args []string) error {
 
 		if err1 != nil {
 			log.Warn().Msgf("%s %s %s", err1, res, reflect.TypeOf(res))
+			if t.strict {
+				result = multierror.Append(result, errors.Errorf("%s: %v", filename, err1))
+			}
+			coverages = append(coverages, FileCoverage{File: filename, Error: err1.Error(), Plugins: []PluginCoverage{}})
 
 			// if errMsg, hasErr := config.GetFarthestFailure(); hasErr {
 			// 	if !strings.Contains(err.Error(), errMsg) {
@@ -92,12 +154,46 @@ func (t Transpile) Run(args []string) error {
 			var tree ast.Config = res.(ast.Config)
 			// log.Println(reflect.TypeOf(tree))
 
-			ips = append(ips, t.buildIngestPipeline(filename, tree)...)
-
+			fileIps := t.buildIngestPipeline(filename, tree)
+			ips = append(ips, fileIps...)
+			manifest.add(filename, fileIps, pipelineExtension(t.outputFormat))
+			coverage := t.coverage.report(filename)
+			coverages = append(coverages, coverage)
+			if t.strict {
+				for _, err := range coverage.Errors() {
+					result = multierror.Append(result, err)
+				}
+			}
 		}
 	}
 
-	printPipeline(ips)
+	switch t.coverageReport {
+	case "json":
+		buf, err := MyJsonEncode(map[string]interface{}{"files": coverages})
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(buf))
+	case "text":
+		fmt.Print(printCoverageTable(coverages))
+	default:
+		if t.outputDir != "" {
+			if err := writePipelines(t.outputDir, ips, *t.enrichPolicies, manifest, t.outputFormat); err != nil {
+				return err
+			}
+			break
+		}
+		if len(*t.enrichPolicies) > 0 {
+			policies, err := formatEnrichPolicies(*t.enrichPolicies)
+			if err != nil {
+				return err
+			}
+			fmt.Print(policies + "\n")
+		}
+		if err := printPipelines(ips, t.outputFormat); err != nil {
+			return err
+		}
+	}
 
 	if result != nil {
 		result.ErrorFormat = format.MultiErr
@@ -112,22 +208,28 @@ type TranspileProcessor func(plugin ast.Plugin, id string, t Transpile) ([]Inges
 var transpiler = map[string]map[string]TranspileProcessor{
 	"input": {},
 	"filter": {
-		"mutate":     DealWithMutate,
-		"drop":       DealWithDrop,
-		"date":       DealWithDate,
-		"dissect":    DealWithDissect,
-		"grok":       DealWithGrok,
-		"kv":         DealWithKV,
-		"cidr":       DealWithCidr,
-		"geoip":      DealWithGeoIP,
-		"translate":  DealWithTranslate,
-		"useragent":  DealWithUserAgent,
-		"urldecode":  DealWithURLDecode,
-		"prune":      DealWithPrune,
-		"syslog_pri": DealWithSyslogPri,
-		"csv":        DealWithCSV,
-		"json":       DealWithJSON,
-		// "truncate":   DealWithTruncate,
+		"mutate":      DealWithMutate,
+		"drop":        DealWithDrop,
+		"date":        DealWithDate,
+		"dissect":     DealWithDissect,
+		"grok":        DealWithGrok,
+		"kv":          DealWithKV,
+		"cidr":        DealWithCidr,
+		"geoip":       DealWithGeoIP,
+		"translate":   DealWithTranslate,
+		"useragent":   DealWithUserAgent,
+		"urldecode":   DealWithURLDecode,
+		"prune":       DealWithPrune,
+		"syslog_pri":  DealWithSyslogPri,
+		"csv":         DealWithCSV,
+		"json":        DealWithJSON,
+		"truncate":    DealWithTruncate,
+		"fingerprint": DealWithFingerprint,
+		"split":       DealWithSplit,
+		"de_dot":      DealWithDeDot,
+		"uuid":        DealWithUUID,
+		"xml":         DealWithXML,
+		"bytes":       DealWithBytes,
 	},
 	"output": {
 		"elasticsearch": DealWithOutputElasticsearch,
@@ -231,6 +333,8 @@ func transpileRvalue(expr ast.Node) string {
 	switch texpr := expr.(type) {
 	case ast.StringAttribute:
 		return "\"" + texpr.Value() + "\""
+	case ast.NumberAttribute:
+		return texpr.ValueString()
 	case ast.Selector:
 		return toElasticPipelineSelectorWithNullable(texpr.String(), true)
 
@@ -260,10 +364,10 @@ func transpileCondition(c ast.Condition) string {
 
 		case ast.ConditionExpression:
 			bOpComparator := transpileBoolExpression(texpr.BoolExpression.BoolOperator())
-			output = output + bOpComparator + transpileCondition(texpr.Condition)
+			output = output + bOpComparator + "(" + transpileCondition(texpr.Condition) + ")"
 		case ast.NegativeConditionExpression:
 			operator_converted := transpileBoolExpression(texpr.BoolExpression.BoolOperator())
-			output = output + "!" + operator_converted + "(" + transpileCondition(texpr.Condition) + ")"
+			output = output + operator_converted + "!(" + transpileCondition(texpr.Condition) + ")"
 
 		case ast.NegativeSelectorExpression:
 			operator_converted := transpileBoolExpression(texpr.BoolExpression.BoolOperator())
@@ -275,7 +379,7 @@ func transpileCondition(c ast.Condition) string {
 
 		case ast.NotInExpression:
 			bOpComparator := transpileBoolExpression(texpr.BoolExpression.BoolOperator())
-			output = output + "!" + bOpComparator + transpileRvalue(texpr.RValue) + ".contains(" + transpileRvalue(texpr.LValue) + ")"
+			output = output + bOpComparator + "!" + transpileRvalue(texpr.RValue) + ".contains(" + transpileRvalue(texpr.LValue) + ")"
 
 		case ast.CompareExpression:
 			bOpComparator := transpileBoolExpression(texpr.BoolExpression.BoolOperator())
@@ -343,7 +447,7 @@ func randomString(length int) string {
 	return fmt.Sprintf("%x", b)[2 : length+2]
 }
 
-func DealWithMutateAttributes(attr ast.Attribute, ingestProcessors []IngestProcessor, id string) []IngestProcessor {
+func DealWithMutateAttributes(plugin ast.Plugin, attr ast.Attribute, ingestProcessors []IngestProcessor, id string, t Transpile) []IngestProcessor {
 	switch attr.Name() {
 
 	case "capitalize":
@@ -371,8 +475,51 @@ else {
 		keys, values := getHashAttributeKeyValue(attr)
 
 		for i := range keys {
+			// The Convert Processor only accepts "true"/"false" as booleans and does not know the EU formats
 			if Contains([]string{"boolean", "integer_eu", "float_eu"}, values[i]) {
-				log.Warn().Msgf("Mutate Convert to type '%s' semantics may be different in Elasticsearch Convert Processor", values[i])
+				ingestProcessors = append(ingestProcessors, ScriptProcessor{
+					Source: pointer(`def convert(def v, String type) {
+  if (v == null) {
+    return null;
+  }
+  if (v instanceof List) {
+    List converted = new ArrayList();
+    for (def e : v) {
+      converted.add(convert(e, type));
+    }
+    return converted;
+  }
+  if (type == 'boolean') {
+    String s = v.toString().toLowerCase();
+    if (['true', 't', 'yes', 'y', '1', '1.0'].contains(s)) {
+      return true;
+    }
+    if (s.isEmpty() || ['false', 'f', 'no', 'n', '0', '0.0'].contains(s)) {
+      return false;
+    }
+    return v;
+  }
+  double d;
+  if (v instanceof Boolean) {
+    d = v ? 1 : 0;
+  } else if (v instanceof Number) {
+    d = v.doubleValue();
+  } else {
+    // Like Ruby's to_i and to_f, the leading number is converted and text that is not a number is 0
+    String s = v.toString().replace('.', '').replace(',', '.');
+    Matcher m = type == 'float_eu' ? /^\s*[+-]?\d+(\.\d+)?([eE][+-]?\d+)?/.matcher(s) : /^\s*[+-]?\d+/.matcher(s);
+    d = m.find() ? Double.parseDouble(m.group().trim()) : 0;
+  }
+  return type == 'float_eu' ? d : (long) d;
+}
+field(params.field).set(convert($(params.field, null), params.type));`),
+					Params: &map[string]interface{}{
+						"field": keys[i],
+						"type":  values[i],
+					},
+				}.WithIf(pointer(getIfFieldDefined(keys[i])), false).
+					WithDescription(fmt.Sprintf("Convert field '%s' to '%s'", keys[i], values[i])))
+				continue
 			}
 			ingestProcessors = append(ingestProcessors, ConvertProcessor{
 				Field: keys[i],
@@ -417,7 +564,7 @@ else {
 			}
 
 		default: // uppercase/lowercase require an Array
-			log.Warn().Msgf("Mutate filter attribute '%s' not supported", attr.Name())
+			t.unsupportedAttribute(plugin, attr)
 		}
 
 	case "gsub":
@@ -428,7 +575,7 @@ else {
 			gsubexpression := getArrayStringAttributes(tAttributes)
 
 			if len(gsubexpression)%3 != 0 {
-				log.Warn().Msgf("Gsub expects triplets of (field, pattern, replacement), while %d params are given", len(gsubexpression))
+				t.lossyAttribute(plugin, attr, PartiallyTranspiled, "gsub expects triplets of (field, pattern, replacement), while %d params are given", len(gsubexpression))
 			}
 
 			for i := 0; i < len(gsubexpression); i += 3 {
@@ -506,7 +653,7 @@ else {
 				SetProcessor{
 					Value:    val,
 					Field:    keys[i],
-					Override: true,
+					Override: pointer(true),
 				}.WithDescription(fmt.Sprintf("Replace/Create field '%s' with value '%s'", keys[i], values[i])))
 		}
 
@@ -517,12 +664,73 @@ else {
 				SetProcessor{
 					Value:    values[i],
 					Field:    keys[i],
-					Override: true,
+					Override: pointer(true),
 				}.WithDescription(fmt.Sprintf("Replace/Create field '%s' with value '%s'", keys[i], values[i])))
 		}
 
+	case "merge":
+		hash, ok := attr.(ast.HashAttribute)
+		if !ok {
+			t.unsupportedAttribute(plugin, attr)
+			break
+		}
+		for _, entry := range hash.Entries {
+			key, keyOk := entry.Key.(ast.StringAttribute)
+			value, valueOk := entry.Value.(ast.StringAttribute)
+			if !keyOk || !valueOk {
+				t.lossyAttribute(plugin, attr, PartiallyTranspiled, "merge expects field names, while '%s' => '%s' is given", entry.Key.ValueString(), entry.Value.ValueString())
+				continue
+			}
+			dest := toElasticPipelineSelector(key.Value())
+			added := toElasticPipelineSelector(value.Value())
+			nullableDest := toElasticPipelineSelectorWithNullable(key.Value(), true)
+			nullableAdded := toElasticPipelineSelectorWithNullable(value.Value(), true)
+
+			// The common case of a string merged into a string or an array
+			ingestProcessors = append(ingestProcessors,
+				AppendProcessor{
+					Field:           dest,
+					Value:           []string{fmt.Sprintf("{{{%s}}}", added)},
+					AllowDuplicates: pointer(true),
+				}.WithIf(pointer(fmt.Sprintf("%s instanceof String && !(%s instanceof Map)", nullableAdded, nullableDest)), false).
+					WithDescription(fmt.Sprintf("Merge field '%s' into field '%s'", added, dest)),
+			)
+
+			// Arrays are concatenated and hashes merged, a hash cannot be merged with something else
+			ingestProcessors = append(ingestProcessors,
+				ScriptProcessor{
+					Source: pointer(`def dest = $(params.dest, null);
+def added = $(params.added, null);
+if ((dest instanceof Map) != (added instanceof Map)) {
+  return;
+}
+if (dest instanceof Map) {
+  dest.putAll(added);
+  return;
+}
+List merged = new ArrayList();
+if (dest instanceof List) {
+  merged.addAll(dest);
+} else if (dest != null) {
+  merged.add(dest);
+}
+if (added instanceof List) {
+  merged.addAll(added);
+} else if (added != null) {
+  merged.add(added);
+}
+field(params.dest).set(merged);`),
+					Params: &map[string]interface{}{
+						"dest":  dest,
+						"added": added,
+					},
+				}.WithIf(pointer(fmt.Sprintf("!(%s instanceof String)", nullableAdded)), false).
+					WithDescription(fmt.Sprintf("Merge field '%s' into field '%s'", added, dest)),
+			)
+		}
+
 	default:
-		log.Warn().Msgf("Mutate of type '%s' not supported", attr.Name())
+		t.unsupportedAttribute(plugin, attr)
 
 	}
 
@@ -572,10 +780,15 @@ func toElasticPipelineSelectorExpression(s string, context int) (string, bool) {
 		log.Info().Msg(toElasticPipelineSelector(string(m[2 : len(m)-1])))
 		switch context {
 		case ProcessorContext:
-			newS = strings.Replace(newS, string(m), "{{{"+toElasticPipelineSelector(string(m[2:len(m)-1]))+"}}}", 1)
+			newS = strings.Replace(newS, string(m), "{{{"+sprintfSelector(string(m))+"}}}", 1)
 
 		case ScriptContext:
-			var fieldValue = toElasticPipelineSelectorCondition(toElasticPipelineSelector(string(m[2 : len(m)-1])))
+			var fieldValue string
+			if ts := sprintfTimestampReference.FindStringSubmatch(string(m)); ts != nil {
+				fieldValue = toElasticPipelineSelectorCondition(fmt.Sprintf("[%s][timestamp][%s]", TRANSPILER_PREFIX, sprintfTimestampKey(ts[1])))
+			} else {
+				fieldValue = toElasticPipelineSelectorCondition(toElasticPipelineSelector(string(m[2 : len(m)-1])))
+			}
 
 			pos := field_finder.FindStringIndex(newS)
 			if firstRun && pos[0] != 0 {
@@ -593,7 +806,7 @@ func toElasticPipelineSelectorExpression(s string, context int) (string, bool) {
 
 		case CidrContext:
 			// Special version of the ScriptContext where we use a default of empty string
-			var fieldValue = "$('" + toElasticPipelineSelector(string(m[2:len(m)-1])) + "', '')"
+			var fieldValue = "$('" + sprintfSelector(string(m)) + "', '')"
 
 			pos := field_finder.FindStringIndex(newS)
 			if firstRun && pos[0] != 0 {
@@ -741,19 +954,21 @@ func processorsToPipeline(ingestProcessors []IngestProcessor, name string, thres
 	}
 }
 
-func DealWithCommonAttributes(plugin ast.Plugin) []IngestProcessor {
+func DealWithCommonAttributes(plugin ast.Plugin, t Transpile) []IngestProcessor {
 	ingestProcessors := []IngestProcessor{}
 
 	for _, attr := range plugin.Attributes {
 		if !Contains(CommonAttributes, attr.Name()) {
 			continue // Ignore not common attributes
 		}
+		// The timestamps referenced by the attribute are computed when the plugin succeeded, i.e., after a date filter
+		ingestProcessors = append(ingestProcessors, t.sprintfTimestampProcessors(plugin, attr)...)
 		switch attr.Name() {
 		// It is a common field
 		case "add_field":
 			keys, values := getHashAttributeKeyValueUntyped(attr)
-
 			for i := range keys {
+				keys[i], _ = toElasticPipelineSelectorExpression(keys[i], ProcessorContext)
 
 				var value interface{}
 
@@ -782,10 +997,14 @@ func DealWithCommonAttributes(plugin ast.Plugin) []IngestProcessor {
 				},
 			)
 		case "add_tag":
+			tags := getArrayStringAttributes(attr)
+			for i := range tags {
+				tags[i], _ = toElasticPipelineSelectorExpression(tags[i], ProcessorContext)
+			}
 			ingestProcessors = append(ingestProcessors,
 				AppendProcessor{
 					Field: "tags",
-					Value: getArrayStringAttributes(attr),
+					Value: tags,
 				},
 			)
 
@@ -803,10 +1022,12 @@ func DealWithCommonAttributes(plugin ast.Plugin) []IngestProcessor {
 				)
 			}
 
+		case "id": // Used as tag of the processors
+
 		case "enable_metric", "periodic_flush": // N/A
 
 		default:
-			log.Warn().Msgf("On Success Attribute: %s is not yet supported", attr.Name())
+			t.unsupportedAttribute(plugin, attr)
 
 		}
 	}
@@ -835,7 +1056,7 @@ func DealWithDrop(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor,
 		// Add if condition
 
 		default:
-			log.Warn().Msgf("[Pos %s][Plugin %s] Attribute '%s' is currently not supported", plugin.Pos(), plugin.Name(), attr.Name())
+			t.unsupportedAttribute(plugin, attr)
 		}
 	}
 
@@ -844,11 +1065,16 @@ func DealWithDrop(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor,
 	return ingestProcessors, onFailureProcessors
 }
 
+// Date Plugin of Logstash
+// The keywords are supported by the date processor, the Joda-Time patterns are converted to java.time patterns.
+// A target with field references is not supported by the date processor, the date is parsed in a temporary field
+// and moved to the target with a set processor.
 func DealWithDate(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor, []IngestProcessor) {
 	ingestProcessors := []IngestProcessor{}
 	onFailureProcessors := []IngestProcessor{}
 
 	proc := DateProcessor{}.WithTag(id).(DateProcessor)
+	var target *string = nil
 
 	for _, attr := range plugin.Attributes {
 		if Contains(CommonAttributes, attr.Name()) {
@@ -859,107 +1085,79 @@ func DealWithDate(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor,
 		case "tag_on_failure":
 			onFailureProcessors = DealWithTagOnFailure(attr, id, t)
 		case "target":
-			proc.TargetField = pointer(getStringAttributeString(attr))
+			target = pointer(getStringAttributeString(attr))
 		case "locale":
-			log.Warn().Msgf("Date filter is using %s %s. Please make sure it corresponds to Ingest Pipeline's one", attr.Name(), getStringAttributeString(attr))
-			proc.Locale = pointer(getStringAttributeString(attr))
+			t.lossyAttribute(plugin, attr, FullyTranspiled, "the date filter is using %s %s. Please make sure it corresponds to Ingest Pipeline's one", attr.Name(), getStringAttributeString(attr))
+			locale, _ := toElasticPipelineSelectorExpression(getStringAttributeString(attr), ProcessorContext)
+			proc.Locale = pointer(locale)
 		case "timezone":
-			log.Warn().Msgf("Date filter is using %s %s. Please make sure it corresponds to Ingest Pipeline's one", attr.Name(), getStringAttributeString(attr))
-			proc.Timezone = pointer(getStringAttributeString(attr))
+			t.lossyAttribute(plugin, attr, FullyTranspiled, "the date filter is using %s %s. Please make sure it corresponds to Ingest Pipeline's one", attr.Name(), getStringAttributeString(attr))
+			timezone, _ := toElasticPipelineSelectorExpression(getStringAttributeString(attr), ProcessorContext)
+			proc.Timezone = pointer(timezone)
 
 		case "match":
 			matchArray := getArrayStringAttributes(attr)
+			if len(matchArray) == 0 {
+				t.unsupportedAttribute(plugin, attr)
+				continue
+			}
 			proc.Field = toElasticPipelineSelector(matchArray[0])
-			proc.Formats = matchArray[1:]
+			proc.Formats = []string{}
+			for _, format := range matchArray[1:] {
+				if Contains(dateKeywords, format) {
+					proc.Formats = append(proc.Formats, format)
+					continue
+				}
+				javaFormat, unsupported := jodaToJavaPattern(format)
+				if len(unsupported) > 0 {
+					// The pattern would be rejected by the date processor
+					t.lossyAttribute(plugin, attr, NotTranspiled, "the pattern letters %s of the format '%s' have no equivalent, the format is skipped", strings.Join(unsupported, ", "), format)
+					continue
+				}
+				proc.Formats = append(proc.Formats, javaFormat)
+			}
 
 		default:
-			log.Warn().Msgf("Attribute '%s' is currently not supported", attr.Name())
+			t.unsupportedAttribute(plugin, attr)
 
 		}
 	}
-	// Add _kv_filter_error
+	// Add _dateparsefailure
 	if len(onFailureProcessors) == 0 {
-		onFailureProcessors = DealWithTagOnFailure(ast.NewArrayAttribute("tag_on_failure", ast.NewStringAttribute("", "_date_parse_failure", ast.DoubleQuoted)), id, t)
+		onFailureProcessors = DealWithTagOnFailure(ast.NewArrayAttribute("tag_on_failure", ast.NewStringAttribute("", "_dateparsefailure", ast.DoubleQuoted)), id, t)
 	}
 
-	ingestProcessors = append(ingestProcessors, proc)
-
-	return ingestProcessors, onFailureProcessors
-}
-
-func DealWithGeoIP(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor, []IngestProcessor) {
-	ingestProcessors := []IngestProcessor{}
-	onFailurePorcessors := []IngestProcessor{}
-	properties := []string{}
-
-	gp := GeoIPProcessor{}.WithTag(id).(GeoIPProcessor)
-
-	// TODO Add all properties
-	for _, attr := range plugin.Attributes {
-		switch attr.Name() {
-		case "fields":
-			properties = getArrayStringAttributes(attr)
-
-		case "source":
-			gp.Field = toElasticPipelineSelector(getStringAttributeString(attr))
-
-		case "target":
-			gp.TargetField = pointer(toElasticPipelineSelector(getStringAttributeString(attr)))
-
-		case "tag_on_failure":
-			onFailurePorcessors = DealWithTagOnFailure(attr, id, t)
+	if len(proc.Formats) == 0 {
+		t.lossyPlugin(plugin, "no format can be transpiled, the plugin is skipped")
+		return ingestProcessors, onFailureProcessors
+	}
 
-		default:
-			log.Warn().Msgf("Attribute '%s' in Plugin '%s' is currently not supported", attr.Name(), plugin.Name())
+	if target == nil {
+		return append(ingestProcessors, proc), onFailureProcessors
+	}
 
-		}
+	targetField, dependsOnInput := toElasticPipelineSelectorExpression(*target, ProcessorContext)
+	targetField = toElasticPipelineSelector(targetField)
+	if !dependsOnInput {
+		proc.TargetField = pointer(targetField)
+		return append(ingestProcessors, proc), onFailureProcessors
 	}
 
-	// Add _grok_parse_failure
-	if len(gp.OnFailure) == 0 {
-		onFailurePorcessors = DealWithTagOnFailure(ast.NewArrayAttribute("tag_on_failure", ast.NewStringAttribute("", "_geoip_lookup_failure", ast.DoubleQuoted)), id, t)
-	}
-
-	// Fields are defined
-	if len(properties) > 0 {
-		asn_properties := []string{}
-		other_properties := []string{}
-		// Normalizing and dispatch in sub-arrays
-		for i := range properties {
-			properties[i] = strings.ToLower(properties[i])
-			switch properties[i] {
-			case "autonomous_system_number":
-				asn_properties = append(asn_properties, "asn")
-			case "autonomous_system_organization":
-				asn_properties = append(asn_properties, "organization_name")
-			default:
-				other_properties = append(other_properties, properties[i])
-			}
-		}
-		if len(asn_properties) > 0 {
-			gp_asn := GeoIPProcessor{
-				Field:        gp.Field,
-				DatabaseFile: pointer("GeoLite2-ASN.mmdb"),
-				Properties:   &asn_properties,
-			}.WithTag(gp.GetTagOrDefault("") + "asn").(GeoIPProcessor)
+	tmp := fmt.Sprintf("%s.%s-date", TRANSPILER_PREFIX, id)
+	proc.TargetField = pointer(tmp)
+	ingestProcessors = append(ingestProcessors,
+		proc,
+		SetProcessor{
+			Field:    targetField,
+			CopyFrom: tmp,
+		}.WithTag(fmt.Sprintf("%s-set", id)),
+		RemoveProcessor{
+			Field:         &[]string{tmp},
+			IgnoreMissing: true,
+		}.WithTag(fmt.Sprintf("%s-cleanup", id)),
+	)
 
-			if gp.TargetField != nil {
-				gp_asn.TargetField = pointer(*gp.TargetField + ".as")
-			}
-			ingestProcessors = append(ingestProcessors, gp_asn)
-		}
-		if len(other_properties) > 0 {
-			gp_other := GeoIPProcessor{
-				Field:      gp.Field,
-				Properties: &other_properties,
-			}.WithTag(id).(GeoIPProcessor)
-			if gp.TargetField != nil {
-				gp_other.TargetField = pointer(*gp.TargetField + ".geo")
-			}
-			ingestProcessors = append(ingestProcessors, gp_other)
-		}
-	}
-	return ingestProcessors, onFailurePorcessors
+	return ingestProcessors, onFailureProcessors
 }
 
 func DealWithUserAgent(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor, []IngestProcessor) {
@@ -994,7 +1192,7 @@ func DealWithUserAgent(plugin ast.Plugin, id string, t Transpile) ([]IngestProce
 			uap.TargetField = pointer(toElasticPipelineSelector(getStringAttributeString(attr)))
 
 		default:
-			log.Warn().Msgf("Attribute '%s' in Plugin '%s' is currently not supported", attr.Name(), plugin.Name())
+			t.unsupportedAttribute(plugin, attr)
 
 		}
 	}
@@ -1015,7 +1213,7 @@ func DealWithUserAgent(plugin ast.Plugin, id string, t Transpile) ([]IngestProce
 	// Add Warning and Field renaming when ECS Compatibility is disabled
 	if ecs_compatibility == "disabled" {
 
-		log.Warn().Msg("Disabled ECS_Compatibility is only partially supported.")
+		t.lossyPlugin(plugin, "disabled ecs_compatibility is only partially supported")
 
 		orig := []string{"os.name", "os.full", "os.version"}
 		dest := []string{"os_name", "os_full", "os_version"}
@@ -1093,27 +1291,51 @@ func DealWithUserAgent(plugin ast.Plugin, id string, t Transpile) ([]IngestProce
 	return ingestProcessors, onFailurePorcessors
 }
 
+// Grok Plugin of Logstash
+// A grok processor tries its patterns in order and stops at the first match, i.e., as Logstash with break_on_match.
+// With multiple fields, Logstash tries the fields in order: the grok processors of the fields are chained with
+// on_failure in a dedicated pipeline. With break_on_match => false, all the patterns of all the fields are
+// applied: each pattern is tried by its own grok processor and the failures are counted in a temporary field,
+// so that the plugin fails only if no pattern matched.
 func DealWithGrok(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor, []IngestProcessor) {
 	ingestProcessors := []IngestProcessor{}
 	onFailurePorcessors := []IngestProcessor{}
 	break_on_match := true
 
+	type grokMatch struct {
+		field    string
+		patterns []string
+	}
+	matches := []grokMatch{}
+
 	gp := GrokProcessor{}.WithTag(id).(GrokProcessor)
 
+	var patternsDir ast.Attribute
+	patternsFilesGlob := "*"
+
 	for _, attr := range plugin.Attributes {
 		if Contains(CommonAttributes, attr.Name()) {
 			continue
 		}
 		switch attr.Name() {
 		case "match":
-			helpPatterns := hashAttributeToMapArray(attr)
-			// TODO: Deal with multiple keys, currently only the last is used
-			for key := range helpPatterns {
-				gp.Field = key
-				gp.Patterns = helpPatterns[key]
-				for i, _ := range gp.Patterns {
-					gp.Patterns[i], _ = toElasticPipelineSelectorExpression(gp.Patterns[i], GrokContext)
+			// The fields are kept in the order of the configuration, as they are tried in order
+			hash, ok := attr.(ast.HashAttribute)
+			if !ok {
+				t.unsupportedAttribute(plugin, attr)
+				continue
+			}
+			for _, entry := range hash.Entries {
+				key, ok := entry.Key.(ast.StringAttribute)
+				if !ok {
+					t.lossyAttribute(plugin, attr, PartiallyTranspiled, "the field %s should be a string", entry.Key.ValueString())
+					continue
 				}
+				patterns := getArrayStringAttributeOrStringAttrubute(entry.Value)
+				for i := range patterns {
+					patterns[i], _ = toElasticPipelineSelectorExpression(patterns[i], GrokContext)
+				}
+				matches = append(matches, grokMatch{field: toElasticPipelineSelector(key.Value()), patterns: patterns})
 			}
 
 		case "ecs_compatibility":
@@ -1129,22 +1351,96 @@ func DealWithGrok(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor,
 			onFailurePorcessors = DealWithTagOnFailure(attr, id, t)
 		case "break_on_match":
 			break_on_match = getBoolValue(attr)
+		case "patterns_dir":
+			patternsDir = attr
+		case "patterns_files_glob":
+			patternsFilesGlob = getStringAttributeString(attr)
 
 		default:
-			log.Warn().Msgf("Attribute '%s' in Plugin '%s' is currently not supported", attr.Name(), plugin.Name())
+			t.unsupportedAttribute(plugin, attr)
 
 		}
 	}
-	// Add _grok_parse_failure
-	if len(gp.OnFailure) == 0 {
-		onFailurePorcessors = DealWithTagOnFailure(ast.NewArrayAttribute("tag_on_failure", ast.NewStringAttribute("", "_grok_parse_failure", ast.DoubleQuoted)), id, t)
+	// Add _grokparsefailure
+	if len(onFailurePorcessors) == 0 {
+		onFailurePorcessors = DealWithTagOnFailure(ast.NewArrayAttribute("tag_on_failure", ast.NewStringAttribute("", "_grokparsefailure", ast.DoubleQuoted)), id, t)
 	}
-	if !break_on_match {
-		log.Warn().Msg("As of now only, break_on_match True is supported.")
-		// TODO? To solve this issue, we would need to create a grok processor for each pattern
+
+	if len(matches) == 0 {
+		t.lossyPlugin(plugin, "the match is required, the plugin is skipped")
+		return ingestProcessors, onFailurePorcessors
+	}
+
+	// The custom patterns used by the match expressions are inlined in pattern_definitions
+	if patternsDir != nil {
+		expressions := []string{}
+		for _, m := range matches {
+			expressions = append(expressions, m.patterns...)
+		}
+		gp.PatternDefinitions = t.inlineGrokPatterns(plugin, patternsDir, patternsFilesGlob, expressions, gp.PatternDefinitions)
 	}
 
-	ingestProcessors = append(ingestProcessors, gp)
+	if len(matches) == 1 && (break_on_match || len(matches[0].patterns) == 1) {
+		gp.Field = matches[0].field
+		gp.Patterns = matches[0].patterns
+		ingestProcessors = append(ingestProcessors, gp)
+		return ingestProcessors, onFailurePorcessors
+	}
+
+	grokProcessors := []IngestProcessor{}
+	if break_on_match {
+		// The grok processor of a field is executed only if the previous fields do not match
+		for i := len(matches) - 1; i >= 0; i-- {
+			grok := gp
+			grok.Field = matches[i].field
+			grok.Patterns = matches[i].patterns
+			grok.Tag = pointer(fmt.Sprintf("%s-%d", id, i+1))
+			if len(grokProcessors) > 0 {
+				grok.OnFailure = grokProcessors
+			}
+			grokProcessors = []IngestProcessor{grok}
+		}
+	} else {
+		failuresField := fmt.Sprintf("%s-grok-failures", id)
+		count := 0
+		for _, m := range matches {
+			for _, pattern := range m.patterns {
+				count++
+				grok := gp
+				grok.Field = m.field
+				grok.Patterns = []string{pattern}
+				grok.Tag = pointer(fmt.Sprintf("%s-%d", id, count))
+				grok.OnFailure = []IngestProcessor{
+					AppendProcessor{
+						Field: fmt.Sprintf("%s.%s", TRANSPILER_PREFIX, failuresField),
+						Value: []string{"{{ _ingest.on_failure_processor_tag }}"},
+					}.WithDescription("Count the patterns that do not match"),
+				}
+				grokProcessors = append(grokProcessors, grok)
+			}
+		}
+		grokProcessors = append(grokProcessors, ScriptProcessor{
+			Source: pointer(`def failures = ctx[params.prefix]?.remove(params.failures);
+if (failures != null && failures.size() == params.count) {
+  throw new IllegalArgumentException('No grok pattern matched');
+}`),
+			Params: &map[string]interface{}{
+				"prefix":   TRANSPILER_PREFIX,
+				"failures": failuresField,
+				"count":    count,
+			},
+		}.WithTag(fmt.Sprintf("%s-no-match", id)).WithDescription("Fail if no grok pattern matched"))
+	}
+
+	name := fmt.Sprintf("%s-match", id)
+	ingestProcessors = append(ingestProcessors, PipelineProcessor{
+		Pipeline: &IngestPipeline{
+			Name:       name,
+			Processors: grokProcessors,
+		},
+		Name: name,
+	}.WithTag(id))
+
 	return ingestProcessors, onFailurePorcessors
 }
 
@@ -1164,12 +1460,12 @@ func DealWithURLDecode(plugin ast.Plugin, id string, t Transpile) ([]IngestProce
 		case "all_fields":
 			allFields := getBoolValue(attr)
 			if allFields {
-				log.Warn().Msgf("URL Decoding all fields is not supported yet. Consider contributing :).")
+				t.lossyAttribute(plugin, attr, NotTranspiled, "URL Decoding all fields is not supported yet. Consider contributing :)")
 			}
 		case "field":
 			udp.Field = getStringAttributeString(attr)
 		default:
-			log.Warn().Msgf("Attribute '%s' in Plugin '%s' is currently not supported", attr.Name(), plugin.Name())
+			t.unsupportedAttribute(plugin, attr)
 
 		}
 	}
@@ -1245,7 +1541,7 @@ func DealWithCidr(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor,
 throw new Exception('Could not find CIDR value');`, addressOutput))
 
 	if !constant {
-		log.Warn().Msgf("[Plugin %s] Non-constant cidr addresses detected. Be aware that we ignore malformed ip-addresses", plugin.Name())
+		t.lossyPlugin(plugin, "non-constant cidr addresses detected. Be aware that we ignore malformed ip-addresses")
 	}
 
 	ingestProcessors = append(ingestProcessors, ScriptProcessor{
@@ -1256,26 +1552,858 @@ throw new Exception('Could not find CIDR value');`, addressOutput))
 	return ingestProcessors, onFailureProcessor
 }
 
-// func DealWithTruncate(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor, []IngestProcessor) {
-// 	ingestProcessors := []IngestProcessor{}
-// 	onFailureProcessor := []IngestProcessor{}
-// 	var fields []string
-// 	var lengthBytes uint64
-// 	var err error
-// 	for _, attr := range plugin.Attributes {
-// 		switch attr.Name() {
-// 		case "fields":
-// 			fields = getArrayStringAttributeOrStringAttrubute(attr)
-// 		case "length_bytes":
-// 			rawLengthBytes := getStringAttributeString(attr)
-// 			lengthBytes, err = strconv.ParseUint(rawLengthBytes, 10, 64)
-// 			if err != nil {
-// 				log.Warn().Msgf("[Plugin %s] the lengthBytes should be an integer %v", plugin.Name(), err)
-// 			}
-// 		}
-// 	}
-
-// }
+// Truncate Plugin of Logstash
+// There is no processor truncating strings, thus we rely on a script that truncates the strings
+// (and the strings in arrays) to at most length_bytes bytes, without splitting multi-byte UTF-8 characters.
+// Without fields, all the top-level fields of the document are truncated as done by Logstash.
+func DealWithTruncate(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor, []IngestProcessor) {
+	ingestProcessors := []IngestProcessor{}
+	onFailureProcessor := []IngestProcessor{}
+	var fields []string
+	var lengthBytes *int
+
+	for _, attr := range plugin.Attributes {
+		switch attr.Name() {
+		case "fields":
+			fields = getArrayStringAttributeOrStringAttrubute(attr)
+		case "length_bytes":
+			switch tattr := attr.(type) {
+			case ast.NumberAttribute:
+				lengthBytes = pointer(int(tattr.Value()))
+			case ast.StringAttribute:
+				value, err := strconv.Atoi(tattr.Value())
+				if err != nil {
+					t.lossyAttribute(plugin, attr, NotTranspiled, "the length_bytes should be an integer: %v", err)
+					continue
+				}
+				lengthBytes = &value
+			}
+		default:
+			t.unsupportedAttribute(plugin, attr)
+		}
+	}
+
+	if lengthBytes == nil {
+		t.lossyPlugin(plugin, "the length_bytes is required, the plugin is skipped")
+		return ingestProcessors, onFailureProcessor
+	}
+
+	params := map[string]interface{}{
+		"length_bytes": *lengthBytes,
+	}
+
+	var apply string
+	if fields != nil {
+		for i := range fields {
+			fields[i] = toElasticPipelineSelector(fields[i])
+		}
+		params["fields"] = fields
+		apply = `for (String f : params.fields) {
+  def value = $(f, null);
+  if (value != null) {
+    field(f).set(truncate(value, params.length_bytes));
+  }
+}`
+	} else {
+		// The metadata of the document and the temporary fields are not part of the Logstash event and
+		// Logstash never truncates the @timestamp, since it is not a string
+		params["excluded"] = []string{"_index", "_id", "_routing", "_version", "_version_type", "_if_seq_no", "_if_primary_term", "_dynamic_templates", "@metadata", "@timestamp", TRANSPILER_PREFIX}
+		apply = `for (String f : new ArrayList(ctx.keySet())) {
+  if (!params.excluded.contains(f)) {
+    ctx[f] = truncate(ctx[f], params.length_bytes);
+  }
+}`
+	}
+
+	ingestProcessors = append(ingestProcessors, ScriptProcessor{
+		Source: pointer(`def truncate(def value, int max) {
+  if (value instanceof String) {
+    String s = (String) value;
+    int bytes = 0;
+    int i = 0;
+    while (i < s.length()) {
+      int cp = s.codePointAt(i);
+      int size = cp < 0x80 ? 1 : (cp < 0x800 ? 2 : (cp < 0x10000 ? 3 : 4));
+      if (bytes + size > max) {
+        return s.substring(0, i);
+      }
+      bytes += size;
+      i += Character.charCount(cp);
+    }
+    return s;
+  }
+  if (value instanceof List) {
+    List truncated = new ArrayList();
+    for (def v : value) {
+      truncated.add(truncate(v, max));
+    }
+    return truncated;
+  }
+  return value;
+}
+` + apply),
+		Params: &params,
+	}.WithTag(id).WithDescription(fmt.Sprintf("Truncate the strings to %d bytes", *lengthBytes)))
+
+	return ingestProcessors, onFailureProcessor
+}
+
+// Hash methods of the Logstash fingerprint filter supported by the fingerprint processor
+var LogstashFingerprintMethodToProcessorMethod = map[string]string{
+	"MD5":     "MD5",
+	"SHA1":    "SHA-1",
+	"SHA256":  "SHA-256",
+	"SHA512":  "SHA-512",
+	"MURMUR3": "MurmurHash3",
+}
+
+// Hash methods of the Logstash fingerprint filter computed by a script as done by Logstash, i.e., the hex
+// digest of the string value. Painless only provides these digests.
+var LogstashFingerprintScriptMethods = []string{"SHA1", "SHA256", "PUNCTUATION"}
+
+// The script computing the fingerprint as done by Logstash. Without concatenate_sources (always the case for
+// PUNCTUATION) each source that is present overwrites the target (an array is hashed element by element), with
+// concatenate_sources the string |name1|value1|name2|value2| of the sources sorted by name is hashed.
+const fingerprintScript = `String fingerprint(def value, Map params) {
+  String s = value == null ? '' : value.toString();
+  if (params.method == 'PUNCTUATION') {
+    return /[A-Za-z0-9 \t]/.matcher(s).replaceAll('');
+  }
+  String hex = params.method == 'SHA1' ? s.sha1() : s.sha256();
+  if (!params.base64encode) {
+    return hex;
+  }
+  byte[] bytes = new byte[hex.length() / 2];
+  for (int i = 0; i < bytes.length; i++) {
+    bytes[i] = (byte) Integer.parseInt(hex.substring(2 * i, 2 * i + 2), 16);
+  }
+  return Base64.getEncoder().encodeToString(bytes);
+}
+if (params.concatenate_sources) {
+  String s = '';
+  for (int i = 0; i < params.fields.size(); i++) {
+    def value = $(params.fields[i], null);
+    s += '|' + params.names[i] + '|' + (value == null ? '' : value.toString());
+  }
+  field(params.target).set(fingerprint(s + '|', params));
+  return;
+}
+for (def f : params.fields) {
+  def value = $(f, null);
+  if (value == null) {
+    continue;
+  }
+  if (value instanceof List) {
+    List hashes = new ArrayList();
+    for (def v : value) {
+      hashes.add(fingerprint(v, params));
+    }
+    field(params.target).set(hashes);
+  } else {
+    field(params.target).set(fingerprint(value, params));
+  }
+}`
+
+// Fingerprint Plugin of Logstash
+// The SHA1 and SHA256 methods without a key and the PUNCTUATION method are computed by a script, so that the
+// fingerprints are the same as the Logstash ones. The other hash methods are converted to the fingerprint
+// processor, which hashes the names and the values of the fields and encodes the result in base64, thus the
+// resulting fingerprints are consistent among the events processed by the Ingest Pipeline, but differ from the
+// Logstash ones. The UUID method is converted to a script as well.
+func DealWithFingerprint(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor, []IngestProcessor) {
+	ingestProcessors := []IngestProcessor{}
+	onFailureProcessors := []IngestProcessor{}
+
+	sources := []string{"message"}
+	var target *string
+	method := "SHA1"
+	concatenateSources := false
+	ecsCompatibility := "v8"
+	base64encode := false
+	var key *ast.Attribute
+	var base64encodeAttr *ast.Attribute
+	var methodAttr ast.Attribute
+
+	for _, attr := range plugin.Attributes {
+		switch attr.Name() {
+		case "source":
+			sources = getArrayStringAttributeOrStringAttrubute(attr)
+		case "target":
+			target = pointer(toElasticPipelineSelector(getStringAttributeString(attr)))
+		case "method":
+			method = getStringAttributeString(attr)
+			methodAttr = attr
+		case "concatenate_sources":
+			concatenateSources = getBoolValue(attr)
+		case "ecs_compatibility":
+			ecsCompatibility = getStringAttributeString(attr)
+		case "key":
+			key = &attr
+		case "base64encode":
+			base64encode = getBoolValue(attr)
+			base64encodeAttr = &attr
+		default:
+			t.unsupportedAttribute(plugin, attr)
+		}
+	}
+
+	if target == nil {
+		if ecsCompatibility == "disabled" {
+			target = pointer("fingerprint")
+		} else {
+			target = pointer("event.hash")
+		}
+	}
+
+	// Logstash ignores concatenate_sources with PUNCTUATION and processes each source on its own
+	if method == "PUNCTUATION" {
+		concatenateSources = false
+	}
+
+	// Logstash concatenates the sources sorted by their name, PUNCTUATION processes them in the same order
+	names := append([]string{}, sources...)
+	if concatenateSources || method == "PUNCTUATION" {
+		sort.Strings(names)
+	}
+	fields := make([]string, len(names))
+	for i := range names {
+		fields[i] = toElasticPipelineSelector(names[i])
+	}
+
+	switch {
+	case method == "UUID":
+		ingestProcessors = append(ingestProcessors, ScriptProcessor{
+			Source: pointer("field(params.target).set(UUID.randomUUID().toString());"),
+			Params: &map[string]interface{}{"target": *target},
+		}.WithTag(id).WithDescription("Set a random UUID as done by the fingerprint method UUID"))
+
+	case Contains(LogstashFingerprintScriptMethods, method) && (key == nil || method == "PUNCTUATION"):
+		ingestProcessors = append(ingestProcessors, ScriptProcessor{
+			Source: pointer(fingerprintScript),
+			Params: &map[string]interface{}{
+				"fields":              fields,
+				"names":               names,
+				"target":              *target,
+				"method":              method,
+				"concatenate_sources": concatenateSources,
+				"base64encode":        base64encode,
+			},
+		}.WithTag(id).WithDescription(fmt.Sprintf("Compute the fingerprint as done by the fingerprint method %s", method)))
+
+	default:
+		processorMethod, ok := LogstashFingerprintMethodToProcessorMethod[method]
+		if !ok {
+			t.lossyAttribute(plugin, methodAttr, NotTranspiled, "method %s is not supported by the fingerprint processor", method)
+			return ingestProcessors, onFailureProcessors
+		}
+
+		// Without concatenate_sources each source overwrites the target, thus only the last one counts
+		if !concatenateSources {
+			fields = []string{toElasticPipelineSelector(sources[len(sources)-1])}
+		}
+
+		fp := FingerprintProcessor{
+			Fields:        fields,
+			TargetField:   target,
+			Method:        &processorMethod,
+			IgnoreMissing: pointer(true),
+		}.WithTag(id).(FingerprintProcessor)
+
+		if key != nil {
+			t.lossyAttribute(plugin, *key, PartiallyTranspiled, "the key is used as salt of the fingerprint processor, the hash is not an HMAC as computed by Logstash")
+			fp.Salt = pointer(getStringAttributeString(*key))
+		}
+		if base64encodeAttr != nil {
+			t.lossyAttribute(plugin, *base64encodeAttr, PartiallyTranspiled, "the fingerprint processor always encodes the hash in base64")
+		}
+		t.lossyPlugin(plugin, "the fingerprint processor hashes the names and the values of the fields in base64, the fingerprints differ from the Logstash ones")
+
+		ingestProcessors = append(ingestProcessors, fp)
+	}
+
+	return ingestProcessors, onFailureProcessors
+}
+
+// LogstashSplitMarkerField lists the fields that Logstash would have split into multiple events
+const LogstashSplitMarkerField = "_logstash_split"
+
+// Split Plugin of Logstash
+// Logstash splits one event into multiple events, while an Ingest Pipeline always outputs (at most) one document.
+// The closest representation splits the string into an array, and records the name of the array field in the
+// LogstashSplitMarkerField, so that the events can be split downstream (e.g., by the consumers of the index).
+func DealWithSplit(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor, []IngestProcessor) {
+	ingestProcessors := []IngestProcessor{}
+	onFailureProcessors := []IngestProcessor{}
+
+	field := "message"
+	terminator := "\n"
+	var target *string
+
+	for _, attr := range plugin.Attributes {
+		switch attr.Name() {
+		case "field":
+			field = getStringAttributeString(attr)
+		case "terminator":
+			terminator = getStringAttributeString(attr)
+		case "target":
+			target = pointer(getStringAttributeString(attr))
+		default:
+			t.unsupportedAttribute(plugin, attr)
+		}
+	}
+
+	t.lossyPlugin(plugin, "semantic divergence: Ingest Pipelines cannot split an event into multiple events, field '%s' is split into an array and its name is appended to '%s'", field, LogstashSplitMarkerField)
+
+	// Arrays are already split, strings are split by the terminator
+	isString := fmt.Sprintf("%s instanceof String", toElasticPipelineSelectorWithNullable(field, true))
+	resultField := field
+
+	if target != nil {
+		resultField = *target
+		ingestProcessors = append(ingestProcessors, SetProcessor{
+			Field:    toElasticPipelineSelector(resultField),
+			CopyFrom: toElasticPipelineSelector(field),
+		}.WithIf(pointer(fmt.Sprintf("%s instanceof List", toElasticPipelineSelectorWithNullable(field, true))), false).WithTag(fmt.Sprintf("%s-copy", id)))
+	}
+
+	sp := SplitProcessor{
+		Field:     toElasticPipelineSelector(field),
+		Separator: regexp.QuoteMeta(terminator),
+	}.WithIf(&isString, false).WithTag(id).(SplitProcessor)
+	if target != nil {
+		sp.TargetField = pointer(toElasticPipelineSelector(resultField))
+	}
+	ingestProcessors = append(ingestProcessors, sp)
+
+	ingestProcessors = append(ingestProcessors, AppendProcessor{
+		Field: LogstashSplitMarkerField,
+		Value: []string{toElasticPipelineSelector(resultField)},
+	}.WithIf(pointer(fmt.Sprintf("%s != null", toElasticPipelineSelectorWithNullable(resultField, true))), false).WithTag(fmt.Sprintf("%s-marker", id)).WithDescription("Mark the field that Logstash would have split into multiple events"))
+
+	return ingestProcessors, onFailureProcessors
+}
+
+// xmlNamePattern matches an XML (optionally prefixed) name, i.e., the steps of the supported XPath expressions
+var xmlNamePattern = regexp.MustCompile(`^[A-Za-z_][\w.-]*(:[A-Za-z_][\w.-]*)?$`)
+
+// xpathToParams converts a simple XPath expression like /a/b/text() or /a/b/@c to the path of element names
+// and the selected value (text() or the name of the attribute) evaluated by the script of the xml filter.
+func xpathToParams(xpath string) ([]string, string, error) {
+	if !strings.HasPrefix(xpath, "/") || strings.HasPrefix(xpath, "//") {
+		return nil, "", fmt.Errorf("only absolute paths are supported")
+	}
+	steps := strings.Split(xpath[1:], "/")
+	if len(steps) < 2 {
+		return nil, "", fmt.Errorf("the path should select text() or an attribute of an element")
+	}
+
+	selected := steps[len(steps)-1]
+	if selected != "text()" {
+		if !strings.HasPrefix(selected, "@") || !xmlNamePattern.MatchString(selected[1:]) {
+			return nil, "", fmt.Errorf("the last step '%s' should be text() or an attribute like @name", selected)
+		}
+		selected = selected[1:]
+	}
+
+	path := steps[:len(steps)-1]
+	for _, step := range path {
+		if !xmlNamePattern.MatchString(step) {
+			return nil, "", fmt.Errorf("the step '%s' is not an element name, predicates, wildcards, axes and functions are not supported", step)
+		}
+	}
+
+	return path, selected, nil
+}
+
+// XML Plugin of Logstash
+// There is no processor parsing XML, thus we rely on a script parsing the document in the structure
+// generated by Logstash (XmlSimple): the root element is discarded, attributes are keys, the text of
+// elements with attributes is stored in 'content' and, with force_array, every element is an array.
+// Only XPath expressions selecting the text or an attribute of elements by absolute path are supported.
+func DealWithXML(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor, []IngestProcessor) {
+	ingestProcessors := []IngestProcessor{}
+	onFailureProcessors := []IngestProcessor{}
+
+	var source *string
+	var target *string
+	storeXML := true
+	forceArray := true
+	forceContent := false
+	suppressEmpty := true
+	removeNamespaces := false
+	xpaths := []map[string]interface{}{}
+
+	for _, attr := range plugin.Attributes {
+		switch attr.Name() {
+		case "source":
+			source = pointer(getStringAttributeString(attr))
+		case "target":
+			target = pointer(getStringAttributeString(attr))
+		case "store_xml":
+			storeXML = getBoolValue(attr)
+		case "force_array":
+			forceArray = getBoolValue(attr)
+		case "force_content":
+			forceContent = getBoolValue(attr)
+		case "suppress_empty":
+			suppressEmpty = getBoolValue(attr)
+		case "remove_namespaces":
+			removeNamespaces = getBoolValue(attr)
+		case "xpath":
+			hash, ok := attr.(ast.HashAttribute)
+			if !ok {
+				t.unsupportedAttribute(plugin, attr)
+				continue
+			}
+			for _, entry := range hash.Entries {
+				key, ok := entry.Key.(ast.StringAttribute)
+				if !ok {
+					t.lossyAttribute(plugin, attr, PartiallyTranspiled, "the XPath expression %s should be a string", entry.Key.ValueString())
+					continue
+				}
+				expression := key.Value()
+				path, selected, err := xpathToParams(expression)
+				if err != nil {
+					t.lossyAttribute(plugin, attr, PartiallyTranspiled, "unsupported XPath expression '%s': %v", expression, err)
+					continue
+				}
+				xpaths = append(xpaths, map[string]interface{}{
+					"path":   path,
+					"select": selected,
+					"target": toElasticPipelineSelector(getStringAttributeString(entry.Value)),
+				})
+			}
+		default:
+			t.unsupportedAttribute(plugin, attr)
+		}
+	}
+
+	if source == nil {
+		t.lossyPlugin(plugin, "the source is required, the plugin is skipped")
+		return ingestProcessors, onFailureProcessors
+	}
+	if storeXML && target == nil {
+		t.lossyPlugin(plugin, "the target is required when store_xml is true, the plugin is skipped")
+		return ingestProcessors, onFailureProcessors
+	}
+	if !storeXML && len(xpaths) == 0 {
+		return ingestProcessors, onFailureProcessors
+	}
+
+	params := map[string]interface{}{
+		"source":            toElasticPipelineSelector(*source),
+		"store_xml":         storeXML,
+		"force_array":       forceArray,
+		"force_content":     forceContent,
+		"suppress_empty":    suppressEmpty,
+		"remove_namespaces": removeNamespaces,
+		"xpath":             xpaths,
+	}
+	if target != nil {
+		params["target"] = toElasticPipelineSelector(*target)
+	}
+
+	ingestProcessors = append(ingestProcessors, ScriptProcessor{
+		Source: pointer(`int find(String s, String token, int from) {
+  int i = s.indexOf(token, from);
+  if (i < 0) {
+    throw new IllegalArgumentException('malformed XML: ' + token + ' expected');
+  }
+  return i;
+}
+String unescape(String v) {
+  return v.replace('&lt;', '<').replace('&gt;', '>').replace('&quot;', '"').replace('&apos;', "'").replace('&amp;', '&');
+}
+String name(String n, Map o) {
+  int i = n.indexOf(':');
+  return o.remove_namespaces && i >= 0 ? n.substring(i + 1) : n;
+}
+void whitespaces(String s, int[] p) {
+  while (p[0] < s.length() && Character.isWhitespace(s.charAt(p[0]))) {
+    p[0]++;
+  }
+}
+void skip(String s, int[] p) {
+  whitespaces(s, p);
+  while (s.startsWith('<?', p[0]) || s.startsWith('<!', p[0])) {
+    if (s.startsWith('<?', p[0])) {
+      p[0] = find(s, '?>', p[0]) + 2;
+    } else if (s.startsWith('<!--', p[0])) {
+      p[0] = find(s, '-->', p[0]) + 3;
+    } else {
+      p[0] = find(s, '>', p[0]) + 1;
+    }
+    whitespaces(s, p);
+  }
+}
+void add(Map node, String key, def value, Map o) {
+  if (value == null) {
+    return;
+  }
+  def current = node.get(key);
+  if (current == null) {
+    node.put(key, o.force_array ? [value] : value);
+  } else if (current instanceof List) {
+    current.add(value);
+  } else {
+    node.put(key, [current, value]);
+  }
+}
+def finish(Map node, String text, Map o) {
+  if (text.trim().isEmpty()) {
+    text = '';
+  }
+  if (node.isEmpty() && text.isEmpty()) {
+    return o.suppress_empty ? null : node;
+  }
+  if (node.isEmpty() && !o.force_content) {
+    return text;
+  }
+  if (!text.isEmpty()) {
+    node.put('content', text);
+  }
+  return node;
+}
+List element(String s, int[] p, Map o) {
+  p[0]++;
+  int start = p[0];
+  while (p[0] < s.length() && !Character.isWhitespace(s.charAt(p[0])) && !s.startsWith('>', p[0]) && !s.startsWith('/', p[0])) {
+    p[0]++;
+  }
+  String tag = name(s.substring(start, p[0]), o);
+  Map node = new LinkedHashMap();
+  whitespaces(s, p);
+  while (!s.startsWith('>', p[0])) {
+    if (s.startsWith('/>', p[0])) {
+      p[0] += 2;
+      return [tag, finish(node, '', o)];
+    }
+    int eq = find(s, '=', p[0]);
+    String attribute = s.substring(p[0], eq).trim();
+    p[0] = eq + 1;
+    whitespaces(s, p);
+    String quote = s.substring(p[0], p[0] + 1);
+    int close = find(s, quote, p[0] + 1);
+    String value = unescape(s.substring(p[0] + 1, close));
+    p[0] = close + 1;
+    if (!o.remove_namespaces || (attribute != 'xmlns' && !attribute.startsWith('xmlns:'))) {
+      node.put(name(attribute, o), value);
+    }
+    whitespaces(s, p);
+  }
+  p[0]++;
+  String text = '';
+  while (p[0] < s.length()) {
+    if (s.startsWith('</', p[0])) {
+      p[0] = find(s, '>', p[0]) + 1;
+      return [tag, finish(node, text, o)];
+    } else if (s.startsWith('<![CDATA[', p[0])) {
+      int end = find(s, ']]>', p[0]);
+      text += s.substring(p[0] + 9, end);
+      p[0] = end + 3;
+    } else if (s.startsWith('<!', p[0]) || s.startsWith('<?', p[0])) {
+      skip(s, p);
+    } else if (s.startsWith('<', p[0])) {
+      List child = element(s, p, o);
+      add(node, child[0], child[1], o);
+    } else {
+      int end = find(s, '<', p[0]);
+      text += unescape(s.substring(p[0], end));
+      p[0] = end;
+    }
+  }
+  throw new IllegalArgumentException('malformed XML: </' + tag + '> expected');
+}
+List parse(String s, Map o) {
+  int[] p = new int[] {0};
+  skip(s, p);
+  if (!s.startsWith('<', p[0])) {
+    throw new IllegalArgumentException('malformed XML: root element expected');
+  }
+  return element(s, p, o);
+}
+String xml = $(params.source, null);
+if (params.store_xml) {
+  def value = parse(xml, params)[1];
+  field(params.target).set(value == null ? new HashMap() : value);
+}
+if (!params.xpath.isEmpty()) {
+  Map o = new HashMap(params);
+  o.force_array = true;
+  o.force_content = false;
+  o.suppress_empty = true;
+  List root = parse(xml, o);
+  for (Map x : params.xpath) {
+    List nodes = x.path[0] == root[0] ? [root[1]] : [];
+    for (int i = 1; i < x.path.size(); i++) {
+      List next = [];
+      for (def n : nodes) {
+        if (n instanceof Map && n.get(x.path[i]) instanceof List) {
+          next.addAll(n.get(x.path[i]));
+        }
+      }
+      nodes = next;
+    }
+    List values = [];
+    for (def n : nodes) {
+      def v = n instanceof Map ? n.get(x.select == 'text()' ? 'content' : x.select) : (x.select == 'text()' ? n : null);
+      if (v instanceof String) {
+        values.add(v);
+      }
+    }
+    if (!values.isEmpty()) {
+      def current = $(x.target, null);
+      if (current instanceof List) {
+        current.addAll(values);
+      } else {
+        if (current != null) {
+          values.add(0, current);
+        }
+        field(x.target).set(values);
+      }
+    }
+  }
+}`),
+		Params: &params,
+	}.WithIf(pointer(fmt.Sprintf("%s instanceof String", toElasticPipelineSelectorWithNullable(*source, true))), false).
+		WithTag(id).
+		WithDescription(fmt.Sprintf("Parse the XML document in field '%s'", *source)))
+
+	onFailureProcessors = DealWithTagOnFailure(ast.NewArrayAttribute("tag_on_failure", ast.NewStringAttribute("", "_xmlparsefailure", ast.DoubleQuoted)), id, t)
+
+	return ingestProcessors, onFailureProcessors
+}
+
+// Bytes Plugin of Logstash
+// With the default binary conversion and decimal separator, the Bytes Processor is used. Notice that it
+// does not accept some notations parsed by Logstash (e.g., 1KiB or 1,024KB), which are tagged as failures.
+// The metric conversion and the comma decimal separator rely on a script parsing the sizes as Logstash.
+func DealWithBytes(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor, []IngestProcessor) {
+	ingestProcessors := []IngestProcessor{}
+	onFailureProcessors := []IngestProcessor{}
+
+	source := "message"
+	var target *string
+	conversionMethod := "binary"
+	decimalSeparator := "."
+
+	for _, attr := range plugin.Attributes {
+		switch attr.Name() {
+		case "source":
+			source = getStringAttributeString(attr)
+		case "target":
+			target = pointer(getStringAttributeString(attr))
+		case "conversion_method":
+			conversionMethod = getStringAttributeString(attr)
+		case "decimal_separator":
+			decimalSeparator = getStringAttributeString(attr)
+		case "tag_on_failure":
+			onFailureProcessors = DealWithTagOnFailure(attr, id, t)
+		default:
+			t.unsupportedAttribute(plugin, attr)
+		}
+	}
+
+	if target == nil {
+		t.lossyPlugin(plugin, "the target is required, the plugin is skipped")
+		return ingestProcessors, onFailureProcessors
+	}
+
+	if len(onFailureProcessors) == 0 {
+		onFailureProcessors = DealWithTagOnFailure(ast.NewArrayAttribute("tag_on_failure", ast.NewStringAttribute("", "_bytesparsefailure", ast.DoubleQuoted)), id, t)
+	}
+
+	if conversionMethod == "binary" && decimalSeparator == "." {
+		ingestProcessors = append(ingestProcessors, BytesProcessor{
+			Field:         toElasticPipelineSelector(source),
+			TargetField:   pointer(toElasticPipelineSelector(*target)),
+			IgnoreMissing: pointer(true),
+		}.WithTag(id).WithDescription(fmt.Sprintf("Convert the size in field '%s' to bytes", source)))
+		return ingestProcessors, onFailureProcessors
+	}
+
+	base := 1024
+	if conversionMethod == "metric" {
+		base = 1000
+	}
+
+	ingestProcessors = append(ingestProcessors, ScriptProcessor{
+		Source: pointer(`String v = $(params.source, null).toString().trim();
+int i = 0;
+while (i < v.length() && '0123456789.,'.indexOf(v.substring(i, i + 1)) >= 0) {
+  i++;
+}
+if (i == 0) {
+  throw new IllegalArgumentException('no size found in ' + v);
+}
+String number = v.substring(0, i);
+number = params.decimal_separator == ',' ? number.replace('.', '').replace(',', '.') : number.replace(',', '');
+String unit = v.substring(i).trim().toLowerCase();
+int power = unit.isEmpty() ? 0 : 'bkmgtpe'.indexOf(unit.substring(0, 1));
+if (power < 0) {
+  throw new IllegalArgumentException('unknown unit ' + unit);
+}
+field(params.target).set((long) (Double.parseDouble(number) * Math.pow(params.base, power)));`),
+		Params: &map[string]interface{}{
+			"source":            toElasticPipelineSelector(source),
+			"target":            toElasticPipelineSelector(*target),
+			"base":              base,
+			"decimal_separator": decimalSeparator,
+		},
+	}.WithIf(pointer(fmt.Sprintf("%s != null", toElasticPipelineSelectorWithNullable(source, true))), false).
+		WithTag(id).
+		WithDescription(fmt.Sprintf("Convert the size in field '%s' to bytes", source)))
+
+	return ingestProcessors, onFailureProcessors
+}
+
+// UUID Plugin of Logstash
+func DealWithUUID(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor, []IngestProcessor) {
+	ingestProcessors := []IngestProcessor{}
+	onFailureProcessors := []IngestProcessor{}
+
+	var target *string
+	overwrite := false
+
+	for _, attr := range plugin.Attributes {
+		switch attr.Name() {
+		case "target":
+			target = pointer(getStringAttributeString(attr))
+		case "overwrite":
+			overwrite = getBoolValue(attr)
+		default:
+			t.unsupportedAttribute(plugin, attr)
+		}
+	}
+
+	if target == nil {
+		t.lossyPlugin(plugin, "the required attribute 'target' is missing, skipping the plugin")
+		return ingestProcessors, onFailureProcessors
+	}
+
+	sp := ScriptProcessor{
+		Source: pointer("field(params.target).set(UUID.randomUUID().toString());"),
+		Params: &map[string]interface{}{"target": toElasticPipelineSelector(*target)},
+	}.WithTag(id).WithDescription(fmt.Sprintf("Set a random UUID in field '%s'", *target))
+
+	// Without overwrite, an existing value is kept
+	if !overwrite {
+		sp = sp.WithIf(pointer(fmt.Sprintf("%s == null", toElasticPipelineSelectorWithNullable(*target, true))), false)
+	}
+
+	ingestProcessors = append(ingestProcessors, sp)
+
+	return ingestProcessors, onFailureProcessors
+}
+
+// De_dot Plugin of Logstash
+// With nested => true and recursive => false, the fields are expanded with dot_expander processors. The other
+// cases, i.e., replacing the dots with the separator or expanding the sub-fields recursively, rely on a script.
+func DealWithDeDot(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor, []IngestProcessor) {
+	ingestProcessors := []IngestProcessor{}
+	onFailureProcessors := []IngestProcessor{}
+
+	var fields []string
+	separator := "_"
+	nested := false
+	recursive := true
+
+	for _, attr := range plugin.Attributes {
+		switch attr.Name() {
+		case "fields":
+			fields = getArrayStringAttributeOrStringAttrubute(attr)
+		case "separator":
+			separator = getStringAttributeString(attr)
+		case "nested":
+			nested = getBoolValue(attr)
+		case "recursive":
+			recursive = getBoolValue(attr)
+		default:
+			t.unsupportedAttribute(plugin, attr)
+		}
+	}
+
+	// A field reference like [foo][bar.suffix] is the key bar.suffix of the field foo
+	paths := [][]string{}
+	for _, f := range fields {
+		paths = append(paths, returnSubFields(f))
+	}
+
+	if nested && !recursive {
+		if fields == nil {
+			paths = [][]string{{"*"}}
+		}
+		for _, path := range paths {
+			dep := DotExpanderProcessor{
+				Field:    path[len(path)-1],
+				Override: pointer(true),
+			}.WithTag(id).(DotExpanderProcessor)
+			if len(path) > 1 {
+				dep.Path = pointer(strings.Join(path[:len(path)-1], "."))
+			}
+			ingestProcessors = append(ingestProcessors, dep)
+		}
+		return ingestProcessors, onFailureProcessors
+	}
+
+	params := map[string]interface{}{
+		"separator": separator,
+		"nested":    nested,
+		"recursive": recursive,
+	}
+	apply := "dedot(ctx, params.separator, params.nested, params.recursive);"
+	if fields != nil {
+		params["fields"] = paths
+		apply = `for (List path : params.fields) {
+  def parent = ctx;
+  for (int i = 0; i < path.size() - 1 && parent instanceof Map; i++) {
+    parent = parent.get(path[i]);
+  }
+  String k = path[path.size() - 1];
+  if (parent instanceof Map && parent.containsKey(k)) {
+    def v = parent.remove(k);
+    if (params.recursive && v instanceof Map) {
+      dedot(v, params.separator, params.nested, params.recursive);
+    }
+    put(parent, k, v, params.separator, params.nested);
+  }
+}`
+	}
+
+	ingestProcessors = append(ingestProcessors, ScriptProcessor{
+		Source: pointer(`void put(Map m, String k, def v, String separator, boolean nested) {
+  if (!nested) {
+    m.put(k.replace('.', separator), v);
+    return;
+  }
+  String[] parts = k.splitOnToken('.');
+  def current = m;
+  for (int i = 0; i < parts.length - 1; i++) {
+    if (!(current.get(parts[i]) instanceof Map)) {
+      current.put(parts[i], new HashMap());
+    }
+    current = current.get(parts[i]);
+  }
+  current.put(parts[parts.length - 1], v);
+}
+void dedot(Map m, String separator, boolean nested, boolean recursive) {
+  for (String k : new ArrayList(m.keySet())) {
+    def v = m.get(k);
+    if (recursive && v instanceof Map) {
+      dedot(v, separator, nested, recursive);
+    }
+    if (k.contains('.')) {
+      m.remove(k);
+      put(m, k, v, separator, nested);
+    }
+  }
+}
+` + apply),
+		Params: &params,
+	}.WithTag(id).WithDescription("Replace the dots in the field names as done by the de_dot filter"))
+
+	return ingestProcessors, onFailureProcessors
+}
 
 func DealWithSyslogPri(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor, []IngestProcessor) {
 	ingestProcessors := []IngestProcessor{}
@@ -1311,7 +2439,7 @@ func DealWithSyslogPri(plugin ast.Plugin, id string, t Transpile) ([]IngestProce
 
 	setValuesString := ""
 
-	log.Warn().Msgf("[Plugin %s] The Ingest processor script assumes that the field pri is already numeric and does not attempt to deal with other types", plugin.Name())
+	t.lossyPlugin(plugin, "the Ingest processor script assumes that the field pri is already numeric and does not attempt to deal with other types")
 	extractValue := fmt.Sprintf(`
 int pri = $('%s', 13);
 int severity = pri & 0x7;
@@ -1378,7 +2506,7 @@ func DealWithMutate(plugin ast.Plugin, id string, t Transpile) ([]IngestProcesso
 		if attr.Name() == "tag_on_failure" {
 			continue
 		}
-		ingestProcessors = DealWithMutateAttributes(attr, ingestProcessors, id)
+		ingestProcessors = DealWithMutateAttributes(plugin, attr, ingestProcessors, id, t)
 	}
 
 	// log.Debug().Msgf("Length: %d", len(ingestProcessors))
@@ -1391,16 +2519,19 @@ func (t Transpile) DealWithPlugin(section string, plugin ast.Plugin, constraint
 	id := getProcessorID(plugin)
 	log.Debug().Msgf("Plugin ID is %s", id)
 
+	t.coverage.begin(section, plugin, id)
+
 	DealWithPluginFunction, ok := transpiler[section][plugin.Name()]
 	if !ok {
 		log.Warn().Msgf("There is no handler for the %s plugin of type '%s' (with id '%s')\nReturning an empty processors list", section, plugin.Name(), id)
+		t.coverage.plugin(NotTranspiled, fmt.Sprintf("there is no handler for the %s plugin", section))
 		return []IngestProcessor{}
 	}
 
 	constraintTranspiled := transpileConstraint(constraint)
 
 	onSuccessCondition := pointer(fmt.Sprintf("!(%s)", getIfFieldDefined(getUniqueOnFailureAddField(id))))
-	onSuccessProcessors := DealWithCommonAttributes(plugin)
+	onSuccessProcessors := DealWithCommonAttributes(plugin, t)
 	for i := range onSuccessProcessors {
 		// log.Info().Msgf("[%d] = %s %s", i, constraintTranspiled, onSuccessCondition)
 		onSuccessProcessors[i] = onSuccessProcessors[i].WithIf(constraintTranspiled, false)
@@ -1426,9 +2557,15 @@ func (t Transpile) DealWithPlugin(section string, plugin ast.Plugin, constraint
 
 	// PA is a Plugin with only Plugin-Specific attributes (no id, no add_field etc.)
 	pa := ast.NewPlugin(plugin.Name(), noncommonattrs...)
+	pa.Start = plugin.Start
 
 	ingestProcessors, onFailureProcessors := DealWithPluginFunction(pa, id, t)
 
+	// The timestamps referenced by the attributes, e.g., %{+YYYY.MM.dd}, are computed before the processors using them
+	if len(ingestProcessors) > 0 {
+		ingestProcessors = append(t.sprintfTimestampProcessors(plugin, noncommonattrs...), ingestProcessors...)
+	}
+
 	// On Success Processors should be executed only when no Failure happened
 	if len(onSuccessProcessors) > 0 && t.deal_with_error_locally {
 		onFailureProcessors = append(onFailureProcessors, getTranspilerOnFailureProcessor(id))
@@ -1474,54 +2611,6 @@ func getProcessorID(plugin ast.Plugin) string {
 	return id
 }
 
-func DealWithKV(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor, []IngestProcessor) {
-	ingestProcessors := []IngestProcessor{}
-	onFailureProcessors := []IngestProcessor{}
-
-	kv := KVProcessor{
-		FieldSplit: " ",       // Default value in Logstash
-		Field:      "message", // Default value in Logstash
-		ValueSplit: "=",       // Default value in Logstash
-	}.WithTag(id).(KVProcessor)
-
-	for _, attr := range plugin.Attributes {
-		if Contains(CommonAttributes, attr.Name()) {
-			continue
-		}
-		switch attr.Name() {
-		// It is a common field
-		case "tag_on_failure":
-			onFailureProcessors = DealWithTagOnFailure(attr, id, t)
-		case "target":
-			kv.TargetField = pointer(getStringAttributeString(attr))
-		case "prefix":
-			kv.Prefix = pointer(getStringAttributeString(attr))
-		case "field_split":
-			kv.FieldSplit = getStringAttributeString(attr) // TODO: De-Escape chars???
-		case "exclude_keys":
-			kv.ExcludeKeys = getArrayStringAttributes(attr)
-		case "include_keys":
-			kv.IncludeKeys = getArrayStringAttributes(attr)
-		case "include_brackets":
-			kv.StripBrackets = !getBoolValue(attr)
-		case "source":
-			kv.Field = getStringAttributeString(attr)
-		case "value_split":
-			kv.ValueSplit = getStringAttributeString(attr)
-		default:
-			log.Warn().Msgf("Attribute '%s' is currently not supported", attr.Name())
-
-		}
-	}
-	// Add _kv_filter_error
-	if len(kv.OnFailure) == 0 {
-		onFailureProcessors = DealWithTagOnFailure(ast.NewArrayAttribute("tag_on_failure", ast.NewStringAttribute("", "_kv_filter_error", ast.DoubleQuoted)), id, t)
-	}
-	ingestProcessors = append(ingestProcessors, kv)
-
-	return ingestProcessors, onFailureProcessors
-}
-
 func DealWithJSON(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor, []IngestProcessor) {
 	ingestProcessors := []IngestProcessor{}
 	onFailureProcessors := []IngestProcessor{}
@@ -1538,7 +2627,7 @@ func DealWithJSON(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor,
 		case "target":
 			json.TargetField = getStringAttributeString(attr)
 		default:
-			log.Warn().Msgf("Attribute '%s' is currently not supported", attr.Name())
+			t.unsupportedAttribute(plugin, attr)
 
 		}
 	}
@@ -1578,7 +2667,7 @@ func DealWithDissect(plugin ast.Plugin, id string, t Transpile) ([]IngestProcess
 				cType, ok := convertdatatypeMap[ttype]
 
 				if !ok {
-					log.Warn().Msgf("Type %s not yet supported in convert_datatype", ttype)
+					t.lossyAttribute(plugin, attr, PartiallyTranspiled, "type %s not yet supported in convert_datatype", ttype)
 				} else {
 					onSuccessProcessors = append(onSuccessProcessors, ConvertProcessor{
 						Field: convertKeys[i],
@@ -1591,12 +2680,12 @@ func DealWithDissect(plugin ast.Plugin, id string, t Transpile) ([]IngestProcess
 		case "mapping":
 			keys, values := getHashAttributeKeyValue(attr)
 			if len(keys) != 1 {
-				log.Warn().Msgf("[Pos %s][Plugin %s] Attribute '%s' only one map is supported. Consider splitting the original in two dissect filters", plugin.Pos(), plugin.Name(), attr.Name())
+				t.lossyAttribute(plugin, attr, PartiallyTranspiled, "only one map is supported. Consider splitting the original in two dissect filters")
 			}
 			proc.Field = keys[0]
 			proc.Pattern, _ = toElasticPipelineSelectorExpression(values[0], DissectContext)
 		default:
-			log.Warn().Msgf("[Pos %s][Plugin %s] Attribute '%s' is currently not supported", plugin.Pos(), plugin.Name(), attr.Name())
+			t.unsupportedAttribute(plugin, attr)
 		}
 	}
 	// Add dissect failure default tag
@@ -1634,7 +2723,7 @@ func DealWithOutputPipeline(plugin ast.Plugin, id string, t Transpile) ([]Ingest
 			}
 
 		default:
-			log.Warn().Msgf("[Pos %s][Plugin %s] Attribute '%s' is currently not supported", plugin.Pos(), plugin.Name(), attr.Name())
+			t.unsupportedAttribute(plugin, attr)
 		}
 
 	}
@@ -1642,7 +2731,7 @@ func DealWithOutputPipeline(plugin ast.Plugin, id string, t Transpile) ([]Ingest
 }
 
 func DealWithPrune(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor, []IngestProcessor) {
-	log.Warn().Msgf("Support for prune filter is really minimal: Only whitelist_names without regexps are supported")
+	t.lossyPlugin(plugin, "support for prune filter is really minimal: only whitelist_names without regexps are supported")
 	ingestProcessors := []IngestProcessor{}
 	onFailureProcessors := []IngestProcessor{}
 
@@ -1727,7 +2816,7 @@ func DealWithCSV(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor,
 				case "float":
 					onSuccessProcessors = append(onSuccessProcessors, ConvertProcessor{Field: keys[i], Type: values[i]})
 				default:
-					log.Warn().Msgf("Convert: %s is not yet supported", values[i])
+					t.lossyAttribute(plugin, attr, PartiallyTranspiled, "convert: %s is not yet supported", values[i])
 				}
 
 				onSuccessProcessors = append(onSuccessProcessors, ConvertProcessor{Field: keys[i], Type: values[i]})
@@ -1737,12 +2826,12 @@ func DealWithCSV(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor,
 			prefix = getStringAttributeString(attr)
 
 		default:
-			log.Warn().Msgf("[Pos %s][Plugin %s] Attribute '%s' is currently not supported", plugin.Pos(), plugin.Name(), attr.Name())
+			t.unsupportedAttribute(plugin, attr)
 		}
 	}
 
 	if autodetect_column_names {
-		log.Warn().Msgf("[Pos %s][Plugin %s] Autodetect column names (true) is not supported by Elasticsearch. Consider adding explicitely the columns", plugin.Pos(), plugin.Name())
+		t.lossyPlugin(plugin, "autodetect column names (true) is not supported by Elasticsearch. Consider adding explicitely the columns")
 	}
 
 	// Apply the target if present
@@ -1757,84 +2846,6 @@ func DealWithCSV(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor,
 	return ingestProcessors, onFailureProcessors
 }
 
-func DealWithTranslate(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor, []IngestProcessor) {
-	ingestProcessors := []IngestProcessor{}
-	onFailureProcessors := []IngestProcessor{}
-
-	proc := ScriptProcessor{}.WithTag(id).(ScriptProcessor)
-
-	params := make(map[string]interface{})
-
-	var target *string = nil
-	ECSCompatibility := "v8" // We assume ECS Compatibility
-	var dictionary map[string]string = make(map[string]string)
-	var source *string = nil
-
-	for _, attr := range plugin.Attributes {
-		switch attr.Name() {
-		// It is a common field
-		case "tag_on_failure":
-			onFailureProcessors = DealWithTagOnFailure(attr, id, t)
-		case "destination", "target":
-			target = pointer(getStringAttributeString(attr))
-
-		case "dictionary":
-
-			keys, values := getHashAttributeKeyValue(attr)
-			for i := range keys {
-				dictionary[keys[i]] = values[i]
-			}
-			params["dictionary"] = dictionary
-
-		case "ecs_compatibility":
-			ECSCompatibility = getStringAttributeString(attr)
-
-		case "field", "source":
-			source = pointer(getStringAttributeString(attr))
-
-		case "fallback":
-			params["fallback"] = getStringAttributeString(attr)
-
-		default:
-			log.Warn().Msgf("[Pos %s][Plugin %s] Attribute '%s' is currently not supported", plugin.Pos(), plugin.Name(), attr.Name())
-		}
-	}
-	// Post-Condition: Given that source is mandatory, source variable will always be a string
-
-	if target == nil {
-		switch ECSCompatibility {
-		case "disabled":
-			target = pointer("translation")
-		case "v1", "v8":
-			target = source
-		}
-	}
-	// Post-Condition: Translation will always be a string
-
-	proc.Params = &params
-
-	var b bytes.Buffer
-
-	// field := toElasticPipelineSelectorCondition(*source)
-	field := toElasticPipelineSelector(*source)
-
-	b.WriteString(fmt.Sprintf(`def tmp = params.dictionary[$('%s', '')];`, field))
-
-	if _, ok := params["fallback"]; ok {
-		b.WriteString(`if (tmp == null) { tmp = params.fallback; }`)
-	}
-
-	b.WriteString(fmt.Sprintf(`if (tmp != null) { field('%s').set(tmp); }`, field))
-
-	proc.Source = pointer(b.String())
-
-	proc.Description = pointer(fmt.Sprintf("Translate the field '%s' to field '%s'.", toElasticPipelineSelector(*source), toElasticPipelineSelector(*target)))
-
-	ingestProcessors = append(ingestProcessors, proc)
-
-	return ingestProcessors, onFailureProcessors
-}
-
 func DealWithMissingTranspiler(plugin ast.Plugin, constraint Constraints) []IngestProcessor {
 	constraintTranspiled := transpileConstraint(constraint)
 	if constraintTranspiled == nil {
@@ -1862,24 +2873,167 @@ func transpileConstraint(constraint Constraints) *string {
 	return &converted
 }
 
-// The Elasticsearch Output has a complex logic, we are (as of now) only interested in the pipeline used (if any)
+// Attributes of the Elasticsearch output that only configure the connection to the cluster
+// or the way Logstash sends the bulk requests. They have no equivalent in an Ingest Pipeline.
+var ElasticsearchOutputOnlyAttributes = []string{
+	"action", "api_key", "bulk_path", "ca_trusted_fingerprint", "cloud_auth", "cloud_id", "compression_level",
+	"custom_headers", "dlq_custom_codes", "dlq_on_failed_indexname_interpolation", "doc_as_upsert", "document_type",
+	"failure_type_logging_whitelist", "healthcheck_path", "hosts", "http_compression", "ilm_enabled", "ilm_pattern",
+	"ilm_policy", "ilm_rollover_alias", "join_field", "manage_template", "parameters", "parent", "password", "path",
+	"pool_max", "pool_max_per_route", "proxy", "resurrect_delay", "retry_initial_interval", "retry_max_interval",
+	"retry_on_conflict", "script", "script_lang", "script_type", "script_var_name", "scripted_upsert", "silence_errors_in_log",
+	"sniffing", "sniffing_delay", "sniffing_path", "ssl", "ssl_certificate", "ssl_certificate_authorities",
+	"ssl_certificate_verification", "ssl_cipher_suites", "ssl_enabled", "ssl_key", "ssl_keystore_password",
+	"ssl_keystore_path", "ssl_keystore_type", "ssl_supported_protocols", "ssl_truststore_password", "ssl_truststore_path",
+	"ssl_truststore_type", "ssl_verification_mode", "template", "template_api", "template_name", "template_overwrite",
+	"timeout", "upsert", "user", "validate_after_inactivity", "version", "version_type",
+}
+
+// Fields of the Ingest Document that determine where (and how) the document is indexed
+var ElasticsearchOutputMetadataFields = map[string]string{
+	"index":       "_index",
+	"document_id": "_id",
+	"routing":     "_routing",
+}
+
+// Settings of the Elasticsearch output used to determine the target data stream
+type DataStreamSettings struct {
+	Enabled     string
+	Type        string
+	Dataset     string
+	Namespace   string
+	AutoRouting bool
+	SyncFields  bool
+}
+
+// Default values of the Elasticsearch output
+func NewDataStreamSettings() DataStreamSettings {
+	return DataStreamSettings{
+		Enabled:     "false",
+		Type:        "logs",
+		Dataset:     "generic",
+		Namespace:   "default",
+		AutoRouting: true,
+		SyncFields:  true,
+	}
+}
+
+// dealWithDataStream returns the processors routing the document to the data stream `<type>-<dataset>-<namespace>`.
+// Logstash (with data_stream_auto_routing) prefers the values of the data_stream.* fields of the event over the configured ones
+// and (with data_stream_sync_fields) writes the values used back to the event.
+func dealWithDataStream(ds DataStreamSettings, id string) []IngestProcessor {
+	ingestProcessors := []IngestProcessor{}
+	fields := []string{"type", "dataset", "namespace"}
+	values := []string{ds.Type, ds.Dataset, ds.Namespace}
+
+	if !ds.SyncFields && ds.AutoRouting {
+		params := map[string]interface{}{
+			"type":      ds.Type,
+			"dataset":   ds.Dataset,
+			"namespace": ds.Namespace,
+		}
+		return append(ingestProcessors, ScriptProcessor{
+			Source: pointer(`ctx._index = $('data_stream.type', params.type) + '-' + $('data_stream.dataset', params.dataset) + '-' + $('data_stream.namespace', params.namespace);`),
+			Params: &params,
+		}.WithTag(fmt.Sprintf("%s-data-stream", id)).
+			WithDescription("Route the document to the data stream defined by the data_stream.* fields, falling back to the Elasticsearch output settings"))
+	}
+
+	index := strings.Join(values, "-")
+
+	if ds.SyncFields {
+		for i := range fields {
+			ingestProcessors = append(ingestProcessors, SetProcessor{
+				Field:    "data_stream." + fields[i],
+				Value:    values[i],
+				Override: pointer(!ds.AutoRouting),
+			}.WithTag(fmt.Sprintf("%s-data-stream-%s", id, fields[i])).
+				WithDescription(fmt.Sprintf("Set 'data_stream.%s' to '%s' as done by the Elasticsearch output option 'data_stream_%s'", fields[i], values[i], fields[i])))
+		}
+		if ds.AutoRouting {
+			index = "{{{data_stream.type}}}-{{{data_stream.dataset}}}-{{{data_stream.namespace}}}"
+		}
+	}
+
+	return append(ingestProcessors, SetProcessor{
+		Field:    "_index",
+		Value:    index,
+		Override: pointer(true),
+	}.WithTag(fmt.Sprintf("%s-data-stream", id)).
+		WithDescription(fmt.Sprintf("Route the document to the data stream '%s'", index)))
+}
+
+// The Elasticsearch Output has a complex logic. We translate the options that influence where the document is
+// stored (index, document_id, routing, data_stream_*) into set processors on the corresponding metadata fields and the pipeline
+// option into a pipeline processor. Options that configure the connection to the cluster are ignored
 func DealWithOutputElasticsearch(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor, []IngestProcessor) {
 	ingestProcessors := []IngestProcessor{}
 	onFailureProcessors := []IngestProcessor{}
+	pipelineProcessors := []IngestProcessor{}
+
+	ds := NewDataStreamSettings()
+	indexDefined := false
 
 	for _, attr := range plugin.Attributes {
 		switch attr.Name() {
+		case "data_stream":
+			ds.Enabled = getStringAttributeString(attr)
+		case "data_stream_type":
+			ds.Type = getStringAttributeString(attr)
+		case "data_stream_dataset":
+			ds.Dataset = getStringAttributeString(attr)
+		case "data_stream_namespace":
+			ds.Namespace = getStringAttributeString(attr)
+		case "data_stream_auto_routing":
+			ds.AutoRouting = getBoolValue(attr)
+		case "data_stream_sync_fields":
+			ds.SyncFields = getBoolValue(attr)
+		case "index", "document_id", "routing":
+			if attr.Name() == "index" {
+				indexDefined = true
+			}
+			metadataField := ElasticsearchOutputMetadataFields[attr.Name()]
+			value, _ := toElasticPipelineSelectorExpression(getStringAttributeString(attr), ProcessorContext)
+			ingestProcessors = append(ingestProcessors, SetProcessor{
+				Field:    metadataField,
+				Value:    value,
+				Override: pointer(true),
+			}.WithTag(fmt.Sprintf("%s-%s", id, attr.Name())).
+				WithDescription(fmt.Sprintf("Set '%s' to '%s' as done by the Elasticsearch output option '%s'", metadataField, value, attr.Name())))
+
 		case "pipeline":
-			pipeline, _ := toElasticPipelineSelectorExpression(attr.ValueString(), ProcessorContext)
-			ingestProcessors = append(ingestProcessors, PipelineProcessor{
+			pipeline, _ := toElasticPipelineSelectorExpression(getStringAttributeString(attr), ProcessorContext)
+			pipelineProcessors = append(pipelineProcessors, PipelineProcessor{
 				Name: pipeline,
-			})
+			}.WithTag(fmt.Sprintf("%s-pipeline", id)))
 
 		default:
-			log.Warn().Msgf("[Pos %s][Plugin %s] Attribute '%s' is currently not supported", plugin.Pos(), plugin.Name(), attr.Name())
+			if Contains(ElasticsearchOutputOnlyAttributes, attr.Name()) {
+				t.lossyAttribute(plugin, attr, FullyTranspiled, "only applies to the Logstash output and has no equivalent in an Ingest Pipeline")
+			} else {
+				t.unsupportedAttribute(plugin, attr)
+			}
 		}
 
 	}
+
+	switch ds.Enabled {
+	case "true":
+		if indexDefined {
+			t.lossyPlugin(plugin, "the options 'index' and 'data_stream' are mutually exclusive in Logstash")
+		}
+		ingestProcessors = append(ingestProcessors, dealWithDataStream(ds, id)...)
+	case "auto":
+		// Logstash uses data streams only if the cluster supports them and no index specific option is set
+		if !indexDefined {
+			t.lossyPlugin(plugin, "'data_stream => auto' is transpiled assuming that the cluster supports data streams")
+			ingestProcessors = append(ingestProcessors, dealWithDataStream(ds, id)...)
+		}
+	}
+
+	// The pipeline is executed by Elasticsearch after the routing information has been determined
+	ingestProcessors = append(ingestProcessors, pipelineProcessors...)
+
 	return ingestProcessors, onFailureProcessors
 }
 
@@ -1896,7 +3050,50 @@ func getDefaultTranspilerOnFailureProcessor() []IngestProcessor {
 	}
 }
 
+// elasticsearchOutputBranches records, for each elasticsearch output, the branches leading to it, e.g., the else
+// block of the branch at 8:3 is "8:3 [90]/else"
+func elasticsearchOutputBranches(bops []ast.BranchOrPlugin, path []string, branches map[string][]string) {
+	for _, bop := range bops {
+		switch block := bop.(type) {
+		case ast.Plugin:
+			if block.Name() == "elasticsearch" {
+				branches[block.Pos().String()] = path
+			}
+		case ast.Branch:
+			arm := func(name string) []string {
+				return append(append([]string{}, path...), fmt.Sprintf("%s/%s", block.Pos(), name))
+			}
+			elasticsearchOutputBranches(block.IfBlock.Block, arm("if"), branches)
+			for i := range block.ElseIfBlock {
+				elasticsearchOutputBranches(block.ElseIfBlock[i].Block, arm(fmt.Sprintf("elif-%d", i)), branches)
+			}
+			elasticsearchOutputBranches(block.ElseBlock.Block, arm("else"), branches)
+		}
+	}
+}
+
+// exclusiveBranches returns whether the two paths of branches lead to different blocks of the same branch,
+// i.e., no event can follow both of them
+func exclusiveBranches(a []string, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] == b[i] {
+			continue
+		}
+		branchA, _, _ := strings.Cut(a[i], "/")
+		branchB, _, _ := strings.Cut(b[i], "/")
+		return branchA == branchB
+	}
+	return false
+}
+
+// BuildIngestPipelines transpiles the configuration read from filename, the main pipeline comes first
+func (t Transpile) BuildIngestPipelines(filename string, c ast.Config) []IngestPipeline {
+	return t.buildIngestPipeline(filename, c)
+}
+
 func (t Transpile) buildIngestPipeline(filename string, c ast.Config) []IngestPipeline {
+	t.coverage.reset()
+	t.configFile = filename
 	plugin_names := []string{}
 	fname := path.Base(filename)
 	ip := IngestPipeline{
@@ -1910,6 +3107,13 @@ func (t Transpile) buildIngestPipeline(filename string, c ast.Config) []IngestPi
 		ip.OnFailureProcessors = getDefaultTranspilerOnFailureProcessor()
 	}
 
+	// The branches of the elasticsearch outputs and the outputs transpiled so far
+	elasticsearchBranches := map[string][]string{}
+	for _, o := range c.Output {
+		elasticsearchOutputBranches(o.BranchOrPlugins, []string{}, elasticsearchBranches)
+	}
+	elasticsearchOutputs := []ast.Plugin{}
+
 	// apply func returns an ApplyPluginsFuncCondition object depending on the section
 	applyFunc := func(section string) ApplyPluginsFuncCondition {
 		var i int = 0
@@ -1918,6 +3122,19 @@ func (t Transpile) buildIngestPipeline(filename string, c ast.Config) []IngestPi
 
 			ip.Processors = append(ip.Processors, t.DealWithPlugin(section, *c.Plugin(), constraint)...)
 
+			// All the outputs are appended to the main pipeline, thus an event reaching several elasticsearch
+			// outputs (a Logstash fan-out) gets the metadata fields of the last one
+			if section == "output" && c.Plugin().Name() == "elasticsearch" {
+				branches := elasticsearchBranches[c.Plugin().Pos().String()]
+				for _, previous := range elasticsearchOutputs {
+					if !exclusiveBranches(branches, elasticsearchBranches[previous.Pos().String()]) {
+						t.lossyPlugin(*c.Plugin(), "the events reaching the elasticsearch output at %s as well are written only once, this output overwrites its _index, _id, routing and pipeline", previous.Pos())
+						break
+					}
+				}
+				elasticsearchOutputs = append(elasticsearchOutputs, *c.Plugin())
+			}
+
 			plugin_names = append(plugin_names, c.Plugin().Name())
 			i += 1
 		}
@@ -1926,9 +3143,12 @@ func (t Transpile) buildIngestPipeline(filename string, c ast.Config) []IngestPi
 	for _, f := range c.Filter {
 		t.MyIteration(f.BranchOrPlugins, NewConstraintLiteral(), applyFunc("filter"), &ip)
 	}
-	// for _, f := range c.Output {
-	// 	t.MyIteration(f.BranchOrPlugins, NewConstraintLiteral(), applyFunc("output"), &ip)
-	// }
+	// The output section uses its own prefix to avoid clashes with the branches of the filter section
+	for i, o := range c.Output {
+		output_ip := NewIngestPipeline(fmt.Sprintf("%s-output-%d", ip.Name, i))
+		t.MyIteration(o.BranchOrPlugins, NewConstraintLiteral(), applyFunc("output"), &output_ip)
+		ip.Processors = append(ip.Processors, output_ip.Processors...)
+	}
 
 	if t.addCleanUpProcessor {
 		ip.Processors = append(ip.Processors, RemoveProcessor{
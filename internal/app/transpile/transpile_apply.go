@@ -134,7 +134,7 @@ func (t Transpile) MyIteration(root []ast.BranchOrPlugin, constraint Constraints
 				if !t.fidelity {
 					cond = transpileConstraint(currentConstraints)
 				} else {
-					cond = pointer(fmt.Sprintf("ctx.%s['%s-elseif-%d']", TRANSPILER_PREFIX, branchName, i))
+					cond = pointer(fmt.Sprintf("ctx.%s['%s-elif-%d']", TRANSPILER_PREFIX, branchName, i))
 				}
 
 				t.mergeWithIPFidelity(ip, tmp_ip, cond)
@@ -145,7 +145,7 @@ func (t Transpile) MyIteration(root []ast.BranchOrPlugin, constraint Constraints
 
 			// Else
 			// else condition = "inherited + negate if condition + for 1..N negate else if $i condition"
-			tmp_ip = NewIngestPipeline(fmt.Sprintf("%s-elseß", branchName))
+			tmp_ip = NewIngestPipeline(fmt.Sprintf("%s-else", branchName))
 			t.MyIteration(block.ElseBlock.Block, NewConstraintLiteral(), applyPluginsFunc, &tmp_ip)
 
 			if !t.fidelity {
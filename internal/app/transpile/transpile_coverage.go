@@ -0,0 +1,260 @@
+package transpile
+
+import (
+	"bytes"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	ast "github.com/herrBez/baffo/ast"
+)
+
+// Coverage tells how much of a Logstash plugin (or attribute) has been transpiled
+type Coverage string
+
+const (
+	FullyTranspiled     Coverage = "full"
+	PartiallyTranspiled Coverage = "partial"
+	NotTranspiled       Coverage = "none"
+)
+
+// rank orders the coverage levels from the best to the worst one
+func (c Coverage) rank() int {
+	switch c {
+	case PartiallyTranspiled:
+		return 1
+	case NotTranspiled:
+		return 2
+	}
+	return 0
+}
+
+type AttributeCoverage struct {
+	Pos      string   `json:"pos"`
+	Name     string   `json:"name"`
+	Coverage Coverage `json:"coverage"`
+	Messages []string `json:"messages,omitempty"`
+}
+
+type PluginCoverage struct {
+	Pos        string              `json:"pos"`
+	Section    string              `json:"section"`
+	Name       string              `json:"name"`
+	ID         string              `json:"id"`
+	Coverage   Coverage            `json:"coverage"`
+	Messages   []string            `json:"messages,omitempty"`
+	Attributes []AttributeCoverage `json:"attributes,omitempty"`
+}
+
+// FileCoverage is the coverage report of a Logstash configuration file.
+// Percentage is the share of plugins that have been fully transpiled.
+type FileCoverage struct {
+	File                string           `json:"file"`
+	Error               string           `json:"error,omitempty"`
+	Plugins             []PluginCoverage `json:"plugins"`
+	FullyTranspiled     int              `json:"fully_transpiled"`
+	PartiallyTranspiled int              `json:"partially_transpiled"`
+	NotTranspiled       int              `json:"not_transpiled"`
+	Percentage          float64          `json:"coverage_percentage"`
+}
+
+// coverageRecorder collects the coverage of the plugins while they are transpiled.
+// It is shared by the copies of a Transpile, a nil recorder ignores the records.
+type coverageRecorder struct {
+	plugins []PluginCoverage
+}
+
+func newCoverageRecorder() *coverageRecorder {
+	return &coverageRecorder{plugins: []PluginCoverage{}}
+}
+
+func (r *coverageRecorder) reset() {
+	if r == nil {
+		return
+	}
+	r.plugins = []PluginCoverage{}
+}
+
+// begin records a plugin that is going to be transpiled, its attributes are fully transpiled until stated otherwise
+func (r *coverageRecorder) begin(section string, plugin ast.Plugin, id string) {
+	if r == nil {
+		return
+	}
+	pc := PluginCoverage{
+		Pos:        plugin.Pos().String(),
+		Section:    section,
+		Name:       plugin.Name(),
+		ID:         id,
+		Coverage:   FullyTranspiled,
+		Attributes: []AttributeCoverage{},
+	}
+	for _, attr := range plugin.Attributes {
+		if attr == nil {
+			continue
+		}
+		pc.Attributes = append(pc.Attributes, AttributeCoverage{
+			Pos:      attr.Pos().String(),
+			Name:     attr.Name(),
+			Coverage: FullyTranspiled,
+		})
+	}
+	r.plugins = append(r.plugins, pc)
+}
+
+func (r *coverageRecorder) current() *PluginCoverage {
+	if r == nil || len(r.plugins) == 0 {
+		return nil
+	}
+	return &r.plugins[len(r.plugins)-1]
+}
+
+// plugin lowers the coverage of the plugin being transpiled
+func (r *coverageRecorder) plugin(coverage Coverage, message string) {
+	pc := r.current()
+	if pc == nil {
+		return
+	}
+	if coverage.rank() > pc.Coverage.rank() {
+		pc.Coverage = coverage
+	}
+	pc.Messages = append(pc.Messages, message)
+}
+
+// attribute lowers the coverage of an attribute of the plugin being transpiled,
+// and, as a consequence, the one of the plugin
+func (r *coverageRecorder) attribute(attr ast.Attribute, coverage Coverage, message string) {
+	pc := r.current()
+	if pc == nil {
+		return
+	}
+	if coverage.rank() > 0 && pc.Coverage == FullyTranspiled {
+		pc.Coverage = PartiallyTranspiled
+	}
+
+	var ac *AttributeCoverage
+	for i := range pc.Attributes {
+		if pc.Attributes[i].Pos == attr.Pos().String() && pc.Attributes[i].Name == attr.Name() {
+			ac = &pc.Attributes[i]
+			break
+		}
+	}
+	if ac == nil {
+		for i := range pc.Attributes {
+			if pc.Attributes[i].Name == attr.Name() {
+				ac = &pc.Attributes[i]
+				break
+			}
+		}
+	}
+	if ac == nil {
+		pc.Messages = append(pc.Messages, fmt.Sprintf("%s: %s", attr.Name(), message))
+		return
+	}
+	if coverage.rank() > ac.Coverage.rank() {
+		ac.Coverage = coverage
+	}
+	ac.Messages = append(ac.Messages, message)
+}
+
+func (r *coverageRecorder) report(filename string) FileCoverage {
+	fc := FileCoverage{File: filename, Plugins: []PluginCoverage{}}
+	if r != nil {
+		fc.Plugins = append(fc.Plugins, r.plugins...)
+	}
+	for _, pc := range fc.Plugins {
+		switch pc.Coverage {
+		case FullyTranspiled:
+			fc.FullyTranspiled++
+		case PartiallyTranspiled:
+			fc.PartiallyTranspiled++
+		case NotTranspiled:
+			fc.NotTranspiled++
+		}
+	}
+	if len(fc.Plugins) > 0 {
+		fc.Percentage = 100 * float64(fc.FullyTranspiled) / float64(len(fc.Plugins))
+	} else {
+		fc.Percentage = 100
+	}
+	return fc
+}
+
+// Errors returns an error for each plugin or attribute that has not been fully transpiled
+func (fc FileCoverage) Errors() []error {
+	errs := []error{}
+	for _, pc := range fc.Plugins {
+		if pc.Coverage == FullyTranspiled {
+			continue
+		}
+		for _, message := range pc.Messages {
+			errs = append(errs, errors.Errorf("%s: [Pos %s][Plugin %s] %s", fc.File, pc.Pos, pc.Name, message))
+		}
+		for _, ac := range pc.Attributes {
+			if ac.Coverage == FullyTranspiled {
+				continue
+			}
+			for _, message := range ac.Messages {
+				errs = append(errs, errors.Errorf("%s: [Pos %s][Plugin %s] Attribute '%s': %s", fc.File, ac.Pos, pc.Name, ac.Name, message))
+			}
+		}
+	}
+	return errs
+}
+
+// unsupportedAttribute reports an attribute that has not been transpiled
+func (t Transpile) unsupportedAttribute(plugin ast.Plugin, attr ast.Attribute) {
+	log.Warn().Msgf("[Pos %s][Plugin %s] Attribute '%s' is currently not supported", plugin.Pos(), plugin.Name(), attr.Name())
+	t.coverage.attribute(attr, NotTranspiled, "attribute is currently not supported")
+}
+
+// lossyAttribute reports an attribute whose semantics is only partially kept in the Ingest Pipeline
+func (t Transpile) lossyAttribute(plugin ast.Plugin, attr ast.Attribute, coverage Coverage, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	log.Warn().Msgf("[Pos %s][Plugin %s] Attribute '%s': %s", plugin.Pos(), plugin.Name(), attr.Name(), message)
+	t.coverage.attribute(attr, coverage, message)
+}
+
+// lossyPlugin reports a plugin whose semantics is only partially kept in the Ingest Pipeline
+func (t Transpile) lossyPlugin(plugin ast.Plugin, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	log.Warn().Msgf("[Pos %s][Plugin %s] %s", plugin.Pos(), plugin.Name(), message)
+	t.coverage.plugin(PartiallyTranspiled, message)
+}
+
+func printCoverageTable(fcs []FileCoverage) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tPOS\tSECTION\tPLUGIN\tATTRIBUTE\tCOVERAGE\tMESSAGE")
+	for _, fc := range fcs {
+		if fc.Error != "" {
+			fmt.Fprintf(w, "%s\t\t\t\t\t%s\t%s\n", fc.File, NotTranspiled, fc.Error)
+		}
+		for _, pc := range fc.Plugins {
+			messages := pc.Messages
+			if len(messages) == 0 {
+				messages = []string{""}
+			}
+			for _, message := range messages {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\t%s\t%s\n", fc.File, pc.Pos, pc.Section, pc.Name, pc.Coverage, message)
+			}
+			for _, ac := range pc.Attributes {
+				if ac.Coverage == FullyTranspiled {
+					continue
+				}
+				for _, message := range ac.Messages {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", fc.File, ac.Pos, pc.Section, pc.Name, ac.Name, ac.Coverage, message)
+				}
+			}
+		}
+	}
+	w.Flush()
+
+	fmt.Fprintln(&buf)
+	for _, fc := range fcs {
+		fmt.Fprintf(&buf, "%s: %.1f%% coverage, %d plugins fully, %d partially and %d not transpiled\n",
+			fc.File, fc.Percentage, fc.FullyTranspiled, fc.PartiallyTranspiled, fc.NotTranspiled)
+	}
+	return buf.String()
+}
@@ -0,0 +1,205 @@
+package transpile
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	ast "github.com/herrBez/baffo/ast"
+	"github.com/herrBez/baffo/internal/javatime"
+)
+
+// The keywords of the date filter, the date processor supports them with the same name
+var dateKeywords = []string{javatime.ISO8601, javatime.UNIX, javatime.UNIXMS, javatime.TAI64N}
+
+// The Joda-Time pattern letters of the date filter without an equivalent in the java.time patterns of the date processor:
+// the century of era (C) and the ISO day of week (e), which is localized in java.time
+var jodaUnsupportedLetters = []rune{'C', 'e'}
+
+// jodaToJavaPattern converts a Joda-Time pattern, as used by the date filter, to a java.time pattern. It returns the
+// letters that have no equivalent, those are kept as is. The quoted literals are not converted.
+func jodaToJavaPattern(pattern string) (string, []string) {
+	var s strings.Builder
+	unsupported := []string{}
+	runes := []rune(pattern)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		if r == '\'' {
+			// A literal lasts up to the next single quote, two single quotes are a quote
+			j := i + 1
+			for j < len(runes) {
+				if runes[j] == '\'' {
+					if j+1 < len(runes) && runes[j+1] == '\'' {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			if j < len(runes) {
+				j++
+			}
+			s.WriteString(string(runes[i:j]))
+			i = j
+			continue
+		}
+
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			s.WriteRune(r)
+			i++
+			continue
+		}
+
+		count := 1
+		for i+count < len(runes) && runes[i+count] == r {
+			count++
+		}
+		letters := strings.Repeat(string(r), count)
+
+		switch r {
+		case 'Y':
+			// Year of era
+			letters = strings.Repeat("y", count)
+		case 'x':
+			// Week year
+			letters = strings.Repeat("Y", count)
+		case 'Z':
+			switch {
+			case count == 2:
+				// Offset with a colon, e.g., -08:00 or Z
+				letters = "XXX"
+			case count > 2:
+				// Time zone id, e.g., Europe/Rome
+				letters = "VV"
+			}
+		default:
+			for _, u := range jodaUnsupportedLetters {
+				if r == u && !Contains(unsupported, string(r)) {
+					unsupported = append(unsupported, string(r))
+				}
+			}
+		}
+		s.WriteString(letters)
+		i += count
+	}
+	return s.String(), unsupported
+}
+
+// A reference to the timestamp of the event formatted with a Joda-Time pattern (or %s for the epoch seconds), e.g., %{+YYYY.MM.dd}
+var sprintfTimestampReference = regexp.MustCompile(`%\{\+([^}]+)\}`)
+
+// sprintfTimestampKey returns the key of the timestamp in the given format. The characters that are not letters
+// or digits are escaped, so that distinct formats never share the same key.
+func sprintfTimestampKey(format string) string {
+	var key strings.Builder
+	for _, r := range format {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			key.WriteRune(r)
+		} else {
+			fmt.Fprintf(&key, "_%x", r)
+		}
+	}
+	return key.String()
+}
+
+// sprintfTimestampField returns the temporary field holding the timestamp of the event in the given format
+func sprintfTimestampField(format string) string {
+	return fmt.Sprintf("%s.timestamp.%s", TRANSPILER_PREFIX, sprintfTimestampKey(format))
+}
+
+// sprintfSelector returns the field referenced by a sprintf reference, e.g., %{[a][b]}. The timestamps, e.g.,
+// %{+YYYY}, are read from their temporary field, computed by the processors of sprintfTimestampProcessors.
+func sprintfSelector(reference string) string {
+	if m := sprintfTimestampReference.FindStringSubmatch(reference); m != nil {
+		return sprintfTimestampField(m[1])
+	}
+	return toElasticPipelineSelector(reference[2 : len(reference)-1])
+}
+
+// sprintfAttributeStrings returns the strings of the attributes, including the keys of the hashes, that may
+// reference the timestamp
+func sprintfAttributeStrings(attrs ...ast.Attribute) []string {
+	values := []string{}
+	for _, attr := range attrs {
+		switch tattr := attr.(type) {
+		case ast.StringAttribute:
+			values = append(values, tattr.Value())
+		case ast.ArrayAttribute:
+			values = append(values, sprintfAttributeStrings(tattr.Attributes...)...)
+		case ast.HashAttribute:
+			for _, entry := range tattr.Entries {
+				if key, ok := entry.Key.(ast.StringAttribute); ok {
+					values = append(values, key.Value())
+				} else {
+					values = append(values, entry.Key.ValueString())
+				}
+				values = append(values, sprintfAttributeStrings(entry.Value)...)
+			}
+		}
+	}
+	return values
+}
+
+// sprintfTimestampProcessors returns the processors computing the timestamps referenced by the strings of the
+// attributes, which toElasticPipelineSelectorExpression replaces with their temporary field. As done by Logstash,
+// the timestamp is formatted in UTC. An @timestamp that is a number is read as epoch milliseconds, an invalid one
+// is replaced with the current time as done by Logstash for the events with an invalid @timestamp.
+func (t Transpile) sprintfTimestampProcessors(plugin ast.Plugin, attrs ...ast.Attribute) []IngestProcessor {
+	formats := map[string]interface{}{}
+	for _, attr := range attrs {
+		for _, value := range sprintfAttributeStrings(attr) {
+			for _, m := range sprintfTimestampReference.FindAllStringSubmatch(value, -1) {
+				format := m[1]
+				if format != "%s" {
+					var unsupported []string
+					format, unsupported = jodaToJavaPattern(format)
+					if len(unsupported) > 0 {
+						// The pattern would make the script fail, the reference is an empty string
+						t.lossyAttribute(plugin, attr, PartiallyTranspiled, "the pattern letters %s of the timestamp format '%s' have no equivalent, the reference is an empty string", strings.Join(unsupported, ", "), m[1])
+						continue
+					}
+				}
+				formats[sprintfTimestampKey(m[1])] = format
+			}
+		}
+	}
+	if len(formats) == 0 {
+		return []IngestProcessor{}
+	}
+
+	params := map[string]interface{}{
+		"formats": formats,
+	}
+	return []IngestProcessor{
+		ScriptProcessor{
+			Source: pointer(`def ts = ctx['@timestamp'];
+ZonedDateTime date = ZonedDateTime.now(ZoneOffset.UTC);
+if (ts instanceof Number) {
+  date = Instant.ofEpochMilli(((Number) ts).longValue()).atZone(ZoneOffset.UTC);
+} else if (ts != null) {
+  try {
+    date = ZonedDateTime.parse(ts.toString()).withZoneSameInstant(ZoneOffset.UTC);
+  } catch (DateTimeParseException e) {
+    try {
+      date = LocalDateTime.parse(ts.toString()).atZone(ZoneOffset.UTC);
+    } catch (DateTimeParseException e2) {
+      date = ZonedDateTime.now(ZoneOffset.UTC);
+    }
+  }
+}
+if (ctx.` + TRANSPILER_PREFIX + ` == null) {
+  ctx.` + TRANSPILER_PREFIX + ` = new HashMap();
+}
+if (ctx.` + TRANSPILER_PREFIX + `.timestamp == null) {
+  ctx.` + TRANSPILER_PREFIX + `.timestamp = new HashMap();
+}
+for (def entry : params.formats.entrySet()) {
+  ctx.` + TRANSPILER_PREFIX + `.timestamp[entry.getKey()] = entry.getValue() == '%s' ? String.valueOf(date.toEpochSecond()) : date.format(DateTimeFormatter.ofPattern(entry.getValue()));
+}`),
+			Params: &params,
+		}.WithDescription("Format the timestamp of the event as referenced by the sprintf format"),
+	}
+}
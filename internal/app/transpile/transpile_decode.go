@@ -0,0 +1,207 @@
+package transpile
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Decoding of Ingest Pipeline definitions (e.g., the output of the transpile command) into the
+// IngestPipeline and IngestProcessor types
+
+type processorDecoder func(body []byte) (IngestProcessor, error)
+
+func decodeInto[T IngestProcessor](body []byte) (IngestProcessor, error) {
+	var p T
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func decodeCaseProcessor(caseType string) processorDecoder {
+	return func(body []byte) (IngestProcessor, error) {
+		var p CaseProcessor
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, err
+		}
+		p.Type = caseType
+		return p, nil
+	}
+}
+
+var processorDecoders = map[string]processorDecoder{
+	"set":          decodeInto[SetProcessor],
+	"remove":       decodeInto[RemoveProcessor],
+	"rename":       decodeInto[RenameProcessor],
+	"lowercase":    decodeCaseProcessor("lowercase"),
+	"uppercase":    decodeCaseProcessor("uppercase"),
+	"grok":         decodeInto[GrokProcessor],
+	"append":       decodeInto[AppendProcessor],
+	"gsub":         decodeInto[GsubProcessor],
+	"join":         decodeInto[JoinProcessor],
+	"kv":           decodeInto[KVProcessor],
+	"dissect":      decodeInto[DissectProcessor],
+	"date":         decodeInto[DateProcessor],
+	"drop":         decodeInto[DropProcessor],
+	"split":        decodeInto[SplitProcessor],
+	"trim":         decodeInto[TrimProcessor],
+	"pipeline":     decodeInto[PipelineProcessor],
+	"script":       decodeInto[ScriptProcessor],
+	"convert":      decodeInto[ConvertProcessor],
+	"geoip":        decodeInto[GeoIPProcessor],
+	"user_agent":   decodeInto[UserAgentProcessor],
+	"urldecode":    decodeInto[URLDecodeProcessor],
+	"csv":          decodeInto[CSVProcessor],
+	"json":         decodeInto[JSONProcessor],
+	"fingerprint":  decodeInto[FingerprintProcessor],
+	"dot_expander": decodeInto[DotExpanderProcessor],
+	"bytes":        decodeInto[BytesProcessor],
+	"enrich":       decodeInto[EnrichProcessor],
+}
+
+// Elasticsearch accepts a single string where the transpiler uses a list of strings
+var stringOrListFields = map[string][]string{
+	"remove": {"field", "keep"},
+	"append": {"value"},
+}
+
+// DecodeIngestProcessor decodes a processor definition like {"set": {"field": "foo", "value": "bar"}}
+func DecodeIngestProcessor(data []byte) (IngestProcessor, error) {
+	var outer map[string]json.RawMessage
+	if err := json.Unmarshal(data, &outer); err != nil {
+		return nil, err
+	}
+	if len(outer) != 1 {
+		return nil, errors.Errorf("a processor definition must contain exactly one processor type, got %d", len(outer))
+	}
+
+	for processorType, raw := range outer {
+		decoder, ok := processorDecoders[processorType]
+		if !ok {
+			return nil, errors.Errorf("processor type [%s] is not supported", processorType)
+		}
+
+		var body map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &body); err != nil {
+			return nil, errors.Wrapf(err, "processor [%s]", processorType)
+		}
+
+		// on_failure contains processors, thus it must be decoded separately
+		rawOnFailure, hasOnFailure := body["on_failure"]
+		delete(body, "on_failure")
+
+		for _, f := range stringOrListFields[processorType] {
+			if v, ok := body[f]; ok && strings.HasPrefix(strings.TrimSpace(string(v)), `"`) {
+				body[f] = json.RawMessage("[" + string(v) + "]")
+			}
+		}
+
+		cleanBody, _ := json.Marshal(body)
+		ip, err := decoder(cleanBody)
+		if err != nil {
+			return nil, errors.Wrapf(err, "processor [%s]", processorType)
+		}
+
+		if hasOnFailure {
+			onFailure, err := DecodeIngestProcessors(rawOnFailure)
+			if err != nil {
+				return nil, errors.Wrapf(err, "on_failure of processor [%s]", processorType)
+			}
+			ip = ip.WithOnFailure(onFailure)
+		}
+		return ip, nil
+	}
+	return nil, nil
+}
+
+// DecodeIngestProcessors decodes a list of processor definitions
+func DecodeIngestProcessors(data []byte) ([]IngestProcessor, error) {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return nil, err
+	}
+	ips := []IngestProcessor{}
+	for _, raw := range raws {
+		ip, err := DecodeIngestProcessor(raw)
+		if err != nil {
+			return nil, err
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
+// DecodeIngestPipeline decodes a single pipeline definition with the given name
+func DecodeIngestPipeline(name string, data []byte) (IngestPipeline, error) {
+	var body struct {
+		Description string          `json:"description"`
+		Processors  json.RawMessage `json:"processors"`
+		OnFailure   json.RawMessage `json:"on_failure"`
+	}
+	ip := NewIngestPipeline(name)
+
+	if err := json.Unmarshal(data, &body); err != nil {
+		return ip, errors.Wrapf(err, "pipeline [%s]", name)
+	}
+	ip.Description = body.Description
+
+	if len(body.Processors) > 0 {
+		processors, err := DecodeIngestProcessors(body.Processors)
+		if err != nil {
+			return ip, errors.Wrapf(err, "pipeline [%s]", name)
+		}
+		ip.Processors = processors
+	}
+	if len(body.OnFailure) > 0 && string(body.OnFailure) != "null" {
+		onFailure, err := DecodeIngestProcessors(body.OnFailure)
+		if err != nil {
+			return ip, errors.Wrapf(err, "pipeline [%s]", name)
+		}
+		ip.OnFailureProcessors = onFailure
+	}
+	return ip, nil
+}
+
+// DecodeIngestPipelines decodes either a dictionary of pipelines (as produced by the transpile command)
+// or a single pipeline definition, which is named after defaultName.
+// The pipelines of a dictionary are sorted by name, except for the main pipelines that come first.
+func DecodeIngestPipelines(defaultName string, data []byte) ([]IngestPipeline, error) {
+	var dictionary map[string]json.RawMessage
+	if err := json.Unmarshal(data, &dictionary); err != nil {
+		return nil, err
+	}
+
+	if _, ok := dictionary["processors"]; ok {
+		ip, err := DecodeIngestPipeline(defaultName, data)
+		if err != nil {
+			return nil, err
+		}
+		return []IngestPipeline{ip}, nil
+	}
+
+	names := []string{}
+	for name := range dictionary {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		mi := strings.HasPrefix(names[i], "main-pipeline-")
+		mj := strings.HasPrefix(names[j], "main-pipeline-")
+		if mi != mj {
+			return mi
+		}
+		return names[i] < names[j]
+	})
+
+	ips := []IngestPipeline{}
+	for _, name := range names {
+		ip, err := DecodeIngestPipeline(name, dictionary[name])
+		if err != nil {
+			return nil, err
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
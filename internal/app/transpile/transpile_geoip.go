@@ -0,0 +1,213 @@
+package transpile
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	ast "github.com/herrBez/baffo/ast"
+)
+
+// A field of the geoip filter of Logstash
+type geoipField struct {
+	property string // The property of the geoip processor providing the value
+	database string // The database providing the field (City or ASN), empty if both
+	legacy   string // The field written without ECS compatibility, relative to the target
+	ecs      string // The field written with ECS compatibility, relative to the target, empty if not written
+}
+
+// The fields of the geoip filter, in the order they are written by default
+var geoipFieldNames = []string{
+	"city_name", "continent_code", "continent_name", "country_code2", "country_code3", "country_name", "ip", "latitude",
+	"longitude", "location", "postal_code", "region_name", "region_code", "timezone",
+	"autonomous_system_number", "autonomous_system_organization",
+}
+
+var geoipFields = map[string]geoipField{
+	"city_name":      {property: "city_name", database: "City", legacy: "city_name", ecs: "geo.city_name"},
+	"continent_code": {property: "continent_code", database: "City", legacy: "continent_code", ecs: "geo.continent_code"},
+	"continent_name": {property: "continent_name", database: "City", legacy: "continent_name", ecs: "geo.continent_name"},
+	// Both codes are the ISO 3166-1 alpha-2 code of the country
+	"country_code2": {property: "country_iso_code", database: "City", legacy: "country_code2", ecs: "geo.country_iso_code"},
+	"country_code3": {property: "country_iso_code", database: "City", legacy: "country_code3"},
+	"country_name":  {property: "country_name", database: "City", legacy: "country_name", ecs: "geo.country_name"},
+	"ip":            {property: "ip", legacy: "ip", ecs: "ip"},
+	"latitude":      {property: "location", database: "City", legacy: "latitude"},
+	"longitude":     {property: "location", database: "City", legacy: "longitude"},
+	"location":      {property: "location", database: "City", legacy: "location", ecs: "geo.location"},
+	"postal_code":   {property: "postal_code", database: "City", legacy: "postal_code", ecs: "geo.postal_code"},
+	"region_name":   {property: "region_name", database: "City", legacy: "region_name", ecs: "geo.region_name"},
+	// The region_iso_code of the processor is prefixed by the country code, e.g., US-CA
+	"region_code":                    {property: "region_iso_code", database: "City", legacy: "region_code", ecs: "geo.region_iso_code"},
+	"timezone":                       {property: "timezone", database: "City", legacy: "timezone", ecs: "geo.timezone"},
+	"autonomous_system_number":       {property: "asn", database: "ASN", legacy: "asn", ecs: "as.number"},
+	"autonomous_system_organization": {property: "organization_name", database: "ASN", legacy: "as_org", ecs: "as.organization.name"},
+}
+
+// An IP sub-field, e.g., [client][ip], whose parent is the default target with ECS compatibility
+var geoipECSSource = regexp.MustCompile(`^\[([^\]]+)\]\[ip\]$|^([^\[\].]+)\.ip$`)
+
+// GeoIP Plugin of Logstash
+// The geoip processor writes the properties in a temporary field, from where they are copied to the fields written
+// by Logstash. As done by Logstash, the tag_on_failure is added as well when the IP address is not found.
+func DealWithGeoIP(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor, []IngestProcessor) {
+	ingestProcessors := []IngestProcessor{}
+	onFailureProcessors := []IngestProcessor{}
+
+	ECSCompatibility := "v8" // We assume ECS Compatibility
+	database := "City"
+	var databaseFile *string = nil
+	var source string
+	var target *string = nil
+	var fields []string = nil
+	var fieldsAttr ast.Attribute
+
+	for _, attr := range plugin.Attributes {
+		switch attr.Name() {
+		case "fields":
+			fields = getArrayStringAttributes(attr)
+			fieldsAttr = attr
+
+		case "source":
+			source = getStringAttributeString(attr)
+
+		case "target":
+			target = pointer(getStringAttributeString(attr))
+
+		case "database":
+			// The database must be installed in Elasticsearch, it is referenced by its file name
+			databaseFile = pointer(filepath.Base(getStringAttributeString(attr)))
+			if strings.Contains(strings.ToUpper(*databaseFile), "ASN") {
+				database = "ASN"
+			}
+			t.lossyAttribute(plugin, attr, FullyTranspiled, "make sure that the database %s is available in Elasticsearch", *databaseFile)
+
+		case "default_database_type":
+			database = getStringAttributeString(attr)
+			if database != "City" && database != "ASN" {
+				t.unsupportedAttribute(plugin, attr)
+				database = "City"
+			}
+
+		case "ecs_compatibility":
+			ECSCompatibility = getStringAttributeString(attr)
+
+		case "cache_size": // N/A, the cache of the processor is a node setting
+
+		case "tag_on_failure":
+			onFailureProcessors = DealWithTagOnFailure(attr, id, t)
+
+		default:
+			t.unsupportedAttribute(plugin, attr)
+
+		}
+	}
+
+	if source == "" {
+		t.lossyPlugin(plugin, "the source is required, the plugin is skipped")
+		return ingestProcessors, onFailureProcessors
+	}
+
+	// Add _geoip_lookup_failure
+	if len(onFailureProcessors) == 0 {
+		onFailureProcessors = DealWithTagOnFailure(ast.NewArrayAttribute("tag_on_failure", ast.NewStringAttribute("", "_geoip_lookup_failure", ast.DoubleQuoted)), id, t)
+	}
+
+	ecs := ECSCompatibility != "disabled"
+	if target == nil {
+		m := geoipECSSource.FindStringSubmatch(source)
+		switch {
+		case !ecs:
+			target = pointer("geoip")
+		case m != nil:
+			target = pointer(m[1] + m[2])
+		default:
+			t.lossyPlugin(plugin, "the target is required with ECS compatibility unless the source is an ip sub-field, 'geoip' is used")
+			target = pointer("geoip")
+		}
+	}
+
+	if databaseFile == nil {
+		databaseFile = pointer(fmt.Sprintf("GeoLite2-%s.mmdb", database))
+	}
+
+	// By default, all the fields of the database are written
+	explicitFields := fields != nil
+	if !explicitFields {
+		fields = geoipFieldNames
+	}
+
+	tmp := fmt.Sprintf("%s.%s-geoip", TRANSPILER_PREFIX, id)
+	properties := []string{}
+	copyProcessors := []IngestProcessor{}
+	for _, name := range fields {
+		field, ok := geoipFields[strings.ToLower(name)]
+		if !ok || (field.database != "" && field.database != database) {
+			if explicitFields {
+				t.lossyAttribute(plugin, fieldsAttr, PartiallyTranspiled, "the field '%s' is not provided by the %s database", name, database)
+			}
+			continue
+		}
+		destination := field.legacy
+		if ecs {
+			destination = field.ecs
+		}
+		if destination == "" {
+			if explicitFields {
+				t.lossyAttribute(plugin, fieldsAttr, PartiallyTranspiled, "the field '%s' is not written with ECS compatibility", name)
+			}
+			continue
+		}
+		if !Contains(properties, field.property) {
+			properties = append(properties, field.property)
+		}
+
+		destination = toElasticPipelineSelector(*target) + "." + destination
+		from := tmp + "." + field.property
+		switch strings.ToLower(name) {
+		case "latitude":
+			from = from + ".lat"
+		case "longitude":
+			from = from + ".lon"
+		case "region_code":
+			if !ecs {
+				copyProcessors = append(copyProcessors, GsubProcessor{
+					Field:         from,
+					Pattern:       "^[^-]+-",
+					Replacement:   "",
+					TargetField:   pointer(destination),
+					IgnoreMissing: true,
+				}.WithTag(fmt.Sprintf("%s-%s", id, name)))
+				continue
+			}
+		}
+		copyProcessors = append(copyProcessors, SetProcessor{
+			Field:            destination,
+			CopyFrom:         from,
+			IgnoreEmptyValue: true,
+		}.WithTag(fmt.Sprintf("%s-%s", id, name)))
+	}
+
+	ingestProcessors = append(ingestProcessors, GeoIPProcessor{
+		Field:         toElasticPipelineSelector(source),
+		TargetField:   pointer(tmp),
+		DatabaseFile:  databaseFile,
+		Properties:    &properties,
+		IgnoreMissing: pointer(true),
+	}.WithTag(id))
+	ingestProcessors = append(ingestProcessors, copyProcessors...)
+
+	// The geoip processor does not fail when the IP address is not found
+	notFound := fmt.Sprintf("ctx?.%s?.get('%s-geoip') == null", TRANSPILER_PREFIX, id)
+	for _, ip := range onFailureProcessors {
+		ingestProcessors = append(ingestProcessors, ip.WithIf(pointer(notFound), false))
+	}
+
+	ingestProcessors = append(ingestProcessors, RemoveProcessor{
+		Field:         &[]string{tmp},
+		IgnoreMissing: true,
+	}.WithTag(fmt.Sprintf("%s-cleanup", id)))
+
+	return ingestProcessors, onFailureProcessors
+}
@@ -0,0 +1,134 @@
+package transpile
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	ast "github.com/herrBez/baffo/ast"
+	"github.com/pkg/errors"
+)
+
+// The names of the patterns of the grok-patterns file shipped with both Logstash and Elasticsearch
+var grokBuiltinPatterns = []string{
+	"USERNAME", "USER", "EMAILLOCALPART", "EMAILADDRESS", "INT", "BASE10NUM", "NUMBER", "BASE16NUM", "BASE16FLOAT",
+	"POSINT", "NONNEGINT", "WORD", "NOTSPACE", "SPACE", "DATA", "GREEDYDATA", "QUOTEDSTRING", "UUID", "URN",
+	"MAC", "CISCOMAC", "WINDOWSMAC", "COMMONMAC", "IPV6", "IPV4", "IP", "HOSTNAME", "IPORHOST", "HOSTPORT",
+	"PATH", "UNIXPATH", "TTY", "WINPATH", "URIPROTO", "URIHOST", "URIPATH", "URIPARAM", "URIPATHPARAM", "URI",
+	"MONTH", "MONTHNUM", "MONTHNUM2", "MONTHDAY", "DAY", "YEAR", "HOUR", "MINUTE", "SECOND", "TIME",
+	"DATE_US", "DATE_EU", "ISO8601_TIMEZONE", "ISO8601_SECOND", "TIMESTAMP_ISO8601", "DATE", "DATESTAMP", "TZ",
+	"DATESTAMP_RFC822", "DATESTAMP_RFC2822", "DATESTAMP_OTHER", "DATESTAMP_EVENTLOG", "SYSLOGTIMESTAMP", "PROG",
+	"SYSLOGPROG", "SYSLOGHOST", "SYSLOGFACILITY", "HTTPDATE", "QS", "SYSLOGBASE", "COMMONAPACHELOG",
+	"COMBINEDAPACHELOG", "HTTPD20_ERRORLOG", "HTTPD24_ERRORLOG", "HTTPD_ERRORLOG", "HTTPD_COMMONLOG",
+	"HTTPD_COMBINEDLOG", "LOGLEVEL",
+}
+
+var (
+	// A reference to a pattern, e.g., %{WORD}, %{WORD:field} or %{INT:field:int}
+	grokPatternReference = regexp.MustCompile(`%\{(\w+)(?::[^}]*)?\}`)
+	// A line of a pattern file, e.g., MYPATTERN [a-z]+
+	grokPatternLine = regexp.MustCompile(`^(\w+)\s+(.*)$`)
+)
+
+// readGrokPatternFiles reads the patterns of the files matching glob in the directories (or of the files)
+// of patternsDir as done by Logstash: the files are read in alphabetical order and the last definition of
+// a pattern wins. Relative paths are resolved against the directory of the configuration file.
+func readGrokPatternFiles(configFile string, patternsDir []string, glob string) (map[string]string, error) {
+	patterns := map[string]string{}
+	for _, dir := range patternsDir {
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(configFile), dir)
+		}
+		stat, err := os.Stat(dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot read the patterns directory %s", dir)
+		}
+		files := []string{dir}
+		if stat.IsDir() {
+			files, err = filepath.Glob(filepath.Join(dir, glob))
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid patterns_files_glob %s", glob)
+			}
+			sort.Strings(files)
+		}
+
+		for _, file := range files {
+			if err := readGrokPatternFile(file, patterns); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return patterns, nil
+}
+
+func readGrokPatternFile(file string, patterns map[string]string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return errors.Wrapf(err, "cannot read the patterns file %s", file)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Comments and empty lines are ignored
+		if m := grokPatternLine.FindStringSubmatch(scanner.Text()); m != nil {
+			patterns[m[1]] = m[2]
+		}
+	}
+	return errors.Wrapf(scanner.Err(), "cannot read the patterns file %s", file)
+}
+
+// usedGrokPatterns returns the definitions of the patterns referenced, directly or transitively, by the expressions
+func usedGrokPatterns(expressions []string, definitions map[string]string) map[string]string {
+	used := map[string]string{}
+	for len(expressions) > 0 {
+		expression := expressions[0]
+		expressions = expressions[1:]
+		for _, m := range grokPatternReference.FindAllStringSubmatch(expression, -1) {
+			definition, ok := definitions[m[1]]
+			if _, seen := used[m[1]]; !ok || seen {
+				continue
+			}
+			used[m[1]] = definition
+			expressions = append(expressions, definition)
+		}
+	}
+	return used
+}
+
+// inlineGrokPatterns adds to the pattern definitions the patterns of the patterns_dir attribute used by the
+// expressions. The pattern definitions take precedence, as pattern_definitions does in Logstash.
+func (t Transpile) inlineGrokPatterns(plugin ast.Plugin, attr ast.Attribute, glob string, expressions []string, definitions map[string]string) map[string]string {
+	patterns, err := readGrokPatternFiles(t.configFile, getArrayStringAttributeOrStringAttrubute(attr), glob)
+	if err != nil {
+		t.lossyAttribute(plugin, attr, NotTranspiled, "%v", err)
+		return definitions
+	}
+
+	for name, definition := range definitions {
+		delete(patterns, name)
+		expressions = append(expressions, definition)
+	}
+	used := usedGrokPatterns(expressions, patterns)
+	if len(used) == 0 {
+		return definitions
+	}
+
+	if definitions == nil {
+		definitions = map[string]string{}
+	}
+	names := make([]string, 0, len(used))
+	for name := range used {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if Contains(grokBuiltinPatterns, name) {
+			t.lossyAttribute(plugin, attr, PartiallyTranspiled, "the pattern '%s' overrides the built-in pattern of the grok processor", name)
+		}
+		definitions[name], _ = toElasticPipelineSelectorExpression(used[name], GrokContext)
+	}
+	return definitions
+}
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/rs/zerolog/log"
+	"go.yaml.in/yaml/v3"
 
 	ast "github.com/herrBez/baffo/ast"
 )
@@ -79,6 +81,38 @@ func MyJsonEncode(v any) ([]byte, error) {
 	return buf.Bytes(), err
 }
 
+// jsonToYaml converts JSON to YAML keeping the order of the keys,
+// multi-line strings (e.g., painless sources) are written as literal blocks
+func jsonToYaml(data []byte) ([]byte, error) {
+	// JSON is valid YAML, the node keeps the order of the keys
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	setYamlBlockStyle(&node)
+
+	buf := new(bytes.Buffer)
+	e := yaml.NewEncoder(buf)
+	e.SetIndent(2)
+	if err := e.Encode(&node); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func setYamlBlockStyle(node *yaml.Node) {
+	node.Style = 0
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" && strings.Contains(node.Value, "\n") {
+		node.Style = yaml.LiteralStyle
+	}
+	for _, child := range node.Content {
+		setYamlBlockStyle(child)
+	}
+}
+
 func ExtractString(b []byte, err error) string {
 	if err != nil {
 		log.Panic().Msg("Could not marshal")
@@ -187,7 +221,7 @@ type SetProcessor struct {
 	Value            interface{} `json:"value,omitempty"`
 	Field            string      `json:"field"`
 	CopyFrom         string      `json:"copy_from,omitempty"`
-	Override         bool        `json:"override,omitempty"`
+	Override         *bool       `json:"override,omitempty"`
 	IgnoreEmptyValue bool        `json:"ignore_empty_value,omitempty"`
 	MediaType        string      `json:"media_type,omitempty"`
 	IgnoreFailure    bool        `json:"ignore_failure,omitempty"`
@@ -455,7 +489,7 @@ func (ip GrokProcessor) MarshalJSON() ([]byte, error) {
 type AppendProcessor struct {
 	Field           string   `json:"field,omitempty"`
 	Value           []string `json:"value,omitempty"`
-	AllowDuplicates bool     `json:"allow_duplicates,omitempty"`
+	AllowDuplicates *bool    `json:"allow_duplicates,omitempty"`
 	MediaType       *string  `json:"media_type,omitempty"`
 	IgnoreFailure   bool     `json:"ignore_failure,omitempty"`
 	CommonFields
@@ -617,7 +651,7 @@ type KVProcessor struct {
 	Prefix        *string  `json:"prefix,omitempty"`
 	TrimKey       *string  `json:"trim_key,omitempty"`
 	TrimValue     *string  `json:"trim_value,omitempty"`
-	StripBrackets bool     `json:"strip_bracket,omitempty"`
+	StripBrackets bool     `json:"strip_brackets,omitempty"`
 	Pattern       string   `json:"patterns,omitempty"`
 	IgnoreFailure bool     `json:"ignore_failure,omitempty"`
 	CommonFields
@@ -1209,7 +1243,7 @@ func (sp URLDecodeProcessor) String() string {
 }
 
 func (sp URLDecodeProcessor) IngestProcessorType() string {
-	return "user_agent"
+	return "urldecode"
 }
 
 func (sp URLDecodeProcessor) WithIf(s *string, append bool) IngestProcessor {
@@ -1348,3 +1382,208 @@ func (sp JSONProcessor) WithDescription(description string) IngestProcessor {
 	sp.Description = pointer(description)
 	return sp
 }
+
+type FingerprintProcessor struct {
+	Fields        []string `json:"fields"`
+	TargetField   *string  `json:"target_field,omitempty"`
+	Salt          *string  `json:"salt,omitempty"`
+	Method        *string  `json:"method,omitempty"`
+	IgnoreMissing *bool    `json:"ignore_missing,omitempty"`
+	IgnoreFailure *bool    `json:"ignore_failure,omitempty"`
+	CommonFields
+}
+
+func (ip FingerprintProcessor) MarshalJSON() ([]byte, error) {
+	type FingerprintProcessorAlias FingerprintProcessor
+
+	return MyJsonEncode(
+		map[string]FingerprintProcessorAlias{
+			ip.IngestProcessorType(): (FingerprintProcessorAlias)(ip),
+		},
+	)
+}
+
+func (sp FingerprintProcessor) String() string {
+	return StringHelper(sp)
+}
+
+func (sp FingerprintProcessor) IngestProcessorType() string {
+	return "fingerprint"
+}
+
+func (sp FingerprintProcessor) WithIf(s *string, append bool) IngestProcessor {
+	if append {
+		sp.If = AppendIf(sp.If, s)
+	} else {
+		sp.If = s
+	}
+	return sp
+}
+
+func (sp FingerprintProcessor) WithOnFailure(s []IngestProcessor) IngestProcessor {
+	sp.OnFailure = s
+	return sp
+}
+
+func (sp FingerprintProcessor) WithTag(tag string) IngestProcessor {
+	sp.Tag = pointer(tag)
+	return sp
+}
+
+func (sp FingerprintProcessor) WithDescription(description string) IngestProcessor {
+	sp.Description = pointer(description)
+	return sp
+}
+
+type DotExpanderProcessor struct {
+	Field         string  `json:"field"`
+	Path          *string `json:"path,omitempty"`
+	Override      *bool   `json:"override,omitempty"`
+	IgnoreFailure *bool   `json:"ignore_failure,omitempty"`
+	CommonFields
+}
+
+func (ip DotExpanderProcessor) MarshalJSON() ([]byte, error) {
+	type DotExpanderProcessorAlias DotExpanderProcessor
+
+	return MyJsonEncode(
+		map[string]DotExpanderProcessorAlias{
+			ip.IngestProcessorType(): (DotExpanderProcessorAlias)(ip),
+		},
+	)
+}
+
+func (sp DotExpanderProcessor) String() string {
+	return StringHelper(sp)
+}
+
+func (sp DotExpanderProcessor) IngestProcessorType() string {
+	return "dot_expander"
+}
+
+func (sp DotExpanderProcessor) WithIf(s *string, append bool) IngestProcessor {
+	if append {
+		sp.If = AppendIf(sp.If, s)
+	} else {
+		sp.If = s
+	}
+	return sp
+}
+
+func (sp DotExpanderProcessor) WithOnFailure(s []IngestProcessor) IngestProcessor {
+	sp.OnFailure = s
+	return sp
+}
+
+func (sp DotExpanderProcessor) WithTag(tag string) IngestProcessor {
+	sp.Tag = pointer(tag)
+	return sp
+}
+
+func (sp DotExpanderProcessor) WithDescription(description string) IngestProcessor {
+	sp.Description = pointer(description)
+	return sp
+}
+
+type BytesProcessor struct {
+	Field         string  `json:"field"`
+	TargetField   *string `json:"target_field,omitempty"`
+	IgnoreMissing *bool   `json:"ignore_missing,omitempty"`
+	IgnoreFailure *bool   `json:"ignore_failure,omitempty"`
+	CommonFields
+}
+
+func (ip BytesProcessor) MarshalJSON() ([]byte, error) {
+	type BytesProcessorAlias BytesProcessor
+
+	return MyJsonEncode(
+		map[string]BytesProcessorAlias{
+			ip.IngestProcessorType(): (BytesProcessorAlias)(ip),
+		},
+	)
+}
+
+func (sp BytesProcessor) String() string {
+	return StringHelper(sp)
+}
+
+func (sp BytesProcessor) IngestProcessorType() string {
+	return "bytes"
+}
+
+func (sp BytesProcessor) WithIf(s *string, append bool) IngestProcessor {
+	if append {
+		sp.If = AppendIf(sp.If, s)
+	} else {
+		sp.If = s
+	}
+	return sp
+}
+
+func (sp BytesProcessor) WithOnFailure(s []IngestProcessor) IngestProcessor {
+	sp.OnFailure = s
+	return sp
+}
+
+func (sp BytesProcessor) WithTag(tag string) IngestProcessor {
+	sp.Tag = pointer(tag)
+	return sp
+}
+
+func (sp BytesProcessor) WithDescription(description string) IngestProcessor {
+	sp.Description = pointer(description)
+	return sp
+}
+
+type EnrichProcessor struct {
+	PolicyName    string `json:"policy_name"`
+	Field         string `json:"field"`
+	TargetField   string `json:"target_field"`
+	IgnoreMissing *bool  `json:"ignore_missing,omitempty"`
+	Override      *bool  `json:"override,omitempty"`
+	MaxMatches    *int   `json:"max_matches,omitempty"`
+	IgnoreFailure *bool  `json:"ignore_failure,omitempty"`
+	CommonFields
+}
+
+func (ip EnrichProcessor) MarshalJSON() ([]byte, error) {
+	type EnrichProcessorAlias EnrichProcessor
+
+	return MyJsonEncode(
+		map[string]EnrichProcessorAlias{
+			ip.IngestProcessorType(): (EnrichProcessorAlias)(ip),
+		},
+	)
+}
+
+func (sp EnrichProcessor) String() string {
+	return StringHelper(sp)
+}
+
+func (sp EnrichProcessor) IngestProcessorType() string {
+	return "enrich"
+}
+
+func (sp EnrichProcessor) WithIf(s *string, append bool) IngestProcessor {
+	if append {
+		sp.If = AppendIf(sp.If, s)
+	} else {
+		sp.If = s
+	}
+	return sp
+}
+
+func (sp EnrichProcessor) WithOnFailure(s []IngestProcessor) IngestProcessor {
+	sp.OnFailure = s
+	return sp
+}
+
+func (sp EnrichProcessor) WithTag(tag string) IngestProcessor {
+	sp.Tag = pointer(tag)
+	return sp
+}
+
+func (sp EnrichProcessor) WithDescription(description string) IngestProcessor {
+	sp.Description = pointer(description)
+	return sp
+}
@@ -0,0 +1,274 @@
+package transpile
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	ast "github.com/herrBez/baffo/ast"
+)
+
+// kvCharacters returns the characters of a Logstash set of characters (e.g., field_split or remove_char_key).
+// The escape sequences \t, \n and \r stand for a tab, a new line and a carriage return, the other escaped
+// characters stand for themselves.
+func kvCharacters(chars string) []rune {
+	runes := []rune(chars)
+	characters := []rune{}
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == '\\' && i+1 < len(runes) {
+			i++
+			switch runes[i] {
+			case 't':
+				r = '\t'
+			case 'n':
+				r = '\n'
+			case 'r':
+				r = '\r'
+			default:
+				r = runes[i]
+			}
+		}
+		characters = append(characters, r)
+	}
+	return characters
+}
+
+// kvRegexpCharacter escapes a character to be used in a regular expression, also within [...]
+func kvRegexpCharacter(r rune) string {
+	switch r {
+	case '\t':
+		return `\t`
+	case '\n':
+		return `\n`
+	case '\r':
+		return `\r`
+	case '-':
+		return `\-`
+	}
+	return regexp.QuoteMeta(string(r))
+}
+
+// kvCharacterClass returns the regular expression matching one of the characters
+func kvCharacterClass(chars string) string {
+	var s strings.Builder
+	for _, r := range kvCharacters(chars) {
+		s.WriteString(kvRegexpCharacter(r))
+	}
+	return "[" + s.String() + "]"
+}
+
+// kvSplitPattern converts the field_split or value_split of Logstash, a set of characters, to the regular
+// expression of the kv processor
+func kvSplitPattern(chars string) string {
+	characters := kvCharacters(chars)
+	if len(characters) == 1 && characters[0] != '-' {
+		return kvRegexpCharacter(characters[0])
+	}
+	return kvCharacterClass(chars)
+}
+
+// kvRemoveCharFunction returns a Painless function removing the characters of remove_char_key or remove_char_value.
+// Painless cannot compile regular expressions at runtime, thus the characters are a literal of the script.
+func kvRemoveCharFunction(name string, chars *string) string {
+	if chars == nil {
+		return fmt.Sprintf(`String %s(String s) {
+  return s;
+}`, name)
+	}
+	return fmt.Sprintf(`String %s(String s) {
+  return %s.matcher(s).replaceAll('');
+}`, name, painlessRegex(kvCharacterClass(*chars)))
+}
+
+// The script applying to the parsed keys and values the options that the kv processor does not support.
+// The keys that become equal (e.g., with transform_key) are merged as done for duplicated keys.
+const kvPostProcessingScript = `String transform(String s, def how) {
+  if (how == 'lowercase') {
+    return s.toLowerCase();
+  } else if (how == 'uppercase') {
+    return s.toUpperCase();
+  } else if (how == 'capitalize') {
+    return s.isEmpty() ? s : s.substring(0, 1).toUpperCase() + s.substring(1).toLowerCase();
+  }
+  return s;
+}
+void add(Map result, String k, def v, boolean allowDuplicates) {
+  if (!result.containsKey(k)) {
+    result[k] = v;
+    return;
+  }
+  def existing = result[k];
+  List values = new ArrayList();
+  if (existing instanceof List) {
+    values.addAll(existing);
+  } else {
+    values.add(existing);
+  }
+  if (allowDuplicates || !values.contains(v)) {
+    values.add(v);
+  }
+  result[k] = values.size() == 1 ? values[0] : values;
+}
+def parsed = ctx.%s?.remove(params.tmp);
+if (!(parsed instanceof Map)) {
+  return;
+}
+Map result = new LinkedHashMap();
+for (def entry : parsed.entrySet()) {
+  String k = transform(removeCharKey(entry.getKey()), params.transform_key);
+  if ((params.include_keys != null && !params.include_keys.contains(k)) || (params.exclude_keys != null && params.exclude_keys.contains(k))) {
+    continue;
+  }
+  k = params.prefix + k;
+  List values = entry.getValue() instanceof List ? entry.getValue() : [entry.getValue()];
+  for (def v : values) {
+    def value = v instanceof String ? transform(removeCharValue(v), params.transform_value) : v;
+    add(result, k, value, params.allow_duplicate_values);
+  }
+}
+if (params.target == null) {
+  ctx.putAll(result);
+} else {
+  def existing = $(params.target, null);
+  if (existing instanceof Map) {
+    existing.putAll(result);
+  } else {
+    field(params.target).set(result);
+  }
+}`
+
+// KV Plugin of Logstash
+// The options without an equivalent in the kv processor (remove_char_*, transform_* and allow_duplicate_values)
+// are applied by a script to the keys and values parsed in a temporary field. When the keys are modified, the
+// prefix, include_keys and exclude_keys are applied by the script as well, since Logstash applies them afterwards.
+func DealWithKV(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor, []IngestProcessor) {
+	ingestProcessors := []IngestProcessor{}
+	onFailureProcessors := []IngestProcessor{}
+
+	kv := KVProcessor{
+		FieldSplit: " ",       // Default value in Logstash
+		Field:      "message", // Default value in Logstash
+		ValueSplit: "=",       // Default value in Logstash
+	}.WithTag(id).(KVProcessor)
+
+	var removeCharKey, removeCharValue *string = nil, nil
+	var transformKey, transformValue *string = nil, nil
+	allowDuplicateValues := true
+	fieldSplitPattern, valueSplitPattern := false, false
+
+	for _, attr := range plugin.Attributes {
+		if Contains(CommonAttributes, attr.Name()) {
+			continue
+		}
+		switch attr.Name() {
+		// It is a common field
+		case "tag_on_failure":
+			onFailureProcessors = DealWithTagOnFailure(attr, id, t)
+		case "target":
+			kv.TargetField = pointer(toElasticPipelineSelector(getStringAttributeString(attr)))
+		case "prefix":
+			kv.Prefix = pointer(getStringAttributeString(attr))
+		case "field_split":
+			if !fieldSplitPattern {
+				kv.FieldSplit = kvSplitPattern(getStringAttributeString(attr))
+			}
+		case "field_split_pattern":
+			kv.FieldSplit = getStringAttributeString(attr)
+			fieldSplitPattern = true
+		case "value_split":
+			if !valueSplitPattern {
+				kv.ValueSplit = kvSplitPattern(getStringAttributeString(attr))
+			}
+		case "value_split_pattern":
+			kv.ValueSplit = getStringAttributeString(attr)
+			valueSplitPattern = true
+		case "exclude_keys":
+			kv.ExcludeKeys = getArrayStringAttributes(attr)
+		case "include_keys":
+			kv.IncludeKeys = getArrayStringAttributes(attr)
+		case "include_brackets":
+			kv.StripBrackets = !getBoolValue(attr)
+		case "source":
+			kv.Field = toElasticPipelineSelector(getStringAttributeString(attr))
+		case "trim_key":
+			kv.TrimKey = pointer(getStringAttributeString(attr))
+		case "trim_value":
+			kv.TrimValue = pointer(getStringAttributeString(attr))
+		case "remove_char_key":
+			removeCharKey = pointer(getStringAttributeString(attr))
+		case "remove_char_value":
+			removeCharValue = pointer(getStringAttributeString(attr))
+		case "transform_key":
+			transformKey = pointer(getStringAttributeString(attr))
+		case "transform_value":
+			transformValue = pointer(getStringAttributeString(attr))
+		case "allow_duplicate_values":
+			allowDuplicateValues = getBoolValue(attr)
+		case "recursive":
+			if getBoolValue(attr) {
+				t.lossyAttribute(plugin, attr, NotTranspiled, "the values are not parsed recursively")
+			}
+		case "whitespace":
+			if getStringAttributeString(attr) != "lenient" {
+				t.lossyAttribute(plugin, attr, PartiallyTranspiled, "the kv processor always ignores the whitespace around the separators")
+			}
+		default:
+			t.unsupportedAttribute(plugin, attr)
+
+		}
+	}
+	// Add _kv_filter_error
+	if len(onFailureProcessors) == 0 {
+		onFailureProcessors = DealWithTagOnFailure(ast.NewArrayAttribute("tag_on_failure", ast.NewStringAttribute("", "_kv_filter_error", ast.DoubleQuoted)), id, t)
+	}
+
+	if removeCharKey == nil && removeCharValue == nil && transformKey == nil && transformValue == nil && allowDuplicateValues {
+		ingestProcessors = append(ingestProcessors, kv)
+		return ingestProcessors, onFailureProcessors
+	}
+
+	tmp := fmt.Sprintf("%s-kv", id)
+	params := map[string]interface{}{
+		"tmp":                    tmp,
+		"prefix":                 "",
+		"allow_duplicate_values": allowDuplicateValues,
+	}
+	if kv.TargetField != nil {
+		params["target"] = *kv.TargetField
+	}
+	if transformKey != nil {
+		params["transform_key"] = *transformKey
+	}
+	if transformValue != nil {
+		params["transform_value"] = *transformValue
+	}
+	if removeCharKey != nil || transformKey != nil {
+		if kv.Prefix != nil {
+			params["prefix"] = *kv.Prefix
+			kv.Prefix = nil
+		}
+		if len(kv.IncludeKeys) > 0 {
+			params["include_keys"] = kv.IncludeKeys
+			kv.IncludeKeys = nil
+		}
+		if len(kv.ExcludeKeys) > 0 {
+			params["exclude_keys"] = kv.ExcludeKeys
+			kv.ExcludeKeys = nil
+		}
+	}
+	kv.TargetField = pointer(fmt.Sprintf("%s.%s", TRANSPILER_PREFIX, tmp))
+
+	ingestProcessors = append(ingestProcessors,
+		kv,
+		ScriptProcessor{
+			Source: pointer(kvRemoveCharFunction("removeCharKey", removeCharKey) + "\n" +
+				kvRemoveCharFunction("removeCharValue", removeCharValue) + "\n" +
+				fmt.Sprintf(kvPostProcessingScript, TRANSPILER_PREFIX)),
+			Params: &params,
+		}.WithTag(fmt.Sprintf("%s-post-processing", id)).
+			WithDescription("Apply the kv options not supported by the kv processor"),
+	)
+
+	return ingestProcessors, onFailureProcessors
+}
@@ -0,0 +1,268 @@
+package transpile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Output formats of the transpiled pipelines
+const (
+	OutputFormatJSON       = "json"
+	OutputFormatDevTools   = "devtools"
+	OutputFormatNDJSONBulk = "ndjson-bulk"
+	OutputFormatYAML       = "yaml"
+)
+
+var OutputFormats = []string{OutputFormatJSON, OutputFormatDevTools, OutputFormatNDJSONBulk, OutputFormatYAML}
+
+func checkOutputFormat(format string) error {
+	if !Contains(OutputFormats, format) {
+		return errors.Errorf("unknown output format %q, expected one of %s", format, strings.Join(OutputFormats, ", "))
+	}
+	return nil
+}
+
+// dependencyOrder sorts the pipelines so that each pipeline comes after the pipelines it references with a pipeline processor.
+// getAllIngestPipeline returns a pipeline before its children, hence reversing the list is enough.
+func dependencyOrder(ips []IngestPipeline) []IngestPipeline {
+	ordered := make([]IngestPipeline, 0, len(ips))
+	for i := len(ips) - 1; i >= 0; i-- {
+		ordered = append(ordered, ips[i])
+	}
+	return ordered
+}
+
+// formatDevTools returns a PUT _ingest/pipeline request per pipeline, that can be pasted in Kibana Dev Tools
+func formatDevTools(ips []IngestPipeline) (string, error) {
+	var s strings.Builder
+	for i, ip := range dependencyOrder(ips) {
+		var body bytes.Buffer
+		if err := json.Indent(&body, []byte(ip.String()), "", "  "); err != nil {
+			return "", errors.Errorf("pipeline %s: %v", ip.Name, err)
+		}
+		if i > 0 {
+			s.WriteString("\n")
+		}
+		fmt.Fprintf(&s, "PUT _ingest/pipeline/%s\n%s", ip.Name, body.String())
+	}
+	return s.String(), nil
+}
+
+// formatNDJSONBulk returns one line per pipeline with its name and its definition, e.g., to install them with a curl loop
+func formatNDJSONBulk(ips []IngestPipeline) (string, error) {
+	var s strings.Builder
+	for _, ip := range dependencyOrder(ips) {
+		line, err := MyJsonEncode(map[string]interface{}{
+			"name":     ip.Name,
+			"pipeline": json.RawMessage(ip.String()),
+		})
+		if err != nil {
+			return "", err
+		}
+		s.Write(line)
+	}
+	return s.String(), nil
+}
+
+// formatYAML returns a YAML dictionary with one entry per pipeline, as done by printPipeline for JSON
+func formatYAML(ips []IngestPipeline) (string, error) {
+	var s strings.Builder
+	s.WriteString("{")
+	for i, ip := range ips {
+		if i > 0 {
+			s.WriteString(",")
+		}
+		name, err := MyJsonEncode(ip.Name)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&s, "%s: %s", bytes.TrimSpace(name), ip)
+	}
+	s.WriteString("}")
+
+	buf, err := jsonToYaml([]byte(s.String()))
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// encodePipeline returns the definition of a pipeline, as it is written in the output directory
+func encodePipeline(ip IngestPipeline, format string) ([]byte, error) {
+	if format == OutputFormatYAML {
+		return jsonToYaml([]byte(ip.String()))
+	}
+	var body bytes.Buffer
+	if err := json.Indent(&body, []byte(ip.String()), "", "  "); err != nil {
+		return nil, errors.Errorf("pipeline %s: %v", ip.Name, err)
+	}
+	return body.Bytes(), nil
+}
+
+// pipelineExtension returns the extension of the files of the pipelines in the output directory
+func pipelineExtension(format string) string {
+	if format == OutputFormatYAML {
+		return ".yaml"
+	}
+	return ".json"
+}
+
+func printPipelines(ips []IngestPipeline, format string) error {
+	switch format {
+	case OutputFormatYAML:
+		s, err := formatYAML(ips)
+		if err != nil {
+			return err
+		}
+		fmt.Print(s)
+	case OutputFormatDevTools:
+		s, err := formatDevTools(ips)
+		if err != nil {
+			return err
+		}
+		fmt.Print(s)
+	case OutputFormatNDJSONBulk:
+		s, err := formatNDJSONBulk(ips)
+		if err != nil {
+			return err
+		}
+		fmt.Print(s)
+	default:
+		printPipeline(ips)
+	}
+	return nil
+}
+
+// ManifestEntry lists the pipelines generated from a Logstash configuration file
+type ManifestEntry struct {
+	Source   string             `json:"source"`
+	Main     ManifestPipeline   `json:"main"`
+	Children []ManifestPipeline `json:"children"`
+}
+
+type ManifestPipeline struct {
+	Name string `json:"name"`
+	File string `json:"file"`
+}
+
+// Manifest is the index of the pipelines written in the output directory
+type Manifest struct {
+	Pipelines      []ManifestEntry    `json:"pipelines"`
+	EnrichPolicies []ManifestPipeline `json:"enrich_policies,omitempty"`
+}
+
+const manifestFilename = "manifest.json"
+
+// pipelineFilename returns the name of the file of a pipeline, path separators are replaced to keep the file in the output directory
+func pipelineFilename(name string, extension string) string {
+	return strings.NewReplacer("/", "_", "\\", "_").Replace(name) + extension
+}
+
+// add records the pipelines generated from source, the main pipeline comes first
+func (m *Manifest) add(source string, ips []IngestPipeline, extension string) {
+	if len(ips) == 0 {
+		return
+	}
+	entry := ManifestEntry{
+		Source:   source,
+		Main:     ManifestPipeline{Name: ips[0].Name, File: pipelineFilename(ips[0].Name, extension)},
+		Children: []ManifestPipeline{},
+	}
+	for _, ip := range ips[1:] {
+		entry.Children = append(entry.Children, ManifestPipeline{Name: ip.Name, File: pipelineFilename(ip.Name, extension)})
+	}
+	m.Pipelines = append(m.Pipelines, entry)
+}
+
+// writePipelines writes each pipeline to its own file (JSON or YAML) in dir, together with the enrich policies
+// (as Kibana Dev Tools requests) and the manifest
+func writePipelines(dir string, ips []IngestPipeline, policies []EnrichPolicy, manifest Manifest, format string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	for _, policy := range policies {
+		file := pipelineFilename("enrich-"+policy.Name, ".txt")
+		requests, err := formatEnrichPolicies([]EnrichPolicy{policy})
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(requests), 0o644); err != nil {
+			return err
+		}
+		manifest.EnrichPolicies = append(manifest.EnrichPolicies, ManifestPipeline{Name: policy.Name, File: file})
+	}
+
+	for _, ip := range ips {
+		body, err := encodePipeline(ip, format)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, pipelineFilename(ip.Name, pipelineExtension(format))), body, 0o644); err != nil {
+			return err
+		}
+	}
+
+	buf, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, manifestFilename), append(buf, '\n'), 0o644)
+}
+
+// EnrichPolicy is an enrich policy used by the generated pipelines, together with the documents of its source index
+// (an index with the same name). The documents have a key (the match field) and a value (the enrich field).
+type EnrichPolicy struct {
+	Name      string
+	Documents []map[string]interface{}
+}
+
+// formatEnrichPolicies returns the Kibana Dev Tools requests creating the source index of each policy, indexing
+// its documents and creating and executing the policy. The policies must be executed before the pipelines are created.
+func formatEnrichPolicies(policies []EnrichPolicy) (string, error) {
+	var s strings.Builder
+	for i, policy := range policies {
+		if i > 0 {
+			s.WriteString("\n")
+		}
+		fmt.Fprintf(&s, `PUT %s
+{
+  "mappings": {
+    "properties": {
+      "key": { "type": "keyword" },
+      "value": { "type": "object", "enabled": false }
+    }
+  }
+}
+
+POST %s/_bulk?refresh=true
+`, policy.Name, policy.Name)
+		for _, document := range policy.Documents {
+			line, err := MyJsonEncode(document)
+			if err != nil {
+				return "", err
+			}
+			s.WriteString("{\"index\":{}}\n")
+			s.Write(line)
+		}
+		fmt.Fprintf(&s, `
+PUT _enrich/policy/%s
+{
+  "match": {
+    "indices": "%s",
+    "match_field": "key",
+    "enrich_fields": ["value"]
+  }
+}
+
+POST _enrich/policy/%s/_execute
+`, policy.Name, policy.Name, policy.Name)
+	}
+	return s.String(), nil
+}
@@ -1,7 +1,12 @@
 package transpile
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	config "github.com/herrBez/baffo"
@@ -210,6 +215,31 @@ func TestEndToEnd(t *testing.T) {
 			input: `[@metadata][input] == 'test'`,
 			want:  `(ctx.getOrDefault('@metadata', null)?.input != null && ctx['@metadata'].input == "test")`,
 		},
+		{
+			name:  "Number comparison",
+			input: `[n] > 3`,
+			want:  `(ctx?.n != null && ctx.n > 3)`,
+		},
+		{
+			name:  "Parentheses are kept",
+			input: `[a] == "x" and ([b] == "y" or [c] == "z")`,
+			want:  `(ctx?.a != null && ctx.a == "x") && ((ctx?.b != null && ctx.b == "y") || (ctx?.c != null && ctx.c == "z"))`,
+		},
+		{
+			name:  "Negations after a boolean operator",
+			input: `[a] == "x" and !([b] == "y") and !("t" not in [tags])`,
+			want:  `(ctx?.a != null && ctx.a == "x") && !((ctx?.b != null && ctx.b == "y")) && !(!ctx?.tags.contains("t"))`,
+		},
+		{
+			name:  "Not in after a boolean operator",
+			input: `[a] == "x" or "t" not in [tags]`,
+			want:  `(ctx?.a != null && ctx.a == "x") || !ctx?.tags.contains("t")`,
+		},
+		{
+			name:  "Negated group after a boolean operator",
+			input: `[a] == 1 and !([b] == 2.5)`,
+			want:  `(ctx?.a != null && ctx.a == 1) && !((ctx?.b != null && ctx.b == 2.5))`,
+		},
 	}
 
 	for _, tc := range tt {
@@ -221,3 +251,1185 @@ func TestEndToEnd(t *testing.T) {
 		})
 	}
 }
+
+// Similarly to extractCondition, we parse a dummy configuration to obtain the plugin
+func extractPlugin(section string, s string) ast.Plugin {
+	c := dealWithError(config.Parse("fake", []byte(fmt.Sprintf("%s { %s }", section, s)))).(ast.Config)
+	switch section {
+	case "output":
+		return c.Output[0].BranchOrPlugins[0].(ast.Plugin)
+	default:
+		return c.Filter[0].BranchOrPlugins[0].(ast.Plugin)
+	}
+}
+
+func TestDealWithOutputElasticsearch(t *testing.T) {
+	plugin := extractPlugin("output", `elasticsearch {
+		hosts => ["localhost"]
+		pipeline => "enrich"
+		index => "logs-%{[service]}"
+		document_id => "%{[id]}"
+		routing => "%{[customer]}"
+	}`)
+
+	ips, _ := DealWithOutputElasticsearch(plugin, "es", Transpile{})
+
+	want := []string{
+		`{"set":{"value":"logs-{{{service}}}","field":"_index","override":true,"tag":"es-index","description":"Set '_index' to 'logs-{{{service}}}' as done by the Elasticsearch output option 'index'"}}`,
+		`{"set":{"value":"{{{id}}}","field":"_id","override":true,"tag":"es-document_id","description":"Set '_id' to '{{{id}}}' as done by the Elasticsearch output option 'document_id'"}}`,
+		`{"set":{"value":"{{{customer}}}","field":"_routing","override":true,"tag":"es-routing","description":"Set '_routing' to '{{{customer}}}' as done by the Elasticsearch output option 'routing'"}}`,
+		`{"pipeline":{"name":"enrich","tag":"es-pipeline"}}`,
+	}
+
+	if len(ips) != len(want) {
+		t.Fatalf("want %d processors, got %d", len(want), len(ips))
+	}
+	for i := range want {
+		got := ExtractString(MyJsonEncode(ips[i]))
+		if want[i]+"\n" != got {
+			t.Errorf("want %s, got %s", want[i], got)
+		}
+	}
+}
+
+func TestElasticsearchOutputFanOut(t *testing.T) {
+	filename := filepath.Join("..", "..", "..", "testdata", "transpile", "output-elasticsearch.conf")
+	res, err := config.ParseFile(filename)
+	if err != nil {
+		t.Fatalf("could not parse %s: %v", filename, err)
+	}
+
+	tr := New(Options{Threshold: 100, LogLevel: "error"})
+	ips := tr.BuildIngestPipelines(filename, res.(ast.Config))
+
+	indices := []string{}
+	for _, ip := range ips[0].Processors {
+		if set, ok := ip.(SetProcessor); ok && set.Field == "_index" {
+			indices = append(indices, fmt.Sprint(set.Value))
+		}
+	}
+	wantIndices := []string{"logs-{{{service}}}", "logs-default", "{{{data_stream.type}}}-{{{data_stream.dataset}}}-{{{data_stream.namespace}}}"}
+	if !reflect.DeepEqual(indices, wantIndices) {
+		t.Errorf("want indices %v, got %v", wantIndices, indices)
+	}
+
+	// The branches of the first output are exclusive, the data stream output overwrites both
+	errs := tr.coverage.report(filename).Errors()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "[Plugin elasticsearch] the events reaching the elasticsearch output at 9:5") {
+		t.Errorf("want the fan-out of the data stream output, got %v", errs)
+	}
+}
+
+func TestDealWithOutputElasticsearchDataStream(t *testing.T) {
+	tt := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "Auto routing and sync fields (default)",
+			input: `elasticsearch { data_stream => true data_stream_dataset => "nginx" }`,
+			want: []string{
+				`{"set":{"value":"logs","field":"data_stream.type","override":false,"tag":"es-data-stream-type","description":"Set 'data_stream.type' to 'logs' as done by the Elasticsearch output option 'data_stream_type'"}}`,
+				`{"set":{"value":"nginx","field":"data_stream.dataset","override":false,"tag":"es-data-stream-dataset","description":"Set 'data_stream.dataset' to 'nginx' as done by the Elasticsearch output option 'data_stream_dataset'"}}`,
+				`{"set":{"value":"default","field":"data_stream.namespace","override":false,"tag":"es-data-stream-namespace","description":"Set 'data_stream.namespace' to 'default' as done by the Elasticsearch output option 'data_stream_namespace'"}}`,
+				`{"set":{"value":"{{{data_stream.type}}}-{{{data_stream.dataset}}}-{{{data_stream.namespace}}}","field":"_index","override":true,"tag":"es-data-stream","description":"Route the document to the data stream '{{{data_stream.type}}}-{{{data_stream.dataset}}}-{{{data_stream.namespace}}}'"}}`,
+			},
+		},
+		{
+			name:  "Without auto routing and sync fields",
+			input: `elasticsearch { data_stream => true data_stream_type => "metrics" data_stream_auto_routing => false data_stream_sync_fields => false }`,
+			want: []string{
+				`{"set":{"value":"metrics-generic-default","field":"_index","override":true,"tag":"es-data-stream","description":"Route the document to the data stream 'metrics-generic-default'"}}`,
+			},
+		},
+		{
+			name:  "Data stream disabled",
+			input: `elasticsearch { data_stream => false data_stream_type => "metrics" }`,
+			want:  []string{},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ips, _ := DealWithOutputElasticsearch(extractPlugin("output", tc.input), "es", Transpile{})
+			if len(ips) != len(tc.want) {
+				t.Fatalf("want %d processors, got %d", len(tc.want), len(ips))
+			}
+			for i := range tc.want {
+				got := ExtractString(MyJsonEncode(ips[i]))
+				if tc.want[i]+"\n" != got {
+					t.Errorf("want %s, got %s", tc.want[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestDealWithTruncate(t *testing.T) {
+	tt := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "Listed fields",
+			input: `truncate { fields => ["[a][b]", "c"] length_bytes => 5 }`,
+			want:  `{"fields":["a.b","c"],"length_bytes":5}`,
+		},
+		{
+			name:  "Single field and string length",
+			input: `truncate { fields => "c" length_bytes => "10" }`,
+			want:  `{"fields":["c"],"length_bytes":10}`,
+		},
+		{
+			name:  "All fields",
+			input: `truncate { length_bytes => 5 }`,
+			want:  `{"excluded":["_index","_id","_routing","_version","_version_type","_if_seq_no","_if_primary_term","_dynamic_templates","@metadata","@timestamp","_TRANSPILER"],"length_bytes":5}`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ips, _ := DealWithTruncate(extractPlugin("filter", tc.input), "truncate", Transpile{})
+			if len(ips) != 1 {
+				t.Fatalf("want 1 processor, got %d", len(ips))
+			}
+			sp := ips[0].(ScriptProcessor)
+			if got := ExtractString(MyJsonEncode(sp.Params)); tc.want+"\n" != got {
+				t.Errorf("want %s, got %s", tc.want, got)
+			}
+			if *sp.Tag != "truncate" || !strings.Contains(*sp.Source, "def truncate(def value, int max)") {
+				t.Errorf("unexpected script processor %s", sp)
+			}
+		})
+	}
+
+	ips, _ := DealWithTruncate(extractPlugin("filter", `truncate { fields => ["c"] }`), "truncate", Transpile{})
+	if len(ips) != 0 {
+		t.Errorf("want no processor without length_bytes, got %d", len(ips))
+	}
+}
+
+func TestDealWithFingerprint(t *testing.T) {
+	tt := []struct {
+		name   string
+		input  string
+		want   []string
+		params string
+	}{
+		{
+			name:   "Default method and target",
+			input:  `fingerprint { }`,
+			params: `{"base64encode":false,"concatenate_sources":false,"fields":["message"],"method":"SHA1","names":["message"],"target":"event.hash"}`,
+		},
+		{
+			name:   "Concatenated sources sorted by name in base64",
+			input:  `fingerprint { source => ["b", "[a][c]"] target => "[@metadata][fingerprint]" method => "SHA256" concatenate_sources => true base64encode => true }`,
+			params: `{"base64encode":true,"concatenate_sources":true,"fields":["a.c","b"],"method":"SHA256","names":["[a][c]","b"],"target":"@metadata.fingerprint"}`,
+		},
+		{
+			name:   "PUNCTUATION",
+			input:  `fingerprint { method => "PUNCTUATION" source => ["a", "b"] target => "p" }`,
+			params: `{"base64encode":false,"concatenate_sources":false,"fields":["a","b"],"method":"PUNCTUATION","names":["a","b"],"target":"p"}`,
+		},
+		{
+			name:   "PUNCTUATION ignores concatenate_sources and processes the sources sorted by name",
+			input:  `fingerprint { method => "PUNCTUATION" source => ["b", "[a][c]"] concatenate_sources => true }`,
+			params: `{"base64encode":false,"concatenate_sources":false,"fields":["a.c","b"],"method":"PUNCTUATION","names":["[a][c]","b"],"target":"event.hash"}`,
+		},
+		{
+			name:  "HMAC with a key",
+			input: `fingerprint { source => ["a", "[b][c]"] target => "[@metadata][fingerprint]" method => "SHA256" concatenate_sources => true key => "k" }`,
+			want:  []string{`{"fingerprint":{"fields":["b.c","a"],"target_field":"@metadata.fingerprint","salt":"k","method":"SHA-256","ignore_missing":true,"tag":"fp"}}`},
+		},
+		{
+			name:  "Without concatenate_sources only the last source counts",
+			input: `fingerprint { source => ["a", "b"] method => "MURMUR3" ecs_compatibility => "disabled" }`,
+			want:  []string{`{"fingerprint":{"fields":["b"],"target_field":"fingerprint","method":"MurmurHash3","ignore_missing":true,"tag":"fp"}}`},
+		},
+		{
+			name:  "UUID",
+			input: `fingerprint { method => "UUID" target => "id" }`,
+			want:  []string{`{"script":{"source":"field(params.target).set(UUID.randomUUID().toString());","params":{"target":"id"},"tag":"fp","description":"Set a random UUID as done by the fingerprint method UUID"}}`},
+		},
+		{
+			name:  "Unsupported method",
+			input: `fingerprint { method => "SHA384" }`,
+			want:  []string{},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ips, _ := DealWithFingerprint(extractPlugin("filter", tc.input), "fp", Transpile{})
+			if tc.params != "" {
+				if len(ips) != 1 {
+					t.Fatalf("want 1 processor, got %d", len(ips))
+				}
+				script, ok := ips[0].(ScriptProcessor)
+				if !ok || *script.Source != fingerprintScript {
+					t.Fatalf("want the fingerprint script, got %s", ExtractString(MyJsonEncode(ips[0])))
+				}
+				got := ExtractString(MyJsonEncode(*script.Params))
+				if tc.params+"\n" != got {
+					t.Errorf("want %s, got %s", tc.params, got)
+				}
+				return
+			}
+			if len(ips) != len(tc.want) {
+				t.Fatalf("want %d processors, got %d", len(tc.want), len(ips))
+			}
+			for i := range tc.want {
+				got := ExtractString(MyJsonEncode(ips[i]))
+				if tc.want[i]+"\n" != got {
+					t.Errorf("want %s, got %s", tc.want[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestDealWithSplit(t *testing.T) {
+	tt := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "Default field and terminator",
+			input: `split { }`,
+			want: []string{
+				`{"split":{"field":"message","separator":"\n","if":"ctx?.message instanceof String","tag":"split"}}`,
+				`{"append":{"field":"_logstash_split","value":["message"],"if":"ctx?.message != null","tag":"split-marker","description":"Mark the field that Logstash would have split into multiple events"}}`,
+			},
+		},
+		{
+			name:  "Target and terminator",
+			input: `split { field => "[a][b]" target => "c" terminator => "|" }`,
+			want: []string{
+				`{"set":{"field":"c","copy_from":"a.b","if":"ctx?.a?.b instanceof List","tag":"split-copy"}}`,
+				`{"split":{"field":"a.b","separator":"\\|","target_field":"c","if":"ctx?.a?.b instanceof String","tag":"split"}}`,
+				`{"append":{"field":"_logstash_split","value":["c"],"if":"ctx?.c != null","tag":"split-marker","description":"Mark the field that Logstash would have split into multiple events"}}`,
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ips, _ := DealWithSplit(extractPlugin("filter", tc.input), "split", Transpile{})
+			if len(ips) != len(tc.want) {
+				t.Fatalf("want %d processors, got %d", len(tc.want), len(ips))
+			}
+			for i := range tc.want {
+				got := ExtractString(MyJsonEncode(ips[i]))
+				if tc.want[i]+"\n" != got {
+					t.Errorf("want %s, got %s", tc.want[i], got)
+				}
+			}
+		})
+	}
+
+	// The divergence is reported with the position of the plugin
+	tr := Transpile{coverage: newCoverageRecorder()}
+	plugin := extractPlugin("filter", `split { }`)
+	tr.coverage.begin("filter", plugin, "split")
+	DealWithSplit(plugin, "split", tr)
+	fc := tr.coverage.report("test.conf")
+	if fc.Plugins[0].Coverage != PartiallyTranspiled || len(fc.Errors()) != 1 || !strings.Contains(fc.Errors()[0].Error(), "test.conf: [Pos 1:10 [9]][Plugin split] semantic divergence") {
+		t.Errorf("unexpected coverage %v", fc.Errors())
+	}
+}
+
+func TestDealWithDeDot(t *testing.T) {
+	tt := []struct {
+		name   string
+		input  string
+		want   []string
+		params map[string]interface{}
+	}{
+		{
+			name:  "Nested fields",
+			input: `de_dot { nested => true recursive => false fields => ["a.b", "[c][d.e]"] }`,
+			want: []string{
+				`{"dot_expander":{"field":"a.b","override":true,"tag":"de_dot"}}`,
+				`{"dot_expander":{"field":"d.e","path":"c","override":true,"tag":"de_dot"}}`,
+			},
+		},
+		{
+			name:  "Nested top-level fields",
+			input: `de_dot { nested => true recursive => false }`,
+			want: []string{
+				`{"dot_expander":{"field":"*","override":true,"tag":"de_dot"}}`,
+			},
+		},
+		{
+			name:   "Default separator",
+			input:  `de_dot { }`,
+			params: map[string]interface{}{"separator": "_", "nested": false, "recursive": true},
+		},
+		{
+			name:   "Separator and fields",
+			input:  `de_dot { separator => "__" fields => ["[c][d.e]"] }`,
+			params: map[string]interface{}{"separator": "__", "nested": false, "recursive": true, "fields": [][]string{{"c", "d.e"}}},
+		},
+		{
+			name:   "Nested fields and their sub-fields",
+			input:  `de_dot { nested => true fields => ["a.b"] }`,
+			params: map[string]interface{}{"separator": "_", "nested": true, "recursive": true, "fields": [][]string{{"a.b"}}},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ips, _ := DealWithDeDot(extractPlugin("filter", tc.input), "de_dot", Transpile{})
+			if tc.params != nil {
+				sp, ok := ips[0].(ScriptProcessor)
+				if len(ips) != 1 || !ok {
+					t.Fatalf("want a script processor, got %v", ips)
+				}
+				if !reflect.DeepEqual(*sp.Params, tc.params) {
+					t.Errorf("want params %v, got %v", tc.params, *sp.Params)
+				}
+				return
+			}
+			if len(ips) != len(tc.want) {
+				t.Fatalf("want %d processors, got %d", len(tc.want), len(ips))
+			}
+			for i := range tc.want {
+				got := ExtractString(MyJsonEncode(ips[i]))
+				if tc.want[i]+"\n" != got {
+					t.Errorf("want %s, got %s", tc.want[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestDealWithUUID(t *testing.T) {
+	tt := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "Keep existing value",
+			input: `uuid { target => "[a][b]" }`,
+			want:  `{"script":{"source":"field(params.target).set(UUID.randomUUID().toString());","params":{"target":"a.b"},"if":"ctx?.a?.b == null","tag":"uuid","description":"Set a random UUID in field '[a][b]'"}}`,
+		},
+		{
+			name:  "Overwrite",
+			input: `uuid { target => "id" overwrite => true }`,
+			want:  `{"script":{"source":"field(params.target).set(UUID.randomUUID().toString());","params":{"target":"id"},"tag":"uuid","description":"Set a random UUID in field 'id'"}}`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ips, _ := DealWithUUID(extractPlugin("filter", tc.input), "uuid", Transpile{})
+			if len(ips) != 1 {
+				t.Fatalf("want 1 processor, got %d", len(ips))
+			}
+			if got := ExtractString(MyJsonEncode(ips[0])); tc.want+"\n" != got {
+				t.Errorf("want %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDealWithMutateMerge(t *testing.T) {
+	ips, _ := DealWithMutate(extractPlugin("filter", `mutate { merge => { "[a][b]" => "c" } }`), "mutate", Transpile{})
+	if len(ips) != 2 {
+		t.Fatalf("want 2 processors, got %d", len(ips))
+	}
+
+	want := `{"append":{"field":"a.b","value":["{{{c}}}"],"allow_duplicates":true,"if":"ctx?.c instanceof String && !(ctx?.a?.b instanceof Map)","tag":"mutate-2","description":"Merge field 'c' into field 'a.b'"}}`
+	if got := ExtractString(MyJsonEncode(ips[0])); want+"\n" != got {
+		t.Errorf("want %s, got %s", want, got)
+	}
+
+	sp := ips[1].(ScriptProcessor)
+	if *sp.If != "!(ctx?.c instanceof String)" || !reflect.DeepEqual(*sp.Params, map[string]interface{}{"dest": "a.b", "added": "c"}) {
+		t.Errorf("unexpected script processor %s", sp)
+	}
+}
+
+func TestDealWithXML(t *testing.T) {
+	tt := []struct {
+		name   string
+		input  string
+		params map[string]interface{}
+		cond   string
+		errors []string
+	}{
+		{
+			name:  "Store XML",
+			input: `xml { source => "[a][b]" target => "doc" force_array => false }`,
+			params: map[string]interface{}{
+				"source": "a.b", "target": "doc", "store_xml": true, "force_array": false, "force_content": false,
+				"suppress_empty": true, "remove_namespaces": false, "xpath": []map[string]interface{}{},
+			},
+			cond: "ctx?.a?.b instanceof String",
+		},
+		{
+			name:  "XPath",
+			input: `xml { source => "message" store_xml => false xpath => { "/a/b/text()" => "b" "/a/@id" => "[a][id]" "//b" => "c" "/a/b[1]/text()" => "d" } }`,
+			params: map[string]interface{}{
+				"source": "message", "store_xml": false, "force_array": true, "force_content": false,
+				"suppress_empty": true, "remove_namespaces": false, "xpath": []map[string]interface{}{
+					{"path": []string{"a", "b"}, "select": "text()", "target": "b"},
+					{"path": []string{"a"}, "select": "id", "target": "a.id"},
+				},
+			},
+			cond: "ctx?.message instanceof String",
+			errors: []string{
+				"unsupported XPath expression '//b': only absolute paths are supported",
+				"unsupported XPath expression '/a/b[1]/text()': the step 'b[1]' is not an element name",
+			},
+		},
+		{
+			name:   "Missing target",
+			input:  `xml { source => "message" }`,
+			errors: []string{"the target is required when store_xml is true"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tr := Transpile{coverage: newCoverageRecorder(), deal_with_error_locally: true}
+			plugin := extractPlugin("filter", tc.input)
+			tr.coverage.begin("filter", plugin, "xml")
+			ips, onFailure := DealWithXML(plugin, "xml", tr)
+
+			errs := tr.coverage.report("test.conf").Errors()
+			if len(errs) != len(tc.errors) {
+				t.Fatalf("want %d errors, got %v", len(tc.errors), errs)
+			}
+			for i := range tc.errors {
+				if !strings.Contains(errs[i].Error(), tc.errors[i]) {
+					t.Errorf("want error %s, got %s", tc.errors[i], errs[i])
+				}
+			}
+
+			if tc.params == nil {
+				if len(ips) != 0 {
+					t.Errorf("want no processors, got %v", ips)
+				}
+				return
+			}
+			sp, ok := ips[0].(ScriptProcessor)
+			if len(ips) != 1 || !ok || len(onFailure) == 0 {
+				t.Fatalf("want a script processor with on failure processors, got %v %v", ips, onFailure)
+			}
+			if !reflect.DeepEqual(*sp.Params, tc.params) {
+				t.Errorf("want params %v, got %v", tc.params, *sp.Params)
+			}
+			if *sp.If != tc.cond {
+				t.Errorf("want if %s, got %s", tc.cond, *sp.If)
+			}
+		})
+	}
+}
+
+func TestDealWithBytes(t *testing.T) {
+	tt := []struct {
+		name   string
+		input  string
+		want   string
+		params map[string]interface{}
+	}{
+		{
+			name:  "Binary conversion",
+			input: `bytes { source => "[a][size]" target => "size" }`,
+			want:  `{"bytes":{"field":"a.size","target_field":"size","ignore_missing":true,"tag":"bytes","description":"Convert the size in field '[a][size]' to bytes"}}`,
+		},
+		{
+			name:   "Metric conversion with comma separator",
+			input:  `bytes { target => "size" conversion_method => "metric" decimal_separator => "," }`,
+			params: map[string]interface{}{"source": "message", "target": "size", "base": 1000, "decimal_separator": ","},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ips, onFailure := DealWithBytes(extractPlugin("filter", tc.input), "bytes", Transpile{deal_with_error_locally: true})
+			if len(ips) != 1 || len(onFailure) != 1 {
+				t.Fatalf("want 1 processor and 1 on failure processor, got %v %v", ips, onFailure)
+			}
+			if tc.params != nil {
+				sp := ips[0].(ScriptProcessor)
+				if !reflect.DeepEqual(*sp.Params, tc.params) {
+					t.Errorf("want params %v, got %v", tc.params, *sp.Params)
+				}
+				return
+			}
+			if got := ExtractString(MyJsonEncode(ips[0])); tc.want+"\n" != got {
+				t.Errorf("want %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDealWithMutateConvert(t *testing.T) {
+	ips, _ := DealWithMutate(extractPlugin("filter", `mutate { convert => { "a" => "integer" "[b][c]" => "float_eu" "d" => "boolean" } }`), "mutate", Transpile{})
+	if len(ips) != 3 {
+		t.Fatalf("want 3 processors, got %d", len(ips))
+	}
+
+	if _, ok := ips[0].(ConvertProcessor); !ok {
+		t.Errorf("want a convert processor, got %s", ips[0])
+	}
+	for i, want := range []map[string]interface{}{{"field": "b.c", "type": "float_eu"}, {"field": "d", "type": "boolean"}} {
+		sp, ok := ips[i+1].(ScriptProcessor)
+		if !ok || !reflect.DeepEqual(*sp.Params, want) {
+			t.Errorf("want a script processor with params %v, got %s", want, ips[i+1])
+		}
+	}
+}
+
+func TestDealWithGrok(t *testing.T) {
+	tt := []struct {
+		name     string
+		input    string
+		want     string
+		pipeline []string
+	}{
+		{
+			name:  "Single field",
+			input: `grok { match => { "[a][b]" => ["%{WORD:w}", "%{INT:i}"] } }`,
+			want:  `{"grok":{"field":"a.b","patterns":["%{WORD:w}","%{INT:i}"],"tag":"grok"}}`,
+		},
+		{
+			name:  "Multiple fields",
+			input: `grok { match => { "b" => "%{WORD:w}" "a" => "%{INT:i}" } }`,
+			want:  `{"pipeline":{"name":"grok-match","tag":"grok"}}`,
+			pipeline: []string{
+				`{"grok":{"field":"b","patterns":["%{WORD:w}"],"tag":"grok-1","on_failure":[{"grok":{"field":"a","patterns":["%{INT:i}"],"tag":"grok-2"}}]}}`,
+			},
+		},
+		{
+			name:  "No break on match",
+			input: `grok { match => { "b" => ["%{WORD:w}", "%{INT:i}"] } break_on_match => false }`,
+			want:  `{"pipeline":{"name":"grok-match","tag":"grok"}}`,
+			pipeline: []string{
+				`{"grok":{"field":"b","patterns":["%{WORD:w}"],"tag":"grok-1","on_failure":[{"append":{"field":"_TRANSPILER.grok-grok-failures","value":["{{ _ingest.on_failure_processor_tag }}"],"description":"Count the patterns that do not match"}}]}}`,
+				`{"grok":{"field":"b","patterns":["%{INT:i}"],"tag":"grok-2","on_failure":[{"append":{"field":"_TRANSPILER.grok-grok-failures","value":["{{ _ingest.on_failure_processor_tag }}"],"description":"Count the patterns that do not match"}}]}}`,
+				`{"script":{"source":"def failures = ctx[params.prefix]?.remove(params.failures);\nif (failures != null && failures.size() == params.count) {\n  throw new IllegalArgumentException('No grok pattern matched');\n}","params":{"count":2,"failures":"grok-grok-failures","prefix":"_TRANSPILER"},"tag":"grok-no-match","description":"Fail if no grok pattern matched"}}`,
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ips, _ := DealWithGrok(extractPlugin("filter", tc.input), "grok", Transpile{})
+			if len(ips) != 1 {
+				t.Fatalf("want 1 processor, got %d", len(ips))
+			}
+			if got := ExtractString(MyJsonEncode(ips[0])); tc.want+"\n" != got {
+				t.Errorf("want %s, got %s", tc.want, got)
+			}
+			if tc.pipeline == nil {
+				return
+			}
+			processors := ips[0].(PipelineProcessor).Pipeline.Processors
+			if len(processors) != len(tc.pipeline) {
+				t.Fatalf("want %d processors in the pipeline, got %d", len(tc.pipeline), len(processors))
+			}
+			for i := range tc.pipeline {
+				if got := ExtractString(MyJsonEncode(processors[i])); tc.pipeline[i]+"\n" != got {
+					t.Errorf("want %s, got %s", tc.pipeline[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestDealWithGrokPatternsDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "patterns"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"patterns/a.grok": "# comment\nMYID %{MYPREFIX}-%{INT:[my][id]}\nMYPREFIX [A-Z]+\nUNUSED .*\n",
+		"patterns/b.grok": "MYPREFIX [a-z]+\nWORD \\w+\n",
+		"patterns/c.txt":  "MYID ignored\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tr := Transpile{coverage: newCoverageRecorder(), configFile: filepath.Join(dir, "test.conf")}
+	plugin := extractPlugin("filter", `grok { match => { "message" => "%{MYID} %{WORD:w}" } patterns_dir => ["patterns"] patterns_files_glob => "*.grok" pattern_definitions => { "MYPREFIX" => "X" } }`)
+	tr.coverage.begin("filter", plugin, "grok")
+	ips, _ := DealWithGrok(plugin, "grok", tr)
+
+	want := map[string]string{"MYID": "%{MYPREFIX}-%{INT:my.id}", "MYPREFIX": "X", "WORD": `\w+`}
+	if gp := ips[0].(GrokProcessor); !reflect.DeepEqual(gp.PatternDefinitions, want) {
+		t.Errorf("want %v, got %v", want, gp.PatternDefinitions)
+	}
+	if errs := tr.coverage.report("test.conf").Errors(); len(errs) != 1 || !strings.Contains(errs[0].Error(), "the pattern 'WORD' overrides the built-in pattern") {
+		t.Errorf("unexpected errors %v", errs)
+	}
+
+	tr.coverage = newCoverageRecorder()
+	plugin = extractPlugin("filter", `grok { match => { "message" => "%{MYID}" } patterns_dir => ["missing"] }`)
+	tr.coverage.begin("filter", plugin, "grok")
+	DealWithGrok(plugin, "grok", tr)
+	if errs := tr.coverage.report("test.conf").Errors(); len(errs) != 1 || !strings.Contains(errs[0].Error(), "cannot read the patterns directory") {
+		t.Errorf("unexpected errors %v", errs)
+	}
+}
+
+func TestDealWithDate(t *testing.T) {
+	tt := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "keywords and patterns",
+			input: `date { match => ["[a][ts]", "ISO8601", "UNIX_MS", "dd/MMM/YYYY:HH:mm:ss Z", "xxxx-'W'ww ZZ", "yyyy-MM-dd'T'HH:mm:ss ZZZ"] }`,
+			want:  []string{`{"date":{"field":"a.ts","formats":["ISO8601","UNIX_MS","dd/MMM/yyyy:HH:mm:ss Z","YYYY-'W'ww XXX","yyyy-MM-dd'T'HH:mm:ss VV"],"tag":"date"}}`},
+		},
+		{
+			name:  "formats with letters without equivalent are skipped",
+			input: `date { match => ["ts", "CCYY-MM-dd", "e HH:mm", "yyyy 'e'"] }`,
+			want:  []string{`{"date":{"field":"ts","formats":["yyyy 'e'"],"tag":"date"}}`},
+		},
+		{
+			name:  "no format left",
+			input: `date { match => ["ts", "CCYY"] }`,
+			want:  []string{},
+		},
+		{
+			name:  "timezone and locale references",
+			input: `date { match => ["ts", "UNIX"] target => "[b][c]" timezone => "%{[event][timezone]}" locale => "%{lang}" }`,
+			want:  []string{`{"date":{"field":"ts","target_field":"b.c","formats":["UNIX"],"timezone":"{{{event.timezone}}}","locale":"{{{lang}}}","tag":"date"}}`},
+		},
+		{
+			name:  "target reference",
+			input: `date { match => ["ts", "UNIX"] target => "[dates][%{type}]" }`,
+			want: []string{
+				`{"date":{"field":"ts","target_field":"_TRANSPILER.date-date","formats":["UNIX"],"tag":"date"}}`,
+				`{"set":{"field":"dates.{{{type}}}","copy_from":"_TRANSPILER.date-date","tag":"date-set"}}`,
+				`{"remove":{"field":["_TRANSPILER.date-date"],"ignore_missing":true,"tag":"date-cleanup"}}`,
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ips, onFailure := DealWithDate(extractPlugin("filter", tc.input), "date", Transpile{deal_with_error_locally: true})
+			if len(ips) != len(tc.want) {
+				t.Fatalf("want %d processors, got %v", len(tc.want), ips)
+			}
+			for i := range tc.want {
+				if got := ExtractString(MyJsonEncode(ips[i])); tc.want[i]+"\n" != got {
+					t.Errorf("want %s, got %s", tc.want[i], got)
+				}
+			}
+			if len(onFailure) != 1 || !strings.Contains(onFailure[0].String(), "_dateparsefailure") {
+				t.Errorf("unexpected on failure processors %v", onFailure)
+			}
+		})
+	}
+}
+
+func TestSprintfTimestamp(t *testing.T) {
+	tr := New(Options{Threshold: 100, LogLevel: "error"})
+	ips := tr.DealWithPlugin("output", extractPlugin("output", `elasticsearch { index => "logs-%{+YYYY.MM.dd}-%{[service]}" }`), Constraints{})
+	if len(ips) != 2 {
+		t.Fatalf("want 2 processors, got %v", ips)
+	}
+	wantParams := map[string]interface{}{"formats": map[string]interface{}{"YYYY_2eMM_2edd": "yyyy.MM.dd"}}
+	if sp := ips[0].(ScriptProcessor); !reflect.DeepEqual(*sp.Params, wantParams) {
+		t.Errorf("want params %v, got %v", wantParams, *sp.Params)
+	}
+	if value := ips[1].(SetProcessor).Value; value != "logs-{{{_TRANSPILER.timestamp.YYYY_2eMM_2edd}}}-{{{service}}}" {
+		t.Errorf("unexpected index %v", value)
+	}
+
+	ips = DealWithCommonAttributes(extractPlugin("filter", `mutate { add_field => { "epoch" => "%{+%s}" } add_tag => ["%{+EEE}", "t"] }`), Transpile{})
+	want := []string{
+		`{"set":{"value":"{{{_TRANSPILER.timestamp._25s}}}","field":"epoch"}}`,
+		`{"append":{"field":"tags","value":["{{{_TRANSPILER.timestamp.EEE}}}","t"]}}`,
+	}
+	if len(ips) != 4 {
+		t.Fatalf("want 4 processors, got %v", ips)
+	}
+	for i, ip := range []IngestProcessor{ips[1], ips[3]} {
+		if got := ExtractString(MyJsonEncode(ip)); want[i]+"\n" != got {
+			t.Errorf("want %s, got %s", want[i], got)
+		}
+	}
+	wantParams = map[string]interface{}{"formats": map[string]interface{}{"_25s": "%s"}}
+	if sp := ips[0].(ScriptProcessor); !reflect.DeepEqual(*sp.Params, wantParams) {
+		t.Errorf("want params %v, got %v", wantParams, *sp.Params)
+	}
+
+	// The timestamp of the add_field is computed after the date filter, the one of the timezone before
+	ips = tr.DealWithPlugin("filter", extractPlugin("filter", `date { match => ["ts", "ISO8601"] timezone => "%{+ZZZ}" add_field => { "y%{+YYYY}" => "x" } }`), Constraints{})
+	want = []string{"script", "date", "script", "set"}
+	if len(ips) != len(want) {
+		t.Fatalf("want %d processors, got %v", len(want), ips)
+	}
+	for i := range want {
+		if ips[i].IngestProcessorType() != want[i] {
+			t.Errorf("want processor %d to be a %s, got %s", i, want[i], ips[i])
+		}
+	}
+	if tz := *ips[1].(DateProcessor).Timezone; tz != "{{{_TRANSPILER.timestamp.ZZZ}}}" {
+		t.Errorf("unexpected timezone %s", tz)
+	}
+	if field := ips[3].(SetProcessor).Field; field != "y{{{_TRANSPILER.timestamp.YYYY}}}" {
+		t.Errorf("unexpected field %s", field)
+	}
+
+	if got, _ := toElasticPipelineSelectorExpression("%{+YYYY}", ScriptContext); !strings.Contains(got, "ctx?._TRANSPILER?.timestamp?.YYYY") {
+		t.Errorf("unexpected script expression %s", got)
+	}
+
+	// The formats with letters without an equivalent are reported, for the common and the plugin attributes
+	tr.coverage.reset()
+	tr.DealWithPlugin("output", extractPlugin("output", `elasticsearch { index => "logs-%{+CC}" }`), Constraints{})
+	tr.DealWithPlugin("filter", extractPlugin("filter", `mutate { add_tag => ["%{+YYYY}", "%{+e}"] }`), Constraints{})
+	errs := tr.coverage.report("test.conf").Errors()
+	if len(errs) != 2 || !strings.Contains(errs[0].Error(), "Attribute 'index': the pattern letters C of the timestamp format 'CC'") || !strings.Contains(errs[1].Error(), "Attribute 'add_tag': the pattern letters e of the timestamp format 'e'") {
+		t.Errorf("unexpected errors %v", errs)
+	}
+}
+
+func TestDealWithGeoIP(t *testing.T) {
+	tt := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "ecs",
+			input: `geoip { source => "[client][ip]" fields => ["city_name", "location", "ip"] }`,
+			want: []string{
+				`{"geoip":{"field":"client.ip","target_field":"_TRANSPILER.geoip-geoip","database_file":"GeoLite2-City.mmdb","properties":["city_name","location","ip"],"ignore_missing":true,"tag":"geoip"}}`,
+				`{"set":{"field":"client.geo.city_name","copy_from":"_TRANSPILER.geoip-geoip.city_name","ignore_empty_value":true,"tag":"geoip-city_name"}}`,
+				`{"set":{"field":"client.geo.location","copy_from":"_TRANSPILER.geoip-geoip.location","ignore_empty_value":true,"tag":"geoip-location"}}`,
+				`{"set":{"field":"client.ip","copy_from":"_TRANSPILER.geoip-geoip.ip","ignore_empty_value":true,"tag":"geoip-ip"}}`,
+				`{"append":{"field":"tags","value":["_geoip_lookup_failure"],"if":"ctx?._TRANSPILER?.get('geoip-geoip') == null","tag":"append-tag-geoip","description":"Append Tag on Failure"}}`,
+				`{"remove":{"field":["_TRANSPILER.geoip-geoip"],"ignore_missing":true,"tag":"geoip-cleanup"}}`,
+			},
+		},
+		{
+			name:  "legacy asn database",
+			input: `geoip { source => "src" database => "/etc/GeoLite2-ASN.mmdb" fields => ["autonomous_system_number", "autonomous_system_organization", "city_name"] ecs_compatibility => "disabled" }`,
+			want: []string{
+				`{"geoip":{"field":"src","target_field":"_TRANSPILER.geoip-geoip","database_file":"GeoLite2-ASN.mmdb","properties":["asn","organization_name"],"ignore_missing":true,"tag":"geoip"}}`,
+				`{"set":{"field":"geoip.asn","copy_from":"_TRANSPILER.geoip-geoip.asn","ignore_empty_value":true,"tag":"geoip-autonomous_system_number"}}`,
+				`{"set":{"field":"geoip.as_org","copy_from":"_TRANSPILER.geoip-geoip.organization_name","ignore_empty_value":true,"tag":"geoip-autonomous_system_organization"}}`,
+				`{"append":{"field":"tags","value":["_geoip_lookup_failure"],"if":"ctx?._TRANSPILER?.get('geoip-geoip') == null","tag":"append-tag-geoip","description":"Append Tag on Failure"}}`,
+				`{"remove":{"field":["_TRANSPILER.geoip-geoip"],"ignore_missing":true,"tag":"geoip-cleanup"}}`,
+			},
+		},
+		{
+			name:  "legacy region code and latitude",
+			input: `geoip { source => "src" fields => ["region_code", "latitude"] ecs_compatibility => "disabled" tag_on_failure => ["x"] }`,
+			want: []string{
+				`{"geoip":{"field":"src","target_field":"_TRANSPILER.geoip-geoip","database_file":"GeoLite2-City.mmdb","properties":["region_iso_code","location"],"ignore_missing":true,"tag":"geoip"}}`,
+				`{"gsub":{"field":"_TRANSPILER.geoip-geoip.region_iso_code","pattern":"^[^-]+-","replacement":"","target_field":"geoip.region_code","ignore_missing":true,"tag":"geoip-region_code"}}`,
+				`{"set":{"field":"geoip.latitude","copy_from":"_TRANSPILER.geoip-geoip.location.lat","ignore_empty_value":true,"tag":"geoip-latitude"}}`,
+				`{"append":{"field":"tags","value":["x"],"if":"ctx?._TRANSPILER?.get('geoip-geoip') == null","tag":"append-tag-geoip","description":"Append Tag on Failure"}}`,
+				`{"remove":{"field":["_TRANSPILER.geoip-geoip"],"ignore_missing":true,"tag":"geoip-cleanup"}}`,
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ips, _ := DealWithGeoIP(extractPlugin("filter", tc.input), "geoip", Transpile{deal_with_error_locally: true})
+			if len(ips) != len(tc.want) {
+				t.Fatalf("want %d processors, got %v", len(tc.want), ips)
+			}
+			for i := range tc.want {
+				if got := ExtractString(MyJsonEncode(ips[i])); tc.want[i]+"\n" != got {
+					t.Errorf("want %s, got %s", tc.want[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestDealWithKV(t *testing.T) {
+	tt := []struct {
+		name   string
+		input  string
+		want   string
+		params map[string]interface{}
+		source string
+	}{
+		{
+			name:  "tab field_split",
+			input: `kv { field_split => "\t" value_split => ":=" }`,
+			want:  `{"kv":{"field":"message","field_split":"\\t","value_split":"[:=]","tag":"kv"}}`,
+		},
+		{
+			name:  "native options",
+			input: `kv { source => "[a][m]" target => "[b]" field_split => "&?" value_split => ":" trim_key => "<>" trim_value => " " include_brackets => false }`,
+			want:  `{"kv":{"field":"a.m","field_split":"[&\\?]","value_split":":","target_field":"b","trim_key":"<>","trim_value":" ","strip_brackets":true,"tag":"kv"}}`,
+		},
+		{
+			name:   "transform_key",
+			input:  `kv { transform_key => "lowercase" prefix => "p_" include_keys => ["a"] }`,
+			want:   `{"kv":{"field":"message","field_split":" ","value_split":"=","target_field":"_TRANSPILER.kv-kv","tag":"kv"}}`,
+			params: map[string]interface{}{"tmp": "kv-kv", "prefix": "p_", "allow_duplicate_values": true, "transform_key": "lowercase", "include_keys": []string{"a"}},
+		},
+		{
+			name:   "allow_duplicate_values and remove_char_value",
+			input:  `kv { target => "t" prefix => "p_" allow_duplicate_values => false remove_char_value => "<>" }`,
+			want:   `{"kv":{"field":"message","field_split":" ","value_split":"=","target_field":"_TRANSPILER.kv-kv","prefix":"p_","tag":"kv"}}`,
+			params: map[string]interface{}{"tmp": "kv-kv", "prefix": "", "allow_duplicate_values": false, "target": "t"},
+		},
+		{
+			name:   "remove_char_key special characters",
+			input:  `kv { remove_char_key => "]\\^a-/" }`,
+			want:   `{"kv":{"field":"message","field_split":" ","value_split":"=","target_field":"_TRANSPILER.kv-kv","tag":"kv"}}`,
+			params: map[string]interface{}{"tmp": "kv-kv", "prefix": "", "allow_duplicate_values": true},
+			source: `return /[\]\\\^a\-\/]/.matcher(s).replaceAll('');`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ips, _ := DealWithKV(extractPlugin("filter", tc.input), "kv", Transpile{})
+			if got := ExtractString(MyJsonEncode(ips[0])); tc.want+"\n" != got {
+				t.Errorf("want %s, got %s", tc.want, got)
+			}
+			if tc.params == nil {
+				if len(ips) != 1 {
+					t.Errorf("want 1 processor, got %v", ips)
+				}
+				return
+			}
+			if len(ips) != 2 {
+				t.Fatalf("want 2 processors, got %v", ips)
+			}
+			sp := ips[1].(ScriptProcessor)
+			if !reflect.DeepEqual(*sp.Params, tc.params) {
+				t.Errorf("want params %v, got %v", tc.params, *sp.Params)
+			}
+			if !strings.Contains(*sp.Source, tc.source) {
+				t.Errorf("want the source to contain %s, got %s", tc.source, *sp.Source)
+			}
+		})
+	}
+}
+
+func TestDealWithTranslate(t *testing.T) {
+	tt := []struct {
+		name   string
+		input  string
+		params map[string]interface{}
+		lookup string
+	}{
+		{
+			name:   "exact",
+			input:  `translate { source => "[a][b]" dictionary => { "1" => "one" "2" => 2 } fallback => "none" }`,
+			params: map[string]interface{}{"source": "a.b", "target": "a.b", "override": true, "fallback": "none", "dictionary": map[string]interface{}{"1": "one", "2": "2"}},
+			lookup: `return params.dictionary[s];`,
+		},
+		{
+			name:   "regex",
+			input:  `translate { source => "a" target => "b" regex => true dictionary => { "^x/y" => "first" "x" => "second" } }`,
+			params: map[string]interface{}{"source": "a", "target": "b", "override": false, "values": []interface{}{"first", "second"}},
+			lookup: `List patterns = [/^x\/y/, /x/];`,
+		},
+		{
+			name:   "not exact",
+			input:  `translate { source => "a" exact => false override => true dictionary => { "a.b" => "x" "c" => "y" } ecs_compatibility => "disabled" }`,
+			params: map[string]interface{}{"source": "a", "target": "translation", "override": true, "dictionary": map[string]interface{}{"a.b": "x", "c": "y"}},
+			lookup: `Pattern union = /(?:a\.b)|(?:c)/;`,
+		},
+		{
+			name:   "iterate_on",
+			input:  `translate { iterate_on => "[items]" source => "code" target => "name" dictionary => { "1" => "one" } }`,
+			params: map[string]interface{}{"source": "code", "target": "name", "iterate_on": "items", "override": false, "dictionary": map[string]interface{}{"1": "one"}},
+			lookup: `return params.dictionary[s];`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ips, _ := DealWithTranslate(extractPlugin("filter", tc.input), "translate", Transpile{})
+			if len(ips) != 1 {
+				t.Fatalf("want 1 processor, got %d", len(ips))
+			}
+			sp := ips[0].(ScriptProcessor)
+			if !reflect.DeepEqual(*sp.Params, tc.params) {
+				t.Errorf("want params %v, got %v", tc.params, *sp.Params)
+			}
+			if !strings.Contains(*sp.Source, tc.lookup) {
+				t.Errorf("want the lookup %s, got %s", tc.lookup, *sp.Source)
+			}
+		})
+	}
+}
+
+func TestDealWithTranslateDictionaryPath(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"d.yml":  "b: 2\na: one\n",
+		"d.json": `{"c": "three", "a": "uno"}`,
+		"d.csv":  "d,four\n\"e,f\",five\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := newTranslateDictionary()
+	for _, name := range []string{"d.yml", "d.json", "d.csv"} {
+		if err := readTranslateDictionary(filepath.Join(dir, name), &d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wantKeys := []string{"b", "a", "c", "d", "e,f"}
+	wantValues := map[string]interface{}{"a": "uno", "b": 2, "c": "three", "d": "four", "e,f": "five"}
+	if !reflect.DeepEqual(d.keys, wantKeys) || !reflect.DeepEqual(d.values, wantValues) {
+		t.Errorf("want %v %v, got %v %v", wantKeys, wantValues, d.keys, d.values)
+	}
+
+	// The dictionary is resolved against the configuration file, larger dictionaries use an enrich processor
+	tr := Transpile{coverage: newCoverageRecorder(), configFile: filepath.Join(dir, "test.conf"), translateEnrichThreshold: 1, enrichPolicies: &[]EnrichPolicy{}}
+	plugin := extractPlugin("filter", `translate { source => "a" target => "b" dictionary_path => "d.yml" }`)
+	tr.coverage.begin("filter", plugin, "translate")
+	ips, _ := DealWithTranslate(plugin, "Translate", tr)
+
+	want := []string{
+		`{"enrich":{"policy_name":"translate-translate","field":"a","target_field":"_TRANSPILER.Translate-translation","ignore_missing":true,"tag":"Translate","description":"Translate the field 'a' with the enrich policy 'translate-translate'"}}`,
+		`{"set":{"field":"b","copy_from":"_TRANSPILER.Translate-translation.value","override":false,"if":"!(ctx?._TRANSPILER?.get('Translate-translation') == null)","tag":"Translate-set"}}`,
+		`{"remove":{"field":["_TRANSPILER.Translate-translation"],"ignore_missing":true,"tag":"Translate-cleanup"}}`,
+	}
+	if len(ips) != len(want) {
+		t.Fatalf("want %d processors, got %d", len(want), len(ips))
+	}
+	for i := range want {
+		if got := ExtractString(MyJsonEncode(ips[i])); want[i]+"\n" != got {
+			t.Errorf("want %s, got %s", want[i], got)
+		}
+	}
+	wantPolicies := []EnrichPolicy{{Name: "translate-translate", Documents: []map[string]interface{}{{"key": "b", "value": 2}, {"key": "a", "value": "one"}}}}
+	if !reflect.DeepEqual(*tr.enrichPolicies, wantPolicies) {
+		t.Errorf("want %v, got %v", wantPolicies, *tr.enrichPolicies)
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	c := dealWithError(config.Parse("fake", []byte(`filter {
+  mutate { add_field => { "a" => "b" } }
+  grok { match => { "message" => "%{WORD:w}" } timeout_millis => 100 }
+  ruby { code => "1" }
+  kv { source => "m" foo => "bar" }
+}`))).(ast.Config)
+
+	tr := New(Options{Threshold: 1, LogLevel: "error", DealWithErrorLocally: true, Fidelity: true, AddCleanupProcessor: true, CoverageReport: "json"})
+	tr.buildIngestPipeline("fake", c)
+	fc := tr.coverage.report("fake")
+
+	want := []struct {
+		name       string
+		coverage   Coverage
+		attributes map[string]Coverage
+	}{
+		{name: "mutate", coverage: FullyTranspiled, attributes: map[string]Coverage{"add_field": FullyTranspiled}},
+		{name: "grok", coverage: PartiallyTranspiled, attributes: map[string]Coverage{"match": FullyTranspiled, "timeout_millis": NotTranspiled}},
+		{name: "ruby", coverage: NotTranspiled, attributes: map[string]Coverage{"code": FullyTranspiled}},
+		{name: "kv", coverage: PartiallyTranspiled, attributes: map[string]Coverage{"source": FullyTranspiled, "foo": NotTranspiled}},
+	}
+
+	if len(fc.Plugins) != len(want) {
+		t.Fatalf("want %d plugins, got %d", len(want), len(fc.Plugins))
+	}
+	for i, w := range want {
+		pc := fc.Plugins[i]
+		if pc.Name != w.name || pc.Coverage != w.coverage {
+			t.Errorf("want %s with coverage %s, got %s with coverage %s", w.name, w.coverage, pc.Name, pc.Coverage)
+		}
+		for _, ac := range pc.Attributes {
+			if ac.Coverage != w.attributes[ac.Name] {
+				t.Errorf("%s: want attribute %s with coverage %s, got %s", w.name, ac.Name, w.attributes[ac.Name], ac.Coverage)
+			}
+		}
+	}
+	if fc.Plugins[1].Pos != "3:3 [52]" {
+		t.Errorf("want grok at position 3:3 [52], got %s", fc.Plugins[1].Pos)
+	}
+	if fc.FullyTranspiled != 1 || fc.PartiallyTranspiled != 2 || fc.NotTranspiled != 1 || fc.Percentage != 25 {
+		t.Errorf("unexpected summary %d/%d/%d %.1f%%", fc.FullyTranspiled, fc.PartiallyTranspiled, fc.NotTranspiled, fc.Percentage)
+	}
+}
+
+func TestCoverageErrors(t *testing.T) {
+	c := dealWithError(config.Parse("fake", []byte(`filter {
+  date { match => ["ts", "ISO8601"] locale => "en" }
+  grok { match => { "a" => "%{WORD:w}" "b" => "%{WORD:w}" } timeout_millis => 100 }
+}`))).(ast.Config)
+
+	tr := New(Options{Threshold: 1, LogLevel: "error", DealWithErrorLocally: true, Fidelity: true, AddCleanupProcessor: true, Strict: true})
+	tr.buildIngestPipeline("fake", c)
+	errs := tr.coverage.report("fake").Errors()
+
+	want := []string{
+		"fake: [Pos 3:61 [122]][Plugin grok] Attribute 'timeout_millis': attribute is currently not supported",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("want %d errors, got %v", len(want), errs)
+	}
+	for i := range want {
+		if errs[i].Error() != want[i] {
+			t.Errorf("want %q, got %q", want[i], errs[i].Error())
+		}
+	}
+}
+
+func TestOutputFormats(t *testing.T) {
+	c := dealWithError(config.Parse("fake", []byte(`filter {
+  if [a] == "x" { mutate { add_tag => ["a"] } mutate { add_tag => ["b"] } } else { mutate { add_tag => ["c"] } }
+}`))).(ast.Config)
+
+	ips := New(Options{Threshold: 1, LogLevel: "error", DealWithErrorLocally: true, Fidelity: true, AddCleanupProcessor: true, OutputFormat: OutputFormatDevTools}).buildIngestPipeline("fake", c)
+
+	// Every pipeline must be defined before the pipelines referencing it
+	defined := map[string]bool{}
+	for _, ip := range dependencyOrder(ips) {
+		for _, p := range ip.Processors {
+			if pp, ok := p.(PipelineProcessor); ok && !defined[pp.Name] {
+				t.Errorf("pipeline %s references %s before its definition", ip.Name, pp.Name)
+			}
+		}
+		defined[ip.Name] = true
+	}
+
+	devtools, err := formatDevTools(ips)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(devtools, "PUT _ingest/pipeline/"); got != len(ips) {
+		t.Errorf("want %d requests, got %d", len(ips), got)
+	}
+	if !strings.HasPrefix(devtools, "PUT _ingest/pipeline/main-pipeline-fake-branch-0-else\n{\n") {
+		t.Errorf("unexpected devtools output %s", devtools)
+	}
+
+	bulk, err := formatNDJSONBulk(ips)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(bulk, "\n"), "\n")
+	if len(lines) != len(ips) {
+		t.Fatalf("want %d lines, got %d", len(ips), len(lines))
+	}
+	for i, ip := range dependencyOrder(ips) {
+		var line struct {
+			Name     string                 `json:"name"`
+			Pipeline map[string]interface{} `json:"pipeline"`
+		}
+		if err := json.Unmarshal([]byte(lines[i]), &line); err != nil {
+			t.Fatalf("line %d: %v", i, err)
+		}
+		if line.Name != ip.Name || line.Pipeline["processors"] == nil {
+			t.Errorf("line %d: unexpected %s", i, lines[i])
+		}
+	}
+}
+
+func TestWritePipelines(t *testing.T) {
+	c := dealWithError(config.Parse("fake", []byte(`filter {
+  if [a] == "x" { mutate { add_tag => ["a"] } mutate { add_tag => ["b"] } }
+}`))).(ast.Config)
+
+	ips := New(Options{Threshold: 1, LogLevel: "error", DealWithErrorLocally: true, Fidelity: true, AddCleanupProcessor: true}).buildIngestPipeline("fake.conf", c)
+	manifest := Manifest{}
+	manifest.add("fake.conf", ips, ".json")
+
+	policies := []EnrichPolicy{{Name: "translate-t", Documents: []map[string]interface{}{{"key": "k", "value": "v"}}}}
+
+	dir := t.TempDir()
+	if err := writePipelines(dir, ips, policies, manifest, OutputFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	var got Manifest
+	buf, err := os.ReadFile(filepath.Join(dir, manifestFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(buf, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Pipelines) != 1 || got.Pipelines[0].Main.Name != "main-pipeline-fake" || len(got.Pipelines[0].Children) != len(ips)-1 {
+		t.Fatalf("unexpected manifest %s", buf)
+	}
+
+	for _, p := range append([]ManifestPipeline{got.Pipelines[0].Main}, got.Pipelines[0].Children...) {
+		buf, err := os.ReadFile(filepath.Join(dir, p.File))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ip, err := DecodeIngestPipeline(p.Name, buf)
+		if err != nil {
+			t.Fatalf("%s: %v", p.File, err)
+		}
+		if len(ip.Processors) == 0 {
+			t.Errorf("%s: no processors", p.File)
+		}
+	}
+
+	if len(got.EnrichPolicies) != 1 || got.EnrichPolicies[0].File != "enrich-translate-t.txt" {
+		t.Fatalf("unexpected manifest %s", buf)
+	}
+	buf, err = os.ReadFile(filepath.Join(dir, got.EnrichPolicies[0].File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(buf), "POST translate-t/_bulk?refresh=true\n{\"index\":{}}\n{\"key\":\"k\",\"value\":\"v\"}\n") || !strings.Contains(string(buf), "POST _enrich/policy/translate-t/_execute") {
+		t.Errorf("unexpected enrich policy %s", buf)
+	}
+}
+
+func TestFormatYAML(t *testing.T) {
+	ip := NewIngestPipeline("main")
+	ip.Processors = append(ip.Processors,
+		ScriptProcessor{Source: pointer("if (ctx.a != null) {\n  ctx.b = 'true';\n}")},
+		SetProcessor{Field: "n", Value: "1"},
+	)
+
+	got, err := formatYAML([]IngestPipeline{ip})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `main:
+  description: ""
+  processors:
+    - script:
+        source: |-
+          if (ctx.a != null) {
+            ctx.b = 'true';
+          }
+    - set:
+        value: "1"
+        field: n
+`
+	if got != want {
+		t.Errorf("want\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestRunEnrichPoliciesWithoutOutput(t *testing.T) {
+	for _, format := range []string{OutputFormatJSON, OutputFormatYAML, OutputFormatNDJSONBulk} {
+		err := New(Options{LogLevel: "error", OutputFormat: format, TranslateEnrichThreshold: 1}).Run(nil)
+		if err == nil || !strings.Contains(err.Error(), "enrich policies") {
+			t.Errorf("want an error for the output format %s, got %v", format, err)
+		}
+	}
+}
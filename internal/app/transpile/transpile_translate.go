@@ -0,0 +1,381 @@
+package transpile
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	ast "github.com/herrBez/baffo/ast"
+	"github.com/pkg/errors"
+	"go.yaml.in/yaml/v3"
+)
+
+// translateDictionary is the dictionary of a translate filter, the keys are kept in the order of the configuration
+type translateDictionary struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newTranslateDictionary() translateDictionary {
+	return translateDictionary{keys: []string{}, values: map[string]interface{}{}}
+}
+
+// add adds an entry, a key already present keeps its position and gets the new value
+func (d *translateDictionary) add(key string, value interface{}) {
+	if _, ok := d.values[key]; !ok {
+		d.keys = append(d.keys, key)
+	}
+	d.values[key] = value
+}
+
+// readTranslateDictionary reads a dictionary_path file as done by Logstash: a YAML or JSON object or a CSV file
+// with a key and a value per line, the format is given by the extension of the file
+func readTranslateDictionary(file string, d *translateDictionary) error {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return errors.Wrapf(err, "cannot read the dictionary %s", file)
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yml", ".yaml":
+		var doc yaml.Node
+		if err := yaml.Unmarshal(buf, &doc); err != nil {
+			return errors.Wrapf(err, "invalid YAML dictionary %s", file)
+		}
+		if len(doc.Content) == 0 {
+			return nil
+		}
+		mapping := doc.Content[0]
+		if mapping.Kind != yaml.MappingNode {
+			return errors.Errorf("invalid YAML dictionary %s: a mapping is expected", file)
+		}
+		for i := 0; i+1 < len(mapping.Content); i += 2 {
+			var value interface{}
+			if err := mapping.Content[i+1].Decode(&value); err != nil {
+				return errors.Wrapf(err, "invalid YAML dictionary %s", file)
+			}
+			d.add(mapping.Content[i].Value, value)
+		}
+
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(buf))
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+			return errors.Errorf("invalid JSON dictionary %s: an object is expected", file)
+		}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return errors.Wrapf(err, "invalid JSON dictionary %s", file)
+			}
+			var value interface{}
+			if err := dec.Decode(&value); err != nil {
+				return errors.Wrapf(err, "invalid JSON dictionary %s", file)
+			}
+			d.add(tok.(string), value)
+		}
+
+	case ".csv":
+		r := csv.NewReader(bytes.NewReader(buf))
+		r.FieldsPerRecord = -1
+		records, err := r.ReadAll()
+		if err != nil {
+			return errors.Wrapf(err, "invalid CSV dictionary %s", file)
+		}
+		for _, record := range records {
+			if len(record) >= 2 {
+				d.add(record[0], record[1])
+			}
+		}
+
+	default:
+		return errors.Errorf("unsupported dictionary %s, the extension should be .yml, .yaml, .json or .csv", file)
+	}
+	return nil
+}
+
+// painlessRegex returns a Painless regex literal matching the regular expression
+func painlessRegex(expression string) string {
+	return "/" + strings.ReplaceAll(expression, "/", `\/`) + "/"
+}
+
+// translateLookup returns the body of the lookup function of the translate script. Painless cannot compile
+// regular expressions at runtime, thus the regular expressions of the dictionary are literals of the script.
+func translateLookup(d translateDictionary, exact bool, regex bool) string {
+	expressions := make([]string, len(d.keys))
+	for i, key := range d.keys {
+		if regex {
+			expressions[i] = key
+		} else {
+			expressions[i] = regexp.QuoteMeta(key)
+		}
+	}
+
+	switch {
+	case exact && !regex:
+		return `return params.dictionary[s];`
+	case exact:
+		literals := make([]string, len(expressions))
+		for i := range expressions {
+			literals[i] = painlessRegex(expressions[i])
+		}
+		return fmt.Sprintf(`List patterns = [%s];
+  for (int i = 0; i < patterns.size(); i++) {
+    if (patterns[i].matcher(s).find()) {
+      return params.values[i];
+    }
+  }
+  return null;`, strings.Join(literals, ", "))
+	default:
+		// Every occurrence of a key is replaced by its value, as done by Ruby's gsub with a hash
+		return fmt.Sprintf(`Pattern union = %s;
+  if (!union.matcher(s).find()) {
+    return null;
+  }
+  return s.replaceAll(union, m -> {
+    def v = params.dictionary[m.group()];
+    return v == null ? '' : v.toString();
+  });`, painlessRegex("(?:"+strings.Join(expressions, ")|(?:")+")"))
+	}
+}
+
+// Translate Plugin of Logstash
+// The dictionary (inline or read from dictionary_path, relative to the configuration file) is a parameter of a
+// script. When the transpiler is configured with a threshold, the exact dictionaries larger than the threshold
+// are looked up with an enrich processor instead: the enrich policy and the documents of its source index are
+// emitted together with the pipelines.
+func DealWithTranslate(plugin ast.Plugin, id string, t Transpile) ([]IngestProcessor, []IngestProcessor) {
+	ingestProcessors := []IngestProcessor{}
+	onFailureProcessors := []IngestProcessor{}
+
+	var target *string = nil
+	ECSCompatibility := "v8" // We assume ECS Compatibility
+	dictionary := newTranslateDictionary()
+	var source *string = nil
+	var fallback *string = nil
+	var iterateOn *string = nil
+	var override *bool = nil
+	exact := true
+	regex := false
+
+	for _, attr := range plugin.Attributes {
+		switch attr.Name() {
+		// It is a common field
+		case "tag_on_failure":
+			onFailureProcessors = DealWithTagOnFailure(attr, id, t)
+		case "destination", "target":
+			target = pointer(getStringAttributeString(attr))
+
+		case "dictionary":
+			switch tattr := attr.(type) {
+			case ast.HashAttribute:
+				for _, entry := range tattr.Entries {
+					key := entry.Key.ValueString()
+					if k, ok := entry.Key.(ast.StringAttribute); ok {
+						key = k.Value()
+					}
+					switch value := entry.Value.(type) {
+					case ast.StringAttribute:
+						dictionary.add(key, value.Value())
+					case ast.NumberAttribute:
+						dictionary.add(key, value.ValueString())
+					default:
+						t.lossyAttribute(plugin, attr, PartiallyTranspiled, "the value of the key '%s' is not supported", key)
+					}
+				}
+			case ast.ArrayAttribute:
+				// The legacy format is a list of keys and values
+				values := getArrayStringAttributes(tattr)
+				for i := 0; i+1 < len(values); i += 2 {
+					dictionary.add(values[i], values[i+1])
+				}
+			default:
+				t.unsupportedAttribute(plugin, attr)
+			}
+
+		case "dictionary_path":
+			file := getStringAttributeString(attr)
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(filepath.Dir(t.configFile), file)
+			}
+			if err := readTranslateDictionary(file, &dictionary); err != nil {
+				t.lossyAttribute(plugin, attr, NotTranspiled, "%v", err)
+			}
+
+		case "refresh_interval", "refresh_behaviour":
+			t.lossyAttribute(plugin, attr, PartiallyTranspiled, "the dictionary is read when transpiling and never refreshed")
+
+		case "yaml_dictionary_code_point_limit", "yaml_load_strategy": // N/A
+
+		case "ecs_compatibility":
+			ECSCompatibility = getStringAttributeString(attr)
+
+		case "field", "source":
+			source = pointer(getStringAttributeString(attr))
+
+		case "fallback":
+			fallback = pointer(getStringAttributeString(attr))
+			if strings.Contains(*fallback, "%{") {
+				t.lossyAttribute(plugin, attr, PartiallyTranspiled, "the field references of the fallback are not resolved")
+			}
+
+		case "exact":
+			exact = getBoolValue(attr)
+
+		case "regex":
+			regex = getBoolValue(attr)
+
+		case "override":
+			override = pointer(getBoolValue(attr))
+
+		case "iterate_on":
+			iterateOn = pointer(getStringAttributeString(attr))
+
+		default:
+			t.unsupportedAttribute(plugin, attr)
+		}
+	}
+
+	if source == nil {
+		t.lossyPlugin(plugin, "the source is required, the plugin is skipped")
+		return ingestProcessors, onFailureProcessors
+	}
+
+	if target == nil {
+		switch ECSCompatibility {
+		case "disabled":
+			target = pointer("translation")
+		case "v1", "v8":
+			target = source
+		}
+	}
+	// Post-Condition: Translation will always be a string
+
+	// The translation is done in place by default when the target is the source
+	if override == nil {
+		override = pointer(*target == *source)
+	}
+
+	if t.translateEnrichThreshold > 0 && len(dictionary.keys) > t.translateEnrichThreshold && exact && !regex && iterateOn == nil {
+		return t.translateWithEnrich(id, dictionary, *source, *target, fallback, *override), onFailureProcessors
+	}
+
+	params := map[string]interface{}{
+		"override": *override,
+	}
+	if fallback != nil {
+		params["fallback"] = *fallback
+	}
+	if exact && regex {
+		values := make([]interface{}, len(dictionary.keys))
+		for i, key := range dictionary.keys {
+			values[i] = dictionary.values[key]
+		}
+		params["values"] = values
+	} else {
+		params["dictionary"] = dictionary.values
+	}
+
+	// With iterate_on, the source and the target are either the array of values or the keys of the objects of the array
+	params["source"] = toElasticPipelineSelector(*source)
+	params["target"] = toElasticPipelineSelector(*target)
+	if iterateOn != nil {
+		params["iterate_on"] = toElasticPipelineSelector(*iterateOn)
+	}
+
+	ingestProcessors = append(ingestProcessors, ScriptProcessor{
+		Source: pointer(`def lookup(def value, Map params) {
+  if (value == null) {
+    return null;
+  }
+  String s = value.toString();
+  ` + translateLookup(dictionary, exact, regex) + `
+}
+if (params.iterate_on == null) {
+  def source = $(params.source, null);
+  if (source == null || (!params.override && $(params.target, null) != null)) {
+    return;
+  }
+  def v = lookup(source, params);
+  if (v == null) {
+    v = params.fallback;
+  }
+  if (v != null) {
+    field(params.target).set(v);
+  }
+} else if (params.iterate_on == params.source) {
+  def items = $(params.iterate_on, null);
+  if (!(items instanceof List) || (!params.override && $(params.target, null) != null)) {
+    return;
+  }
+  List translated = new ArrayList();
+  for (def item : items) {
+    def v = lookup(item, params);
+    translated.add(v == null ? params.fallback : v);
+  }
+  field(params.target).set(translated);
+} else {
+  def items = $(params.iterate_on, null);
+  if (!(items instanceof List)) {
+    return;
+  }
+  for (def item : items) {
+    if (item instanceof Map && item[params.source] != null && (params.override || item[params.target] == null)) {
+      def v = lookup(item[params.source], params);
+      if (v == null) {
+        v = params.fallback;
+      }
+      if (v != null) {
+        item[params.target] = v;
+      }
+    }
+  }
+}`),
+		Params: &params,
+	}.WithTag(id).WithDescription(fmt.Sprintf("Translate the field '%s' to field '%s'.", toElasticPipelineSelector(*source), toElasticPipelineSelector(*target))))
+
+	return ingestProcessors, onFailureProcessors
+}
+
+// translateWithEnrich looks up the dictionary with an enrich processor, whose policy is recorded to be emitted with the pipelines
+func (t Transpile) translateWithEnrich(id string, dictionary translateDictionary, source string, target string, fallback *string, override bool) []IngestProcessor {
+	policy := EnrichPolicy{Name: fmt.Sprintf("translate-%s", strings.ToLower(id)), Documents: []map[string]interface{}{}}
+	for _, key := range dictionary.keys {
+		policy.Documents = append(policy.Documents, map[string]interface{}{"key": key, "value": dictionary.values[key]})
+	}
+	*t.enrichPolicies = append(*t.enrichPolicies, policy)
+
+	translation := fmt.Sprintf("%s.%s-translation", TRANSPILER_PREFIX, id)
+	translationIsNull := fmt.Sprintf("ctx?.%s?.get('%s-translation') == null", TRANSPILER_PREFIX, id)
+
+	ingestProcessors := []IngestProcessor{
+		EnrichProcessor{
+			PolicyName:    policy.Name,
+			Field:         toElasticPipelineSelector(source),
+			TargetField:   translation,
+			IgnoreMissing: pointer(true),
+		}.WithTag(id).WithDescription(fmt.Sprintf("Translate the field '%s' with the enrich policy '%s'", toElasticPipelineSelector(source), policy.Name)),
+		SetProcessor{
+			Field:    toElasticPipelineSelector(target),
+			CopyFrom: translation + ".value",
+			Override: pointer(override),
+		}.WithIf(pointer("!("+translationIsNull+")"), false).WithTag(fmt.Sprintf("%s-set", id)),
+	}
+	if fallback != nil {
+		ingestProcessors = append(ingestProcessors, SetProcessor{
+			Field:    toElasticPipelineSelector(target),
+			Value:    *fallback,
+			Override: pointer(override),
+		}.WithIf(pointer(fmt.Sprintf("%s && %s != null", translationIsNull, toElasticPipelineSelectorWithNullable(source, true))), false).WithTag(fmt.Sprintf("%s-fallback", id)))
+	}
+	ingestProcessors = append(ingestProcessors, RemoveProcessor{
+		Field:         &[]string{translation},
+		IgnoreMissing: true,
+	}.WithTag(fmt.Sprintf("%s-cleanup", id)))
+
+	return ingestProcessors
+}
@@ -0,0 +1,28 @@
+package app
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/herrBez/baffo/internal/app/untranspile"
+)
+
+func makeUntranspileCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:           "untranspile [pipeline.json ...]",
+		Short:         "convert Ingest Pipelines to the filter section of a Logstash configuration",
+		RunE:          runUntranspile,
+		SilenceErrors: true,
+	}
+
+	cmd.Flags().String("pipeline", "", "name of the pipeline to convert, defaults to the first (main) pipeline of the file")
+	cmd.Flags().String("log_level", "info", "determine the log_level")
+
+	return cmd
+}
+
+func runUntranspile(cmd *cobra.Command, args []string) error {
+	pipeline, _ := cmd.Flags().GetString("pipeline")
+	log_level, _ := cmd.Flags().GetString("log_level")
+	untranspile := untranspile.New(pipeline, log_level)
+	return untranspile.Run(args)
+}
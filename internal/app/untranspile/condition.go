@@ -0,0 +1,618 @@
+package untranspile
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	ast "github.com/herrBez/baffo/ast"
+)
+
+// Conversion of the `if` conditions of the processors into Logstash conditions.
+// Only the subset of Painless used for conditions is supported, i.e., the one generated by the
+// transpiler: field accesses (ctx.a.b, ctx?.a?.b, ctx['a'], ctx.getOrDefault('a', null)), literals,
+// comparisons, regular expressions, contains, containsKey, null checks, !, && and ||.
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenRegexp
+	tokenSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+var symbols = []string{"==~", "&&", "||", "==", "!=", "<=", ">=", "=~", "?.", "!", "<", ">", "(", ")", "[", "]", ".", ",", "-"}
+
+func tokenize(s string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'' || c == '"':
+			var value strings.Builder
+			j := i + 1
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				value.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, errors.Errorf("unterminated string at offset %d", i)
+			}
+			tokens = append(tokens, token{tokenString, value.String()})
+			i = j + 1
+		case c == '/' && len(tokens) > 0 && (tokens[len(tokens)-1].text == "=~" || tokens[len(tokens)-1].text == "==~"):
+			j := i + 1
+			for ; j < len(s) && s[j] != '/'; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+			}
+			if j >= len(s) {
+				return nil, errors.Errorf("unterminated regular expression at offset %d", i)
+			}
+			tokens = append(tokens, token{tokenRegexp, s[i+1 : j]})
+			i = j + 1
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{tokenNumber, s[i:j]})
+			i = j
+		case c == '_' || c == '@' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(s) && (s[j] == '_' || s[j] == '@' || s[j] >= 'a' && s[j] <= 'z' || s[j] >= 'A' && s[j] <= 'Z' || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, token{tokenIdent, s[i:j]})
+			i = j
+		default:
+			found := false
+			for _, symbol := range symbols {
+				if strings.HasPrefix(s[i:], symbol) {
+					tokens = append(tokens, token{tokenSymbol, symbol})
+					i += len(symbol)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, errors.Errorf("unexpected character %q at offset %d", c, i)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokenEOF}), nil
+}
+
+// The condition is parsed into the following nodes, before being converted into an ast.Condition
+
+type cond interface{}
+
+type orCond struct{ terms []cond }
+
+type andCond struct{ terms []cond }
+
+type notCond struct{ cond cond }
+
+// existsCond is true if the field is not null (X != null, containsKey)
+type existsCond struct{ path []string }
+
+type compareCond struct {
+	op          int
+	left, right operand
+}
+
+type regexpCond struct {
+	left   operand
+	regexp string
+}
+
+type containsCond struct {
+	list, value operand
+}
+
+// operand is either a field (path) or a literal (string, float64, bool, nil or []operand)
+type operand struct {
+	path    []string
+	literal interface{}
+	isPath  bool
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) accept(symbol string) bool {
+	if t := p.peek(); t.kind == tokenSymbol && t.text == symbol {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(symbol string) error {
+	if !p.accept(symbol) {
+		return errors.Errorf("expected %q, got %q", symbol, p.peek().text)
+	}
+	return nil
+}
+
+func parseCondition(s string) (cond, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	c, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, errors.Errorf("unexpected %q", p.peek().text)
+	}
+	return c, nil
+}
+
+func (p *parser) parseOr() (cond, error) {
+	c, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	terms := []cond{c}
+	for p.accept("||") {
+		c, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if or, ok := c.(orCond); ok {
+			terms = append(terms, or.terms...)
+		} else {
+			terms = append(terms, c)
+		}
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return orCond{terms}, nil
+}
+
+func (p *parser) parseAnd() (cond, error) {
+	terms := []cond{}
+	for {
+		c, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if and, ok := c.(andCond); ok {
+			terms = append(terms, and.terms...)
+		} else {
+			terms = append(terms, c)
+		}
+		if !p.accept("&&") {
+			break
+		}
+	}
+	terms = removeNullGuards(terms)
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return andCond{terms}, nil
+}
+
+func (p *parser) parseUnary() (cond, error) {
+	if p.accept("!") {
+		c, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if n, ok := c.(notCond); ok {
+			return n.cond, nil
+		}
+		return notCond{c}, nil
+	}
+	if p.accept("(") {
+		c, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	return p.parseComparison()
+}
+
+var compareOperators = map[string]int{
+	"==": ast.Equal,
+	"!=": ast.NotEqual,
+	"<=": ast.LessOrEqual,
+	">=": ast.GreaterOrEqual,
+	"<":  ast.LessThan,
+	">":  ast.GreaterThan,
+}
+
+func (p *parser) parseComparison() (cond, error) {
+	left, c, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if c != nil {
+		return c, nil
+	}
+
+	t := p.peek()
+	if t.kind == tokenSymbol && (t.text == "=~" || t.text == "==~") {
+		p.next()
+		re := p.next()
+		if re.kind != tokenRegexp {
+			return nil, errors.Errorf("expected a regular expression after %s", t.text)
+		}
+		if t.text == "==~" {
+			return regexpCond{left, "^(?:" + re.text + ")$"}, nil
+		}
+		return regexpCond{left, re.text}, nil
+	}
+
+	op, ok := compareOperators[t.text]
+	if t.kind != tokenSymbol || !ok {
+		if left.isPath {
+			return nil, errors.Errorf("field %s is used as a boolean", strings.Join(left.path, "."))
+		}
+		if b, ok := left.literal.(bool); ok {
+			return nil, errors.Errorf("boolean literal %t is not supported", b)
+		}
+		return nil, errors.Errorf("unexpected %q", t.text)
+	}
+	p.next()
+	right, c, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if c != nil {
+		return nil, errors.Errorf("a method call cannot be compared")
+	}
+
+	// Null checks are field (non) existence checks in Logstash
+	if right.literal == nil && !right.isPath && left.isPath && (op == ast.Equal || op == ast.NotEqual) {
+		if op == ast.Equal {
+			return notCond{existsCond{left.path}}, nil
+		}
+		return existsCond{left.path}, nil
+	}
+	return compareCond{op, left, right}, nil
+}
+
+// parseOperand parses a field, a literal or a list. Method calls that result in a boolean
+// (contains and containsKey) are returned as a condition.
+func (p *parser) parseOperand() (operand, cond, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString:
+		return operand{literal: t.text}, nil, nil
+	case tokenNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return operand{}, nil, err
+		}
+		return p.parseMethods(operand{literal: f})
+	case tokenIdent:
+		switch t.text {
+		case "true", "false":
+			return operand{literal: t.text == "true"}, nil, nil
+		case "null":
+			return operand{}, nil, nil
+		case "ctx":
+			return p.parseMethods(operand{path: []string{}, isPath: true})
+		}
+		return operand{}, nil, errors.Errorf("unknown identifier %q", t.text)
+	case tokenSymbol:
+		switch t.text {
+		case "-":
+			n := p.next()
+			if n.kind != tokenNumber {
+				return operand{}, nil, errors.Errorf("expected a number after -")
+			}
+			f, err := strconv.ParseFloat(n.text, 64)
+			return operand{literal: -f}, nil, err
+		case "[":
+			list := []operand{}
+			for !p.accept("]") {
+				if len(list) > 0 {
+					if err := p.expect(","); err != nil {
+						return operand{}, nil, err
+					}
+				}
+				value, c, err := p.parseOperand()
+				if err != nil {
+					return operand{}, nil, err
+				}
+				if c != nil || value.isPath {
+					return operand{}, nil, errors.Errorf("only literals are supported in lists")
+				}
+				list = append(list, value)
+			}
+			return p.parseMethods(operand{literal: list})
+		}
+	}
+	return operand{}, nil, errors.Errorf("unexpected %q", t.text)
+}
+
+// parseMethods parses the field accesses and the method calls following a value
+func (p *parser) parseMethods(o operand) (operand, cond, error) {
+	for {
+		switch {
+		case p.accept("."), p.accept("?."):
+			name := p.next()
+			if name.kind != tokenIdent {
+				return o, nil, errors.Errorf("expected a field or a method name, got %q", name.text)
+			}
+			if !p.accept("(") {
+				if !o.isPath {
+					return o, nil, errors.Errorf("field access %s on a literal", name.text)
+				}
+				o.path = append(o.path, name.text)
+				continue
+			}
+			args, err := p.parseArguments()
+			if err != nil {
+				return o, nil, err
+			}
+			switch {
+			case name.text == "contains" && len(args) == 1:
+				return o, containsCond{list: o, value: args[0]}, nil
+			case name.text == "containsKey" && len(args) == 1 && o.isPath && isString(args[0]):
+				return o, existsCond{append(o.path, args[0].literal.(string))}, nil
+			case name.text == "getOrDefault" && len(args) == 2 && o.isPath && isString(args[0]) && !args[1].isPath && args[1].literal == nil:
+				o.path = append(o.path, args[0].literal.(string))
+			default:
+				return o, nil, errors.Errorf("method %s with %d arguments is not supported", name.text, len(args))
+			}
+		case p.accept("["):
+			key, c, err := p.parseOperand()
+			if err != nil {
+				return o, nil, err
+			}
+			if c != nil || !o.isPath || !isString(key) {
+				return o, nil, errors.Errorf("only fields can be accessed with a string key")
+			}
+			if err := p.expect("]"); err != nil {
+				return o, nil, err
+			}
+			o.path = append(o.path, key.literal.(string))
+		default:
+			if o.isPath && len(o.path) == 0 {
+				return o, nil, errors.Errorf("ctx cannot be used without a field")
+			}
+			return o, nil, nil
+		}
+	}
+}
+
+func (p *parser) parseArguments() ([]operand, error) {
+	args := []operand{}
+	for !p.accept(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, c, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			return nil, errors.Errorf("a condition cannot be used as an argument")
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+func isString(o operand) bool {
+	_, ok := o.literal.(string)
+	return !o.isPath && ok
+}
+
+// references tells whether the operand is the field, or a sub-field, of path
+func references(o operand, path []string) bool {
+	if !o.isPath || len(o.path) < len(path) {
+		return false
+	}
+	for i := range path {
+		if o.path[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// removeNullGuards removes the null checks (e.g., ctx?.a != null) that guard an other expression on the same field
+// (or on one of its sub-fields), since Logstash conditions do not fail on missing fields
+func removeNullGuards(terms []cond) []cond {
+	uses := func(c cond, path []string) bool {
+		switch tc := c.(type) {
+		case existsCond:
+			return len(tc.path) > len(path) && references(operand{path: tc.path, isPath: true}, path)
+		case compareCond:
+			return references(tc.left, path) || references(tc.right, path)
+		case regexpCond:
+			return references(tc.left, path)
+		case containsCond:
+			return references(tc.list, path) || references(tc.value, path)
+		}
+		return false
+	}
+
+	result := []cond{}
+	for i, term := range terms {
+		if exists, ok := term.(existsCond); ok {
+			guard := false
+			for j, other := range terms {
+				if i != j && uses(other, exists.path) {
+					guard = true
+					break
+				}
+			}
+			if guard {
+				continue
+			}
+		}
+		result = append(result, term)
+	}
+	return result
+}
+
+// toCondition converts a parsed condition into a Logstash condition.
+// Nested groups of a different boolean operator are enclosed in parentheses.
+func toCondition(c cond) (ast.Condition, error) {
+	terms := []cond{c}
+	op := ast.NoOperator
+	switch tc := c.(type) {
+	case orCond:
+		terms, op = tc.terms, ast.Or
+	case andCond:
+		terms, op = tc.terms, ast.And
+	}
+
+	expressions := []ast.Expression{}
+	for i, term := range terms {
+		bo := ast.BooleanOperator{Op: op}
+		if i == 0 {
+			bo = ast.BooleanOperator{Op: ast.NoOperator}
+		}
+		expression, err := toExpression(term, bo)
+		if err != nil {
+			return ast.Condition{}, err
+		}
+		expressions = append(expressions, expression)
+	}
+	return ast.NewCondition(expressions...), nil
+}
+
+func toExpression(c cond, bo ast.BooleanOperator) (ast.Expression, error) {
+	switch tc := c.(type) {
+	case orCond, andCond:
+		inner, err := toCondition(tc)
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewConditionExpression(bo, inner), nil
+
+	case notCond:
+		switch inner := tc.cond.(type) {
+		case existsCond:
+			return ast.NewNegativeSelectorExpression(bo, toSelector(inner.path)), nil
+		case containsCond:
+			value, list, err := toRvalues(inner.value, inner.list)
+			if err != nil {
+				return nil, err
+			}
+			return ast.NewNotInExpression(bo, value, list), nil
+		case regexpCond:
+			left, _, err := toRvalues(inner.left, operand{})
+			if err != nil {
+				return nil, err
+			}
+			return ast.NewRegexpExpression(bo, left, ast.RegexpOperator{Op: ast.RegexpNotMatch}, ast.NewRegexp(inner.regexp)), nil
+		}
+		condition, err := toCondition(tc.cond)
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewNegativeConditionExpression(bo, condition), nil
+
+	case existsCond:
+		return ast.NewRvalueExpression(bo, toSelector(tc.path)), nil
+
+	case compareCond:
+		left, right, err := toRvalues(tc.left, tc.right)
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewCompareExpression(bo, left, ast.CompareOperator{Op: tc.op}, right), nil
+
+	case regexpCond:
+		left, _, err := toRvalues(tc.left, operand{})
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewRegexpExpression(bo, left, ast.RegexpOperator{Op: ast.RegexpMatch}, ast.NewRegexp(tc.regexp)), nil
+
+	case containsCond:
+		value, list, err := toRvalues(tc.value, tc.list)
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewInExpression(bo, value, list), nil
+	}
+	return nil, errors.Errorf("unexpected condition %T", c)
+}
+
+func toSelector(path []string) ast.Selector {
+	return ast.NewSelectorFromNames(path...)
+}
+
+// toRvalues converts the operands of an expression, a missing (zero) second operand is ignored
+func toRvalues(a, b operand) (ast.Rvalue, ast.Rvalue, error) {
+	left, err := toRvalue(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !b.isPath && b.literal == nil {
+		return left, nil, nil
+	}
+	right, err := toRvalue(b)
+	return left, right, err
+}
+
+func toRvalue(o operand) (ast.Rvalue, error) {
+	if o.isPath {
+		return toSelector(o.path), nil
+	}
+	switch v := o.literal.(type) {
+	case string:
+		return stringValue("", v), nil
+	case float64:
+		return ast.NewNumberAttribute("", v), nil
+	case []operand:
+		values := []ast.Attribute{}
+		for _, e := range v {
+			value, err := toRvalue(e)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value.(ast.Attribute))
+		}
+		return ast.NewArrayAttribute("", values...), nil
+	case nil:
+		return nil, errors.Errorf("null can only be compared with == or != to a field")
+	}
+	return nil, errors.Errorf("literal %v is not supported in Logstash conditions", o.literal)
+}
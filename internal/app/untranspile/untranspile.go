@@ -0,0 +1,605 @@
+// Package untranspile converts Elasticsearch Ingest Pipelines into the filter section of a Logstash configuration.
+package untranspile
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.elastic.co/ecszerolog"
+
+	ast "github.com/herrBez/baffo/ast"
+	"github.com/herrBez/baffo/internal/app/simulate"
+	"github.com/herrBez/baffo/internal/app/transpile"
+	"github.com/herrBez/baffo/internal/format"
+)
+
+type Untranspile struct {
+	pipeline  string
+	log_level zerolog.Level
+}
+
+func New(pipeline string, log_level string) Untranspile {
+	level, err := zerolog.ParseLevel(log_level)
+	if err != nil {
+		level = zerolog.InfoLevel
+	}
+	return Untranspile{
+		pipeline:  pipeline,
+		log_level: level,
+	}
+}
+
+func (u Untranspile) Run(args []string) error {
+	log.Logger = ecszerolog.New(os.Stderr)
+	zerolog.SetGlobalLevel(u.log_level)
+
+	var result *multierror.Error
+
+	for _, filename := range args {
+		ips, err := simulate.ReadPipelines(filename)
+		if err != nil {
+			result = multierror.Append(result, err)
+			continue
+		}
+
+		name := u.pipeline
+		if name == "" {
+			name = ips[0].Name
+		}
+		c, err := UntranspilePipeline(name, ips)
+		if err != nil {
+			result = multierror.Append(result, errors.Errorf("%s: %v", filename, err))
+			continue
+		}
+		fmt.Print(c.String())
+	}
+
+	if result != nil {
+		result.ErrorFormat = format.MultiErr
+		return result
+	}
+
+	return nil
+}
+
+// UntranspilePipeline returns a Logstash configuration, whose filter section corresponds to the pipeline name.
+// The pipelines called with a pipeline processor are inlined if they are part of ips.
+func UntranspilePipeline(name string, ips []transpile.IngestPipeline) (ast.Config, error) {
+	u := untranspiler{
+		pipelines: map[string]transpile.IngestPipeline{},
+		visiting:  map[string]bool{},
+		ids:       map[string]bool{},
+	}
+	for _, ip := range ips {
+		u.pipelines[ip.Name] = ip
+	}
+	ip, ok := u.pipelines[name]
+	if !ok {
+		return ast.Config{}, errors.Errorf("pipeline %s not found", name)
+	}
+
+	bops := u.pipeline(ip)
+	return ast.NewConfig(nil, []ast.PluginSection{ast.NewPluginSection(ast.Filter, bops...)}, nil), nil
+}
+
+type untranspiler struct {
+	pipelines map[string]transpile.IngestPipeline
+	// visiting contains the pipelines being untranspiled, to detect recursive pipeline processors
+	visiting map[string]bool
+	// ids contains the ids already used, ids must be unique in a Logstash configuration
+	ids map[string]bool
+}
+
+func (u untranspiler) pipeline(ip transpile.IngestPipeline) []ast.BranchOrPlugin {
+	u.visiting[ip.Name] = true
+	defer delete(u.visiting, ip.Name)
+
+	if len(ip.OnFailureProcessors) > 0 {
+		log.Warn().Msgf("[Pipeline %s] The on_failure processors of the pipeline are not supported", ip.Name)
+	}
+
+	bops := []ast.BranchOrPlugin{}
+	// lastIf is the condition of the last branch in bops, consecutive processors with the same condition share the branch
+	lastIf := ""
+	for _, p := range ip.Processors {
+		converted := u.processor(ip.Name, p)
+		if len(converted) == 0 {
+			continue
+		}
+
+		cf := p.(transpile.CF)
+		if cf.GetIf() == nil {
+			bops = append(bops, converted...)
+			lastIf = ""
+			continue
+		}
+
+		if *cf.GetIf() == lastIf {
+			branch := bops[len(bops)-1].(ast.Branch)
+			branch.IfBlock.Block = append(branch.IfBlock.Block, converted...)
+			bops[len(bops)-1] = branch
+			continue
+		}
+
+		condition, err := convertCondition(*cf.GetIf())
+		if err != nil {
+			log.Warn().Msgf("[Pipeline %s][Processor %s] The condition '%s' cannot be converted, the processor is skipped: %v", ip.Name, p.IngestProcessorType(), *cf.GetIf(), err)
+			continue
+		}
+		bops = append(bops, ast.NewBranch(ast.NewIfBlock(condition, converted...), ast.ElseBlock{}))
+		lastIf = *cf.GetIf()
+	}
+	return bops
+}
+
+// convertCondition converts the painless condition of a processor into a Logstash condition
+func convertCondition(s string) (ast.Condition, error) {
+	c, err := parseCondition(s)
+	if err != nil {
+		return ast.Condition{}, err
+	}
+	return toCondition(c)
+}
+
+// tagOnFailurePlugins are the plugins with the tag_on_failure option
+var tagOnFailurePlugins = []string{"mutate", "grok", "dissect", "kv", "json", "date", "geoip"}
+
+// processor returns the Logstash plugins corresponding to a processor, without its condition
+func (u untranspiler) processor(pipeline string, p transpile.IngestProcessor) []ast.BranchOrPlugin {
+	warn := func(format string, args ...interface{}) {
+		log.Warn().Msgf("[Pipeline %s][Processor %s] %s", pipeline, p.IngestProcessorType(), fmt.Sprintf(format, args...))
+	}
+
+	var bops []ast.BranchOrPlugin
+	switch tp := p.(type) {
+	case transpile.SetProcessor:
+		if tp.CopyFrom != "" {
+			bops = mutate(hash("copy", field(tp.CopyFrom), field(tp.Field)))
+			break
+		}
+		value, ok := scalarString(tp.Value)
+		if !ok {
+			warn("Only scalar values can be set, the processor is skipped")
+			return nil
+		}
+		if tp.Override != nil && !*tp.Override {
+			// the field is set only if it does not exist yet
+			bops = []ast.BranchOrPlugin{ast.NewBranch(
+				ast.NewIfBlock(
+					ast.NewCondition(ast.NewNegativeSelectorExpression(ast.BooleanOperator{Op: ast.NoOperator}, selector(tp.Field))),
+					mutate(hash("add_field", field(tp.Field), stringValue("", sprintf(value))))...,
+				),
+				ast.ElseBlock{},
+			)}
+			break
+		}
+		bops = mutate(hash("replace", field(tp.Field), stringValue("", sprintf(value))))
+
+	case transpile.AppendProcessor:
+		values := []ast.Attribute{}
+		for _, v := range tp.Value {
+			values = append(values, stringValue("", sprintf(v)))
+		}
+		if tp.Field == "tags" {
+			bops = mutate(ast.NewArrayAttribute("add_tag", values...))
+		} else if len(values) == 1 {
+			bops = mutate(hash("add_field", field(tp.Field), values[0]))
+		} else {
+			bops = mutate(hash("add_field", field(tp.Field), ast.NewArrayAttribute("", values...)))
+		}
+
+	case transpile.RemoveProcessor:
+		if len(tp.Keep) > 0 {
+			warn("Attribute 'keep' is currently not supported, the processor is skipped")
+			return nil
+		}
+		if tp.Field == nil {
+			return nil
+		}
+		fields := []ast.Attribute{}
+		for _, f := range *tp.Field {
+			fields = append(fields, stringValue("", field(f)))
+		}
+		bops = mutate(ast.NewArrayAttribute("remove_field", fields...))
+
+	case transpile.RenameProcessor:
+		bops = mutate(hash("rename", field(tp.Field), field(tp.TargetField)))
+
+	case transpile.CaseProcessor:
+		bops = withTargetField(tp.Field, tp.TargetField, func(f string) []ast.BranchOrPlugin {
+			return mutate(ast.NewArrayAttribute(tp.Type, stringValue("", field(f))))
+		})
+
+	case transpile.TrimProcessor:
+		bops = withTargetField(tp.Field, tp.TargetField, func(f string) []ast.BranchOrPlugin {
+			return mutate(ast.NewArrayAttribute("strip", stringValue("", field(f))))
+		})
+
+	case transpile.GsubProcessor:
+		bops = withTargetField(tp.Field, tp.TargetField, func(f string) []ast.BranchOrPlugin {
+			return mutate(ast.NewArrayAttribute("gsub",
+				stringValue("", field(f)),
+				stringValue("", tp.Pattern),
+				// Java references the groups with $1, Ruby with \1
+				stringValue("", regexp.MustCompile(`\$(\d)`).ReplaceAllString(tp.Replacement, `\$1`)),
+			))
+		})
+
+	case transpile.SplitProcessor:
+		separator, ok := literalRegexp(tp.Separator)
+		if !ok {
+			warn("The separator /%s/ is a regular expression, it is used as a string", tp.Separator)
+			separator = tp.Separator
+		}
+		bops = withTargetField(tp.Field, tp.TargetField, func(f string) []ast.BranchOrPlugin {
+			return mutate(hash("split", field(f), stringValue("", separator)))
+		})
+
+	case transpile.JoinProcessor:
+		bops = withTargetField(tp.Field, tp.TargetField, func(f string) []ast.BranchOrPlugin {
+			return mutate(hash("join", field(f), stringValue("", tp.Separator)))
+		})
+
+	case transpile.ConvertProcessor:
+		types := map[string]string{
+			"integer": "integer",
+			"long":    "integer",
+			"float":   "float",
+			"double":  "float",
+			"string":  "string",
+			"boolean": "boolean",
+		}
+		t, ok := types[tp.Type]
+		if !ok {
+			warn("The conversion to %s is currently not supported, the processor is skipped", tp.Type)
+			return nil
+		}
+		bops = withTargetField(tp.Field, tp.TargetField, func(f string) []ast.BranchOrPlugin {
+			return mutate(hash("convert", field(f), stringValue("", t)))
+		})
+
+	case transpile.GrokProcessor:
+		patterns := []ast.Attribute{}
+		for _, pattern := range tp.Patterns {
+			patterns = append(patterns, stringValue("", grokPattern(pattern)))
+		}
+		attributes := []ast.Attribute{hash("match", field(tp.Field), ast.NewArrayAttribute("", patterns...))}
+		if len(tp.PatternDefinitions) > 0 {
+			entries := []ast.HashEntry{}
+			for _, name := range sortedKeys(tp.PatternDefinitions) {
+				entries = append(entries, ast.NewHashEntry(stringValue("", name), stringValue("", tp.PatternDefinitions[name])))
+			}
+			attributes = append(attributes, ast.NewHashAttribute("pattern_definitions", entries...))
+		}
+		if tp.ECSCompatibility != "" {
+			attributes = append(attributes, stringValue("ecs_compatibility", tp.ECSCompatibility))
+		}
+		bops = plugin("grok", attributes...)
+
+	case transpile.DissectProcessor:
+		attributes := []ast.Attribute{hash("mapping", field(tp.Field), stringValue("", dissectPattern(tp.Pattern)))}
+		if tp.AppendSeparator != nil {
+			attributes = append(attributes, stringValue("append_separator", *tp.AppendSeparator))
+		}
+		bops = plugin("dissect", attributes...)
+
+	case transpile.KVProcessor:
+		attributes := []ast.Attribute{stringValue("source", field(tp.Field))}
+		for _, split := range []struct{ name, value string }{{"field_split", tp.FieldSplit}, {"value_split", tp.ValueSplit}} {
+			// the ingest splits are regular expressions, while the Logstash ones are sets of characters
+			if s, ok := literalRegexp(split.value); ok && len(s) == 1 {
+				attributes = append(attributes, stringValue(split.name, s))
+			} else {
+				attributes = append(attributes, stringValue(split.name+"_pattern", split.value))
+			}
+		}
+		if tp.TargetField != nil {
+			attributes = append(attributes, stringValue("target", field(*tp.TargetField)))
+		}
+		if len(tp.IncludeKeys) > 0 {
+			attributes = append(attributes, stringArray("include_keys", tp.IncludeKeys))
+		}
+		if len(tp.ExcludeKeys) > 0 {
+			attributes = append(attributes, stringArray("exclude_keys", tp.ExcludeKeys))
+		}
+		if tp.Prefix != nil {
+			attributes = append(attributes, stringValue("prefix", *tp.Prefix))
+		}
+		if tp.TrimKey != nil {
+			attributes = append(attributes, stringValue("trim_key", *tp.TrimKey))
+		}
+		if tp.TrimValue != nil {
+			attributes = append(attributes, stringValue("trim_value", *tp.TrimValue))
+		}
+		if tp.StripBrackets {
+			attributes = append(attributes, ast.NewStringAttribute("include_brackets", "false", ast.Bareword))
+		}
+		bops = plugin("kv", attributes...)
+
+	case transpile.JSONProcessor:
+		attributes := []ast.Attribute{stringValue("source", field(tp.Field))}
+		if !tp.AddToRoot {
+			target := tp.Field
+			if tp.TargetField != "" {
+				target = tp.TargetField
+			}
+			attributes = append(attributes, stringValue("target", field(target)))
+		}
+		bops = plugin("json", attributes...)
+
+	case transpile.CSVProcessor:
+		columns := []string{}
+		for _, f := range tp.TargetFields {
+			columns = append(columns, field(f))
+		}
+		attributes := []ast.Attribute{stringValue("source", field(tp.Field)), stringArray("columns", columns)}
+		if tp.Separator != nil {
+			attributes = append(attributes, stringValue("separator", *tp.Separator))
+		}
+		if tp.Quote != nil {
+			attributes = append(attributes, stringValue("quote_char", *tp.Quote))
+		}
+		if tp.Trim != nil || tp.EmptyValue != nil {
+			warn("Attributes 'trim' and 'empty_value' are currently not supported")
+		}
+		bops = plugin("csv", attributes...)
+
+	case transpile.DateProcessor:
+		attributes := []ast.Attribute{stringArray("match", append([]string{field(tp.Field)}, tp.Formats...))}
+		if tp.TargetField != nil {
+			attributes = append(attributes, stringValue("target", field(*tp.TargetField)))
+		}
+		if tp.Timezone != nil {
+			attributes = append(attributes, stringValue("timezone", sprintf(*tp.Timezone)))
+		}
+		if tp.Locale != nil {
+			attributes = append(attributes, stringValue("locale", sprintf(*tp.Locale)))
+		}
+		if tp.OutputFormat != nil {
+			warn("Attribute 'output_format' is currently not supported")
+		}
+		bops = plugin("date", attributes...)
+
+	case transpile.DropProcessor:
+		bops = plugin("drop")
+
+	case transpile.URLDecodeProcessor:
+		bops = withTargetField(tp.Field, tp.TargetField, func(f string) []ast.BranchOrPlugin {
+			return plugin("urldecode", stringValue("field", field(f)))
+		})
+
+	case transpile.UserAgentProcessor:
+		target := "user_agent"
+		if tp.TargetField != nil {
+			target = *tp.TargetField
+		}
+		bops = plugin("useragent", stringValue("source", field(tp.Field)), stringValue("target", field(target)))
+
+	case transpile.GeoIPProcessor:
+		target := "geoip"
+		if tp.TargetField != nil {
+			target = *tp.TargetField
+		}
+		bops = plugin("geoip", stringValue("source", field(tp.Field)), stringValue("target", field(target)))
+
+	case transpile.PipelineProcessor:
+		called, ok := u.pipelines[tp.Name]
+		if !ok {
+			warn("Pipeline %s is not defined in the file, the processor is skipped", tp.Name)
+			return nil
+		}
+		if u.visiting[tp.Name] {
+			warn("Pipeline %s is called recursively, the processor is skipped", tp.Name)
+			return nil
+		}
+		return u.pipeline(called)
+
+	default:
+		warn("Processor is currently not supported, the processor is skipped")
+		return nil
+	}
+
+	u.commonFields(pipeline, p, bops)
+	return bops
+}
+
+// commonFields adds the id (tag) and the tag_on_failure (on_failure) to the plugin converted from p
+func (u untranspiler) commonFields(pipeline string, p transpile.IngestProcessor, bops []ast.BranchOrPlugin) {
+	cf := p.(transpile.CF)
+	updateLastPlugin(bops, func(pl *ast.Plugin) {
+		if tag := cf.GetTag(); tag != nil && *tag != "" {
+			if u.ids[*tag] {
+				log.Warn().Msgf("[Pipeline %s][Processor %s] The tag '%s' is used more than once, only its first occurrence is used as id", pipeline, p.IngestProcessorType(), *tag)
+			} else {
+				u.ids[*tag] = true
+				pl.Attributes = append(pl.Attributes, stringValue("id", *tag))
+			}
+		}
+
+		// Only the on_failure processors adding tags are supported, they correspond to the tag_on_failure attribute
+		tags := []string{}
+		for _, onFailure := range cf.GetOnFailure() {
+			switch tp := onFailure.(type) {
+			case transpile.AppendProcessor:
+				if tp.Field == "tags" {
+					tags = append(tags, tp.Value...)
+					continue
+				}
+			case transpile.SetProcessor:
+				// error messages added by the transpiler
+				if strings.HasPrefix(tp.Field, "_ingest") || strings.HasPrefix(tp.Field, "_TRANSPILER") {
+					continue
+				}
+			}
+			log.Warn().Msgf("[Pipeline %s][Processor %s] The on_failure processor %s is currently not supported", pipeline, p.IngestProcessorType(), onFailure.IngestProcessorType())
+		}
+		if len(tags) == 0 {
+			return
+		}
+		if !transpile.Contains(tagOnFailurePlugins, pl.Name()) {
+			log.Warn().Msgf("[Pipeline %s][Processor %s] Plugin %s has no tag_on_failure, the tags %s are not added on failure", pipeline, p.IngestProcessorType(), pl.Name(), strings.Join(tags, ", "))
+			return
+		}
+		pl.Attributes = append(pl.Attributes, stringArray("tag_on_failure", tags))
+	})
+}
+
+// updateLastPlugin updates the last plugin, i.e., the one doing the conversion, e.g., in a branch
+// or after the copy of the source field to the target field
+func updateLastPlugin(bops []ast.BranchOrPlugin, update func(*ast.Plugin)) {
+	if len(bops) == 0 {
+		return
+	}
+	switch bop := bops[len(bops)-1].(type) {
+	case ast.Plugin:
+		update(&bop)
+		bops[len(bops)-1] = bop
+	case ast.Branch:
+		updateLastPlugin(bop.IfBlock.Block, update)
+	}
+}
+
+func plugin(name string, attributes ...ast.Attribute) []ast.BranchOrPlugin {
+	return []ast.BranchOrPlugin{ast.NewPlugin(name, attributes...)}
+}
+
+func mutate(attributes ...ast.Attribute) []ast.BranchOrPlugin {
+	return plugin("mutate", attributes...)
+}
+
+// withTargetField converts a processor working in place (apply) on the target field,
+// after having copied the source field to it
+func withTargetField(source string, target *string, apply func(string) []ast.BranchOrPlugin) []ast.BranchOrPlugin {
+	if target == nil || *target == source {
+		return apply(source)
+	}
+	return append(mutate(hash("copy", field(source), field(*target))), apply(*target)...)
+}
+
+// hash returns a hash attribute with a single entry
+func hash(name string, key string, value interface{}) ast.HashAttribute {
+	var attr ast.Attribute
+	switch v := value.(type) {
+	case string:
+		attr = stringValue("", v)
+	case ast.Attribute:
+		attr = v
+	}
+	return ast.NewHashAttribute(name, ast.NewHashEntry(stringValue("", key), attr))
+}
+
+func stringArray(name string, values []string) ast.ArrayAttribute {
+	attributes := []ast.Attribute{}
+	for _, v := range values {
+		attributes = append(attributes, stringValue("", v))
+	}
+	return ast.NewArrayAttribute(name, attributes...)
+}
+
+// stringValue returns a double quoted string attribute, single quoted if the value contains double quotes
+func stringValue(name string, value string) ast.StringAttribute {
+	if strings.Contains(value, `"`) && !strings.Contains(value, `'`) {
+		return ast.NewStringAttribute(name, value, ast.SingleQuoted)
+	}
+	return ast.NewStringAttribute(name, strings.ReplaceAll(value, `"`, `\"`), ast.DoubleQuoted)
+}
+
+// field converts an ingest field (e.g., a.b) into a Logstash field reference (e.g., [a][b])
+func field(f string) string {
+	if !strings.Contains(f, ".") {
+		return f
+	}
+	return "[" + strings.ReplaceAll(f, ".", "][") + "]"
+}
+
+func selector(f string) ast.Selector {
+	return ast.NewSelectorFromNames(strings.Split(f, ".")...)
+}
+
+var mustacheRegexp = regexp.MustCompile(`\{\{\{?\s*([^{}\s]+)\s*\}?\}\}`)
+
+// sprintf converts the mustache templates (e.g., {{{a.b}}}) into sprintf references (e.g., %{[a][b]})
+func sprintf(s string) string {
+	return mustacheRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		name := mustacheRegexp.FindStringSubmatch(m)[1]
+		if strings.Contains(name, ".") {
+			return "%{" + field(name) + "}"
+		}
+		return "%{" + name + "}"
+	})
+}
+
+var grokSemanticRegexp = regexp.MustCompile(`%\{(\w+):([^:}]+)(?::(\w+))?\}`)
+
+// grokPattern converts the nested semantics of a grok pattern (e.g., %{WORD:a.b}) into field references
+// (e.g., %{WORD:[a][b]}), as well as the types that are not supported by Logstash
+func grokPattern(s string) string {
+	types := map[string]string{"long": "int", "double": "float"}
+	return grokSemanticRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		parts := grokSemanticRegexp.FindStringSubmatch(m)
+		t := parts[3]
+		if converted, ok := types[t]; ok {
+			t = converted
+		}
+		if t != "" {
+			t = ":" + t
+		}
+		return "%{" + parts[1] + ":" + field(parts[2]) + t + "}"
+	})
+}
+
+var dissectKeyRegexp = regexp.MustCompile(`%\{([+?*&]?)([^}]*?)((?:->)?(?:/\d+)?)\}`)
+
+// dissectPattern converts the nested keys of a dissect pattern (e.g., %{a.b}) into field references (e.g., %{[a][b]})
+func dissectPattern(s string) string {
+	return dissectKeyRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		parts := dissectKeyRegexp.FindStringSubmatch(m)
+		return "%{" + parts[1] + field(parts[2]) + parts[3] + "}"
+	})
+}
+
+// literalRegexp returns the string matched by a regular expression without special characters,
+// e.g., \| or a simple character
+func literalRegexp(re string) (string, bool) {
+	var s strings.Builder
+	for i := 0; i < len(re); i++ {
+		c := re[i]
+		if c == '\\' && i+1 < len(re) && strings.ContainsRune(`\.+*?()|[]{}^$/`, rune(re[i+1])) {
+			s.WriteByte(re[i+1])
+			i++
+			continue
+		}
+		if strings.ContainsRune(`\.+*?()|[]{}^$`, rune(c)) {
+			return "", false
+		}
+		s.WriteByte(c)
+	}
+	return s.String(), true
+}
+
+// scalarString returns the string representation of a scalar value
+func scalarString(v interface{}) (string, bool) {
+	switch tv := v.(type) {
+	case string:
+		return tv, true
+	case float64, bool, int:
+		return fmt.Sprint(tv), true
+	}
+	return "", false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
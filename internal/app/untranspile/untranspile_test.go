@@ -0,0 +1,144 @@
+package untranspile
+
+import (
+	"testing"
+
+	config "github.com/herrBez/baffo"
+	ast "github.com/herrBez/baffo/ast"
+	"github.com/herrBez/baffo/internal/app/transpile"
+)
+
+// formatFilter parses and formats a Logstash filter section, so that the expected configurations can be written freely
+func formatFilter(t *testing.T, filter string) string {
+	t.Helper()
+	res, err := config.Parse("test.conf", []byte("filter { "+filter+" }"))
+	if err != nil {
+		t.Fatalf("could not parse %s: %v", filter, err)
+	}
+	return res.(ast.Config).String()
+}
+
+func TestUntranspilePipeline(t *testing.T) {
+	tt := []struct {
+		name     string
+		pipeline string
+		want     string
+	}{
+		{
+			name:     "set, append, remove and rename",
+			pipeline: `{"processors": [{"set": {"field": "a.b", "value": "{{{c.d}}}-x", "tag": "s"}}, {"set": {"field": "e", "value": 1, "override": false}}, {"set": {"field": "f", "copy_from": "g"}}, {"append": {"field": "tags", "value": ["t1", "t2"]}}, {"append": {"field": "h", "value": "v"}}, {"remove": {"field": ["i", "j.k"]}}, {"rename": {"field": "l", "target_field": "m.n"}}]}`,
+			want: `mutate { replace => { "[a][b]" => "%{[c][d]}-x" } id => "s" }
+				if ![e] { mutate { add_field => { "e" => "1" } } }
+				mutate { copy => { "g" => "f" } }
+				mutate { add_tag => ["t1", "t2"] }
+				mutate { add_field => { "h" => "v" } }
+				mutate { remove_field => ["i", "[j][k]"] }
+				mutate { rename => { "l" => "[m][n]" } }`,
+		},
+		{
+			name:     "in place and target_field",
+			pipeline: `{"processors": [{"lowercase": {"field": "a"}}, {"uppercase": {"field": "a", "target_field": "b"}}, {"gsub": {"field": "c", "pattern": "(x)y", "replacement": "$1-"}}, {"split": {"field": "d", "separator": "\\|"}}, {"convert": {"field": "e", "type": "long"}}]}`,
+			want: `mutate { lowercase => ["a"] }
+				mutate { copy => { "a" => "b" } }
+				mutate { uppercase => ["b"] }
+				mutate { gsub => ["c", "(x)y", "\1-"] }
+				mutate { split => { "d" => "|" } }
+				mutate { convert => { "e" => "integer" } }`,
+		},
+		{
+			name:     "parsers",
+			pipeline: `{"processors": [{"grok": {"field": "message", "patterns": ["%{WORD:a.b} %{NUMBER:c:long}"], "tag": "g", "on_failure": [{"append": {"field": "tags", "value": ["_grokparsefailure"]}}]}}, {"dissect": {"field": "message", "pattern": "%{d.e} %{+d.e}"}}, {"kv": {"field": "f", "field_split": "&", "value_split": "=", "target_field": "g"}}, {"date": {"field": "h", "formats": ["ISO8601"], "timezone": "{{tz}}"}}]}`,
+			want: `grok { match => { "message" => ["%{WORD:[a][b]} %{NUMBER:c:int}"] } id => "g" tag_on_failure => ["_grokparsefailure"] }
+				dissect { mapping => { "message" => "%{[d][e]} %{+[d][e]}" } }
+				kv { source => "f" field_split => "&" value_split => "=" target => "g" }
+				date { match => ["h", "ISO8601"] timezone => "%{tz}" }`,
+		},
+		{
+			name:     "conditions share the branch of consecutive processors",
+			pipeline: `{"processors": [{"set": {"field": "a", "value": "x", "if": "ctx?.b != null && ctx.b == 'y'"}}, {"drop": {"if": "ctx?.b != null && ctx.b == 'y'"}}, {"drop": {"if": "ctx?.tags.contains('t')"}}, {"drop": {"if": "['x', 'y'].contains(ctx.a)"}}]}`,
+			want: `if [b] == "y" { mutate { replace => { "a" => "x" } } drop {} }
+				if "t" in [tags] { drop {} }
+				if [a] in ["x", "y"] { drop {} }`,
+		},
+		{
+			name:     "pipelines are inlined and unsupported processors skipped",
+			pipeline: `{"main-pipeline-test": {"processors": [{"pipeline": {"name": "child", "if": "ctx.a == 1"}}, {"script": {"source": "ctx.x = 1"}}]}, "child": {"processors": [{"drop": {}}]}}`,
+			want:     `if [a] == 1 { drop {} }`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ips, err := transpile.DecodeIngestPipelines("test", []byte(tc.pipeline))
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, err := UntranspilePipeline(ips[0].Name, ips)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := c.String()
+			want := formatFilter(t, tc.want)
+			if got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestConvertCondition(t *testing.T) {
+	tt := []struct {
+		painless string
+		want     string
+		err      bool
+	}{
+		{painless: `ctx?.a?.b != null`, want: `[a][b]`},
+		{painless: `ctx?.a == null`, want: `![a]`},
+		{painless: `(ctx?.a?.b != null && ctx.a.b == "x") && (ctx?.c != null && ctx.c > 3)`, want: `[a][b] == "x" and [c] > 3`},
+		{painless: `ctx.a == 'x' && (ctx.b == 'y' || ctx.c != 'z')`, want: `[a] == "x" and ([b] == "y" or [c] != "z")`},
+		{painless: `ctx?.m != null && ctx.m =~ /^x\d/`, want: `[m] =~ /^x\d/`},
+		{painless: `!(ctx?.tags.contains("t"))`, want: `"t" not in [tags]`},
+		{painless: `!(ctx.a == 'x' || ctx.b == 'y')`, want: `!([a] == "x" or [b] == "y")`},
+		{painless: `ctx.getOrDefault('@metadata', null)?.input != null`, want: `[@metadata][input]`},
+		{painless: `ctx?.a != null && ctx?.a.containsKey('b')`, want: `[a][b]`},
+		{painless: `ctx.a`, err: true},
+		{painless: `ctx.a.size() > 1`, err: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.painless, func(t *testing.T) {
+			got, err := convertCondition(tc.painless)
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != tc.want {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestRoundTrip untranspiles the output of the transpiler and checks that the conditions are kept
+func TestRoundTrip(t *testing.T) {
+	filter := `if [a][b] == "x" and ([n] > 3 or "t" in [tags]) { drop { id => "d" } }`
+	res, err := config.Parse("test.conf", []byte("filter { "+filter+" }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ips := transpile.New(transpile.Options{Threshold: 1, LogLevel: "error"}).BuildIngestPipelines("test.conf", res.(ast.Config))
+
+	c, err := UntranspilePipeline(ips[0].Name, ips)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.String(), formatFilter(t, filter); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,156 @@
+package verify
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/herrBez/baffo/internal/app/evaluate"
+	"github.com/herrBez/baffo/internal/app/simulate"
+	"github.com/herrBez/baffo/internal/app/transpile"
+)
+
+// Kinds of differences between the Logstash and the Ingest Pipeline results
+const (
+	MissingInIngest = "missing_in_ingest"
+	OnlyInIngest    = "only_in_ingest"
+	DifferentValue  = "different_value"
+	DifferentDrop   = "different_drop"
+	IngestFailure   = "ingest_failure"
+)
+
+// Difference is a field-level difference between the event produced by Logstash and the one produced by the Ingest Pipelines
+type Difference struct {
+	Field    string      `json:"field,omitempty"`
+	Kind     string      `json:"kind"`
+	Logstash interface{} `json:"logstash,omitempty"`
+	Ingest   interface{} `json:"ingest,omitempty"`
+}
+
+// Report is the outcome of the verification of a single event
+type Report struct {
+	File            string           `json:"file"`
+	Event           int              `json:"event"`
+	Equivalent      bool             `json:"equivalent"`
+	Inconclusive    bool             `json:"inconclusive,omitempty"`
+	Differences     []Difference     `json:"differences,omitempty"`
+	LogstashSkipped []evaluate.Trace `json:"logstash_skipped_plugins,omitempty"`
+	IngestSkipped   []simulate.Trace `json:"ingest_skipped_processors,omitempty"`
+}
+
+// compare builds the report of an event from the result of the Logstash filters and the one of the Ingest Pipelines
+func compare(logstash evaluate.Result, ingest simulate.Result) Report {
+	report := Report{
+		LogstashSkipped: logstash.Skipped,
+		IngestSkipped:   ingest.Skipped,
+	}
+
+	switch {
+	case ingest.Error != nil:
+		report.Differences = append(report.Differences, Difference{Kind: IngestFailure, Ingest: ingest.Error})
+	case logstash.Dropped != ingest.Dropped:
+		report.Differences = append(report.Differences, Difference{Kind: DifferentDrop, Logstash: logstash.Dropped, Ingest: ingest.Dropped})
+	case !logstash.Dropped:
+		report.Differences = diff(
+			flatten(normalize(logstash.Event, "@metadata")),
+			flatten(normalize(ingest.Doc, append([]string{transpile.TRANSPILER_PREFIX, "@metadata"}, simulate.MetadataFields...)...)),
+		)
+	}
+
+	// Plugins or processors that could not be executed make the comparison inconclusive, their differences are expected
+	report.Inconclusive = len(report.LogstashSkipped) > 0 || len(report.IngestSkipped) > 0
+	report.Equivalent = len(report.Differences) == 0 && !report.Inconclusive
+	return report
+}
+
+// normalize removes the top-level fields that are not part of the output and converts the
+// values to their JSON representation, so that numbers of both evaluators compare equal
+func normalize(doc map[string]interface{}, ignored ...string) map[string]interface{} {
+	copied := map[string]interface{}{}
+	for k, v := range doc {
+		copied[k] = v
+	}
+	for _, field := range ignored {
+		delete(copied, field)
+	}
+
+	normalized := map[string]interface{}{}
+	buf, err := json.Marshal(copied)
+	if err != nil {
+		return copied
+	}
+	_ = json.Unmarshal(buf, &normalized)
+	return normalized
+}
+
+// flatten maps each leaf of doc to its Logstash field reference (e.g., [foo][bar]).
+// Arrays and empty objects are leaves.
+func flatten(doc map[string]interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	var walk func(prefix string, m map[string]interface{})
+	walk = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			reference := prefix + "[" + k + "]"
+			if child, ok := v.(map[string]interface{}); ok && len(child) > 0 {
+				walk(reference, child)
+				continue
+			}
+			fields[reference] = v
+		}
+	}
+	walk("", doc)
+	return fields
+}
+
+func diff(logstash, ingest map[string]interface{}) []Difference {
+	references := []string{}
+	for reference := range logstash {
+		references = append(references, reference)
+	}
+	for reference := range ingest {
+		if _, ok := logstash[reference]; !ok {
+			references = append(references, reference)
+		}
+	}
+	sort.Strings(references)
+
+	differences := []Difference{}
+	for _, reference := range references {
+		l, inLogstash := logstash[reference]
+		i, inIngest := ingest[reference]
+		switch {
+		case !inIngest:
+			differences = append(differences, Difference{Field: reference, Kind: MissingInIngest, Logstash: l})
+		case !inLogstash:
+			differences = append(differences, Difference{Field: reference, Kind: OnlyInIngest, Ingest: i})
+		case !reflect.DeepEqual(l, i):
+			differences = append(differences, Difference{Field: reference, Kind: DifferentValue, Logstash: l, Ingest: i})
+		}
+	}
+	return differences
+}
+
+func (d Difference) String() string {
+	switch d.Kind {
+	case MissingInIngest:
+		return d.Field + ": missing in the ingest pipeline output (logstash: " + jsonString(d.Logstash) + ")"
+	case OnlyInIngest:
+		return d.Field + ": only in the ingest pipeline output (ingest: " + jsonString(d.Ingest) + ")"
+	case DifferentValue:
+		return d.Field + ": different value (logstash: " + jsonString(d.Logstash) + ", ingest: " + jsonString(d.Ingest) + ")"
+	case DifferentDrop:
+		return "event dropped differently (logstash: " + jsonString(d.Logstash) + ", ingest: " + jsonString(d.Ingest) + ")"
+	case IngestFailure:
+		return "the ingest pipeline failed: " + jsonString(d.Ingest)
+	}
+	return d.Kind
+}
+
+func jsonString(v interface{}) string {
+	buf, err := transpile.MyJsonEncode(v)
+	if err != nil {
+		return "?"
+	}
+	return strings.TrimSuffix(string(buf), "\n")
+}
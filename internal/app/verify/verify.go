@@ -0,0 +1,144 @@
+// Package verify compares, event by event, the result of the filters of a Logstash configuration
+// with the one of the Ingest Pipelines generated by the transpiler.
+package verify
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+
+	config "github.com/herrBez/baffo"
+	ast "github.com/herrBez/baffo/ast"
+	"github.com/herrBez/baffo/internal/app/evaluate"
+	"github.com/herrBez/baffo/internal/app/simulate"
+	"github.com/herrBez/baffo/internal/app/transpile"
+	"github.com/herrBez/baffo/internal/format"
+)
+
+type Verify struct {
+	transpile transpile.Transpile
+	events    string
+	format    string
+}
+
+func New(t transpile.Transpile, events string, format string) Verify {
+	return Verify{
+		transpile: t,
+		events:    events,
+		format:    format,
+	}
+}
+
+// VerifyFile transpiles the configuration and compares the results of the Logstash filters and of the
+// Ingest Pipelines on each event
+func (v Verify) VerifyFile(filename string, tree ast.Config, events []simulate.Document) []Report {
+	ips := v.transpile.BuildIngestPipelines(filename, tree)
+	evaluator := evaluate.NewEvaluator(tree)
+	simulator := simulate.NewSimulator(ips)
+
+	reports := []Report{}
+	for i, event := range events {
+		report := compare(
+			evaluator.Evaluate(evaluate.Event(event)),
+			simulator.Simulate(ips[0].Name, event),
+		)
+		report.File = filename
+		report.Event = i + 1
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+func (v Verify) Run(args []string) error {
+	v.transpile.InitLogger()
+
+	var result *multierror.Error
+
+	switch v.format {
+	case "text", "json":
+	default:
+		return errors.Errorf("unknown verify format %q, expected text or json", v.format)
+	}
+
+	events, err := simulate.ReadDocuments(v.events)
+	if err != nil {
+		return err
+	}
+
+	reports := []Report{}
+	for _, filename := range args {
+		stat, err := os.Stat(filename)
+		if err != nil {
+			result = multierror.Append(result, errors.Errorf("%s: %v", filename, err))
+			continue
+		}
+		if stat.IsDir() {
+			continue
+		}
+
+		res, err := config.ParseFile(filename, config.IgnoreComments(true))
+		if err != nil {
+			result = multierror.Append(result, errors.Errorf("%s: %v", filename, err))
+			continue
+		}
+
+		reports = append(reports, v.VerifyFile(filename, res.(ast.Config), events)...)
+	}
+
+	if v.format == "json" {
+		buf, err := transpile.MyJsonEncode(map[string]interface{}{"events": reports})
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(buf))
+	} else {
+		fmt.Print(textReport(reports))
+	}
+
+	different := 0
+	for _, report := range reports {
+		if !report.Equivalent && !report.Inconclusive {
+			different++
+		}
+	}
+	if different > 0 {
+		result = multierror.Append(result, errors.Errorf("%d of %d events are not equivalent", different, len(reports)))
+	}
+
+	if result != nil {
+		result.ErrorFormat = format.MultiErr
+		return result
+	}
+
+	return nil
+}
+
+func textReport(reports []Report) string {
+	var s strings.Builder
+	equivalent, inconclusive := 0, 0
+	for _, report := range reports {
+		if report.Equivalent {
+			equivalent++
+			fmt.Fprintf(&s, "%s event %d: equivalent\n", report.File, report.Event)
+		} else if report.Inconclusive {
+			inconclusive++
+			fmt.Fprintf(&s, "%s event %d: inconclusive, %d differences\n", report.File, report.Event, len(report.Differences))
+		} else {
+			fmt.Fprintf(&s, "%s event %d: %d differences\n", report.File, report.Event, len(report.Differences))
+		}
+		for _, d := range report.Differences {
+			fmt.Fprintf(&s, "  %s\n", d)
+		}
+		for _, trace := range report.LogstashSkipped {
+			fmt.Fprintf(&s, "  not evaluated in Logstash [Pos %s][Plugin %s]: %s\n", trace.Pos, trace.Plugin, trace.Message)
+		}
+		for _, trace := range report.IngestSkipped {
+			fmt.Fprintf(&s, "  not simulated in the ingest pipeline [Pipeline %s][Processor %s]: %s\n", trace.Pipeline, trace.ProcessorType, trace.Message)
+		}
+	}
+	fmt.Fprintf(&s, "%d of %d events are equivalent, %d are inconclusive\n", equivalent, len(reports), inconclusive)
+	return s.String()
+}
@@ -0,0 +1,104 @@
+package verify
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	config "github.com/herrBez/baffo"
+	ast "github.com/herrBez/baffo/ast"
+	"github.com/herrBez/baffo/internal/app/simulate"
+	"github.com/herrBez/baffo/internal/app/transpile"
+)
+
+func TestVerifyFile(t *testing.T) {
+	tt := []struct {
+		name   string
+		filter string
+		event  string
+		want   string
+	}{
+		{
+			name:   "equivalent",
+			filter: `mutate { rename => { "a" => "[b][c]" } lowercase => ["d"] add_tag => ["t"] }`,
+			event:  `{"a": 1, "d": "X"}`,
+			want:   `{"file": "test.conf", "event": 1, "equivalent": true}`,
+		},
+		{
+			name:   "equivalent conditions and drop",
+			filter: `if [a] == "x" { drop {} } else { mutate { add_field => { "[@metadata][m]" => "1" "b" => "%{a}" } } }`,
+			event:  `{"a": "y"}`,
+			want:   `{"file": "test.conf", "event": 1, "equivalent": true}`,
+		},
+		{
+			name:   "equivalent merge",
+			filter: `mutate { merge => { "d" => "s" "l" => "s" "e" => "missing" } }`,
+			event:  `{"s": "hello", "l": ["a"], "e": "x"}`,
+			want:   `{"file": "test.conf", "event": 1, "equivalent": true}`,
+		},
+		{
+			name:   "equivalent boolean conversion of an empty string",
+			filter: `mutate { convert => { "b" => "boolean" } }`,
+			event:  `{"b": ""}`,
+			want:   `{"file": "test.conf", "event": 1, "equivalent": true}`,
+		},
+		{
+			name:   "field differences",
+			filter: `kv { source => "m" }`,
+			event:  `{"a": 1}`,
+			want:   `{"file": "test.conf", "event": 1, "equivalent": false, "differences": [{"field": "[tags]", "kind": "only_in_ingest", "ingest": ["_kv_filter_error"]}]}`,
+		},
+		{
+			name:   "differences caused by a plugin that is not evaluated are inconclusive",
+			filter: `date { match => ["ts", "ISO8601"] }`,
+			event:  `{"ts": "2024-01-01T00:00:00Z"}`,
+			want:   `{"file": "test.conf", "event": 1, "equivalent": false, "inconclusive": true, "differences": [{"field": "[@timestamp]", "kind": "only_in_ingest", "ingest": "2024-01-01T00:00:00.000Z"}], "logstash_skipped_plugins": [{"pos": "1:10 [9]", "plugin": "date", "message": "filter date is not supported by the evaluator"}]}`,
+		},
+		{
+			name:   "plugins that are not evaluated are reported",
+			filter: `grok { id => "g" match => { "message" => "%{WORD:w}" } }`,
+			event:  `{"message": "x"}`,
+			want:   `{"file": "test.conf", "event": 1, "equivalent": false, "inconclusive": true, "logstash_skipped_plugins": [{"pos": "1:10 [9]", "plugin": "grok", "message": "filter grok is not supported by the evaluator"}], "ingest_skipped_processors": [{"pipeline": "main-pipeline-test", "processor_type": "grok", "processor_tag": "g", "message": "processor [grok] is not supported by the simulator"}]}`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := config.Parse("test.conf", []byte("filter { "+tc.filter+" }"))
+			if err != nil {
+				t.Fatalf("could not parse the filter: %v", err)
+			}
+			var event simulate.Document
+			if err := json.Unmarshal([]byte(tc.event), &event); err != nil {
+				t.Fatal(err)
+			}
+
+			v := New(transpile.New(transpile.Options{Threshold: 1, LogLevel: "error", DealWithErrorLocally: true, Fidelity: true, AddCleanupProcessor: true}), "", "text")
+			reports := v.VerifyFile("test.conf", res.(ast.Config), []simulate.Document{event})
+
+			got, _ := json.Marshal(reports[0])
+			var gotValue, wantValue interface{}
+			_ = json.Unmarshal(got, &gotValue)
+			if err := json.Unmarshal([]byte(tc.want), &wantValue); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotValue, wantValue) {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTextReport(t *testing.T) {
+	reports := []Report{
+		{File: "a.conf", Event: 1, Equivalent: true},
+		{File: "a.conf", Event: 2, Inconclusive: true, Differences: []Difference{{Field: "[x]", Kind: OnlyInIngest, Ingest: 1}}},
+	}
+	want := "a.conf event 1: equivalent\n" +
+		"a.conf event 2: inconclusive, 1 differences\n" +
+		"  [x]: only in the ingest pipeline output (ingest: 1)\n" +
+		"1 of 2 events are equivalent, 1 are inconclusive\n"
+	if got := textReport(reports); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,37 @@
+// Package csvline splits a single CSV line with a custom separator and quote character, as done by the
+// Logstash csv filter and the Elasticsearch csv processor.
+package csvline
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Split splits line into its fields. Doubled quote characters within a quoted field are unescaped.
+func Split(line string, separator, quote rune) ([]string, error) {
+	fields := []string{}
+	var current strings.Builder
+	inQuotes := false
+	runes := []rune(line)
+
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case inQuotes && c == quote && i+1 < len(runes) && runes[i+1] == quote:
+			current.WriteRune(quote)
+			i++
+		case c == quote:
+			inQuotes = !inQuotes
+		case !inQuotes && c == separator:
+			fields = append(fields, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(c)
+		}
+	}
+	if inQuotes {
+		return nil, errors.Errorf("Unmatched quote")
+	}
+	return append(fields, current.String()), nil
+}
@@ -0,0 +1,162 @@
+// Package dissect implements the dissect pattern language shared by the Logstash dissect filter and
+// the Elasticsearch dissect processor.
+package dissect
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type key struct {
+	name           string
+	skip           bool // %{} and %{?name}
+	appendTo       bool // %{+name} and %{+name/N}
+	order          int
+	referenceKey   bool // %{*name}
+	referenceValue bool // %{&name}
+	rightPadding   bool // %{name->}
+}
+
+// Dissector is a parsed dissect pattern
+type Dissector struct {
+	pattern    string
+	prefix     string
+	keys       []key
+	delimiters []string // delimiters[i] follows keys[i]
+}
+
+var keyFinder = regexp.MustCompile(`%\{([^}]*)\}`)
+
+// New parses a dissect pattern
+func New(pattern string) (Dissector, error) {
+	d := Dissector{pattern: pattern}
+	matches := keyFinder.FindAllStringSubmatchIndex(pattern, -1)
+	if len(matches) == 0 {
+		return d, errors.Errorf("unable to parse pattern [%s]: no keys found", pattern)
+	}
+	d.prefix = pattern[:matches[0][0]]
+
+	for i, m := range matches {
+		k := key{name: pattern[m[2]:m[3]], order: i}
+
+		if strings.HasSuffix(k.name, "->") {
+			k.rightPadding = true
+			k.name = strings.TrimSuffix(k.name, "->")
+		}
+		switch {
+		case k.name == "" || strings.HasPrefix(k.name, "?"):
+			k.skip = true
+		case strings.HasPrefix(k.name, "+"):
+			k.appendTo = true
+			k.name = k.name[1:]
+			if slash := strings.LastIndex(k.name, "/"); slash >= 0 {
+				order, err := strconv.Atoi(k.name[slash+1:])
+				if err != nil {
+					return d, errors.Errorf("unable to parse pattern [%s]: invalid append order in [%s]", pattern, k.name)
+				}
+				k.order = order
+				k.name = k.name[:slash]
+			}
+		case strings.HasPrefix(k.name, "*"):
+			k.referenceKey = true
+			k.name = k.name[1:]
+		case strings.HasPrefix(k.name, "&"):
+			k.referenceValue = true
+			k.name = k.name[1:]
+		}
+
+		end := len(pattern)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		d.keys = append(d.keys, k)
+		d.delimiters = append(d.delimiters, pattern[m[1]:end])
+	}
+	return d, nil
+}
+
+// Dissect splits value according to the pattern and returns the extracted fields.
+// Values of append keys (%{+name}) are joined with appendSeparator.
+func (d Dissector) Dissect(value string, appendSeparator string) (map[string]string, error) {
+	noMatch := errors.Errorf("Unable to find match for dissect pattern: %s against source: %s", d.pattern, value)
+
+	if !strings.HasPrefix(value, d.prefix) {
+		return nil, noMatch
+	}
+	pos := len(d.prefix)
+
+	values := make([]string, len(d.keys))
+	for i, k := range d.keys {
+		delimiter := d.delimiters[i]
+		last := i == len(d.keys)-1
+
+		if delimiter == "" {
+			if last {
+				values[i] = value[pos:]
+				pos = len(value)
+			}
+			continue
+		}
+
+		idx := strings.Index(value[pos:], delimiter)
+		if idx < 0 {
+			return nil, noMatch
+		}
+		values[i] = value[pos : pos+idx]
+		pos += idx + len(delimiter)
+		if k.rightPadding {
+			for strings.HasPrefix(value[pos:], delimiter) {
+				pos += len(delimiter)
+			}
+		}
+	}
+
+	result := map[string]string{}
+	referenceKeys := map[string]string{}
+	referenceValues := map[string]string{}
+	type appendValue struct {
+		order int
+		value string
+	}
+	appends := map[string][]appendValue{}
+
+	for i, k := range d.keys {
+		switch {
+		case k.skip:
+		case k.referenceKey:
+			referenceKeys[k.name] = values[i]
+		case k.referenceValue:
+			referenceValues[k.name] = values[i]
+		case k.appendTo:
+			appends[k.name] = append(appends[k.name], appendValue{order: k.order, value: values[i]})
+		default:
+			// A key without the + modifier that is also used by append keys is the first element
+			if _, ok := appends[k.name]; ok {
+				appends[k.name] = append(appends[k.name], appendValue{order: k.order, value: values[i]})
+			} else {
+				result[k.name] = values[i]
+			}
+		}
+	}
+
+	for name, parts := range appends {
+		if v, ok := result[name]; ok {
+			parts = append([]appendValue{{order: -1, value: v}}, parts...)
+		}
+		sort.SliceStable(parts, func(i, j int) bool { return parts[i].order < parts[j].order })
+		strs := make([]string, len(parts))
+		for i, p := range parts {
+			strs[i] = p.value
+		}
+		result[name] = strings.Join(strs, appendSeparator)
+	}
+
+	for name, k := range referenceKeys {
+		result[k] = referenceValues[name]
+	}
+	return result, nil
+}
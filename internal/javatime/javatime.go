@@ -0,0 +1,171 @@
+// Package javatime converts the date patterns used by Logstash (Joda) and
+// Elasticsearch (java.time) into Go time layouts.
+package javatime
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Special formats supported by both the Logstash date filter and the Elasticsearch date processor
+const (
+	ISO8601 = "ISO8601"
+	UNIX    = "UNIX"
+	UNIXMS  = "UNIX_MS"
+	TAI64N  = "TAI64N"
+)
+
+// DefaultOutputFormat is the output format of the Elasticsearch date processor
+const DefaultOutputFormat = "yyyy-MM-dd'T'HH:mm:ss.SSSXXX"
+
+var iso8601Layouts = []string{
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// Conversion of the pattern letters (repeated as in the pattern) to the Go layout.
+// Letters not listed here are not supported.
+var letters = map[string]string{
+	"yyyy": "2006", "yyy": "2006", "y": "2006", "yy": "06",
+	"uuuu": "2006", "u": "2006", "uu": "06",
+	"YYYY": "2006", "Y": "2006", "YY": "06",
+	"MMMM": "January", "MMM": "Jan", "MM": "01", "M": "1",
+	"dd": "02", "d": "2",
+	"DDD": "002",
+	"HH":  "15", "H": "15",
+	"hh": "03", "h": "3",
+	"mm": "04", "m": "4",
+	"ss": "05", "s": "5",
+	"a":    "PM",
+	"EEEE": "Monday", "EEE": "Mon", "EE": "Mon", "E": "Mon",
+	"Z": "-0700", "ZZ": "-07:00", "ZZZZZ": "-07:00",
+	"X": "Z07", "XX": "Z0700", "XXX": "Z07:00",
+	"x": "-07", "xx": "-0700", "xxx": "-07:00",
+	"z": "MST", "zz": "MST", "zzz": "MST",
+}
+
+// Layout converts a Java/Joda date pattern into the corresponding Go layout
+func Layout(pattern string) (string, error) {
+	var b strings.Builder
+	runes := []rune(pattern)
+
+	for i := 0; i < len(runes); {
+		c := runes[i]
+
+		// Quoted literal text, '' is a single quote
+		if c == '\'' {
+			j := i + 1
+			if j < len(runes) && runes[j] == '\'' {
+				b.WriteRune('\'')
+				i += 2
+				continue
+			}
+			for j < len(runes) && runes[j] != '\'' {
+				b.WriteRune(runes[j])
+				j++
+			}
+			i = j + 1
+			continue
+		}
+
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			b.WriteRune(c)
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(runes) && runes[j] == c {
+			j++
+		}
+		token := string(runes[i:j])
+		i = j
+
+		// Fraction of seconds, Go requires the separator to precede the digits
+		if c == 'S' {
+			b.WriteString(strings.Repeat("0", len(token)))
+			continue
+		}
+
+		layout, ok := letters[token]
+		if !ok {
+			return "", errors.Errorf("pattern letter '%s' is not supported", token)
+		}
+		b.WriteString(layout)
+	}
+	return b.String(), nil
+}
+
+// Parse parses value according to format, which is either a Java/Joda pattern or one of the special
+// formats ISO8601, UNIX, UNIX_MS or TAI64N. Values without timezone are interpreted in loc.
+func Parse(format string, value string, loc *time.Location) (time.Time, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	switch format {
+	case ISO8601:
+		for _, layout := range iso8601Layouts {
+			if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, errors.Errorf("failed to parse date field [%s] with format [%s]", value, format)
+
+	case UNIX, UNIXMS:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return time.Time{}, errors.Errorf("failed to parse date field [%s] with format [%s]", value, format)
+		}
+		if format == UNIX {
+			f = f * 1000
+		}
+		return time.UnixMilli(int64(f)).In(loc), nil
+
+	case TAI64N:
+		v := strings.TrimPrefix(value, "@")
+		if len(v) != 24 {
+			return time.Time{}, errors.Errorf("failed to parse date field [%s] with format [%s]", value, format)
+		}
+		base, err1 := strconv.ParseUint(v[:16], 16, 64)
+		nanos, err2 := strconv.ParseUint(v[16:], 16, 64)
+		if err1 != nil || err2 != nil {
+			return time.Time{}, errors.Errorf("failed to parse date field [%s] with format [%s]", value, format)
+		}
+		// TAI64 labels start at 2^62 and are 10 seconds ahead of UTC
+		seconds := int64(base-(1<<62)) - 10
+		return time.Unix(seconds, int64(nanos)).In(loc), nil
+	}
+
+	layout, err := Layout(format)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := time.ParseInLocation(layout, value, loc)
+	if err != nil {
+		return time.Time{}, errors.Errorf("failed to parse date field [%s] with format [%s]", value, format)
+	}
+	// Patterns without year default to the current year as in Logstash and Elasticsearch
+	if t.Year() == 0 {
+		t = t.AddDate(time.Now().In(loc).Year(), 0, 0)
+	}
+	return t, nil
+}
+
+// Format formats t according to a Java/Joda pattern
+func Format(pattern string, t time.Time) (string, error) {
+	layout, err := Layout(pattern)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(layout), nil
+}